@@ -0,0 +1,169 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitshifted/liftoff/event"
+	"github.com/bitshifted/liftoff/liftoff"
+	"github.com/bitshifted/liftoff/log"
+	"github.com/bitshifted/liftoff/progress"
+	"github.com/rs/zerolog"
+)
+
+// ConfigFiles selects configuration files processed by a command
+type ConfigFiles struct {
+	File        []string `short:"f" help:"Configuration file, directory or glob pattern. Can be repeated. Defaults to --config-file" sep:"none"`
+	Parallelism int      `help:"Maximum number of configurations processed at the same time" default:"4"`
+}
+
+// result of processing single configuration in a batch
+type batchResult struct {
+	label    string
+	path     string
+	duration time.Duration
+	err      error
+}
+
+// runs operation for selected configuration files. Multiple configurations are processed concurrently,
+// each with its own output prefix, followed by aggregated result table
+func (cli *CLI) runProjects(files ConfigFiles, op func(project *liftoff.Project, logger *zerolog.Logger) error) error {
+	patterns := files.File
+	if len(patterns) == 0 {
+		patterns = []string{cli.ConfigFile}
+	}
+	paths, err := liftoff.ExpandConfigPaths(patterns)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 1 {
+		project, err := cli.loadProjectFile(paths[0])
+		if err != nil {
+			return err
+		}
+		err = op(project, &log.Logger)
+		cli.writeSummary()
+		return err
+	}
+	parallelism := files.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	// single run log receives log messages of all configurations
+	cli.startRunIn("")
+	log.Logger.Info().Msgf("Processing %d configurations, at most %d at a time", len(paths), parallelism)
+
+	if cli.Output == outputJSON {
+		// create shared handler before it is used concurrently
+		cli.eventHandler()
+	}
+	labels := configLabels(paths)
+	results := make([]batchResult, len(paths))
+	var stdoutMu, stderrMu sync.Mutex
+	colorOut := progress.ColorEnabled(os.Stdout)
+	colorErr := progress.ColorEnabled(os.Stderr)
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, configPath := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			stdout := progress.NewPrefixWriter(os.Stdout, &stdoutMu, labels[i], i, colorOut)
+			stderr := progress.NewPrefixWriter(os.Stderr, &stderrMu, labels[i], i, colorErr)
+			start := time.Now()
+			err := cli.runBatchProject(configPath, labels[i], stdout, stderr, op)
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+			results[i] = batchResult{label: labels[i], path: configPath, duration: time.Since(start), err: err}
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.label, result.err))
+		}
+	}
+	if cli.Output != outputJSON {
+		fmt.Println()
+		if err = writeBatchSummary(os.Stdout, results); err != nil {
+			log.Logger.Warn().Err(err).Msg("Failed to write summary")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loads and processes single configuration of a batch. Output, log messages and events are tagged with
+// configuration label
+func (cli *CLI) runBatchProject(configPath, label string, stdout, stderr io.Writer, op func(project *liftoff.Project, logger *zerolog.Logger) error) error {
+	logger := log.Logger.With().Str("config", label).Logger()
+	options := cli.projectOptions(stdout, stderr, &logger)
+	if cli.Output == outputJSON {
+		handler := cli.eventHandler()
+		options.OnEvent = func(e event.Event) {
+			e.Config = configPath
+			handler(e)
+		}
+	} else {
+		options.OnEvent = progress.NewView(stdout).Handle
+	}
+	project, err := cli.newProject(configPath, options)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load configuration")
+		return err
+	}
+	err = op(project, &logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("Execution failed")
+	}
+	return err
+}
+
+// returns short labels for configuration files. File name without extension is used, unless several
+// files have the same name, in which case parent directory is included
+func configLabels(paths []string) []string {
+	labels := make([]string, len(paths))
+	counts := map[string]int{}
+	for i, p := range paths {
+		labels[i] = strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		counts[labels[i]]++
+	}
+	for i, p := range paths {
+		if counts[labels[i]] > 1 {
+			labels[i] = filepath.Join(filepath.Base(filepath.Dir(p)), labels[i])
+		}
+	}
+	return labels
+}
+
+func writeBatchSummary(w io.Writer, results []batchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONFIG\tSTATUS\tDURATION\tERROR")
+	failed := 0
+	for _, result := range results {
+		status := "ok"
+		errMsg := ""
+		if result.err != nil {
+			status = "failed"
+			errMsg = strings.ReplaceAll(result.err.Error(), "\n", "; ")
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.label, status, result.duration.Round(time.Millisecond), errMsg)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "Configurations:\t%d ok, %d failed\n", len(results)-failed, failed)
+	return tw.Flush()
+}
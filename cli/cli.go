@@ -4,39 +4,92 @@
 package cli
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/alecthomas/kong"
 	"github.com/bitshifted/liftoff/common"
 	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/event"
 	"github.com/bitshifted/liftoff/exec"
+	"github.com/bitshifted/liftoff/history"
+	"github.com/bitshifted/liftoff/liftoff"
 	"github.com/bitshifted/liftoff/log"
-)
-
-const (
-	configFileArg          = "--config-file"
-	terraformPathArg       = "--terraform-path"
-	ansiblePlaybookPathArg = "--playbook-bin-path"
+	"github.com/bitshifted/liftoff/progress"
+	"github.com/rs/zerolog"
 )
 
 type CLI struct {
 	TerraformPath   string          `help:"Path to Terraform binary"`
 	PlaybookBinPath string          `help:"Path to ansible-playbook binary"`
-	ConfigFile      string          `help:"Path to configuration file"`
-	EnableDebug     bool            `help:"Enable debug logging"`
+	ConfigFile      string          `help:"Path to configuration file" default:"${default_config_file}"`
+	EnableDebug     bool            `help:"Enable debug logging. Same as --log-level=debug"`
+	LogLevel        string          `help:"Minimum level of log messages" enum:"trace,debug,info,warn,error" default:"info"`
+	LogFormat       string          `help:"Format of log messages" enum:"console,json" default:"console"`
+	LogRetention    int             `help:"Number of run logs to keep" default:"20"`
+	LogMaxAge       time.Duration   `help:"Delete run logs older than this" default:"720h"`
+	Output          string          `help:"Output format. With 'json', progress events are written to standard output as JSON lines" enum:"text,json" default:"text"`
+	Var             []string        `help:"Set variable, like 'key=value'. Nested values are set with dotted keys. Can be repeated" sep:"none"`
+	VarFile         []string        `help:"Load variables from YAML, JSON or .tfvars file. Can be repeated" sep:"none"`
 	Setup           SetupCmd        `cmd:"" help:"Setup and configure infrastructure"`
+	Plan            PlanCmd         `cmd:"" name:"plan" help:"Show changes required to infrastructure"`
 	TearDown        TearDownCmd     `cmd:"" name:"teardown" help:"Cleanup created infrastructure"`
 	Version         VersionCmd      `cmd:"" name:"version" help:"Display version information"`
 	TestTemplate    TestTemplateCmd `cmd:"" name:"test-template" help:"Generate code from template and perform sanity checks"`
+	Reap            ReapCmd         `cmd:"" name:"reap" help:"Tear down stacks whose TTL has expired"`
+	Config          ConfigCmd       `cmd:"" name:"config" help:"Inspect configuration"`
+	Doctor          DoctorCmd       `cmd:"" name:"doctor" help:"Check that tools, credentials and files needed by configuration are available"`
+	SSH             SSHCmd          `cmd:"" name:"ssh" help:"Connect to provisioned host using generated SSH config"`
+	Exec            ExecCmd         `cmd:"" name:"exec" help:"Run command on provisioned hosts matching pattern"`
+	Outputs         OutputCmd       `cmd:"" name:"output" help:"Show Terraform outputs of provisioned infrastructure"`
+
+	events event.Handler
+	view   *progress.View
+	runID  string
+	runLog *log.RunLog
 }
 
+// Vars contains variables for interpolation in CLI tags
+var Vars = map[string]string{
+	"default_config_file": common.DefaultConfigFileName,
+}
+
+const outputJSON = "json"
+
 type SetupCmd struct {
-	SkipTerraform bool `help:"Do not run Terraform"`
-	SkipAnsible   bool `help:"Do not run Ansible"`
+	ConfigFiles   `embed:""`
+	SkipTerraform bool     `help:"Do not run Terraform"`
+	SkipAnsible   bool     `help:"Do not run Ansible"`
+	Target        []string `help:"Limit setup to Terraform resource or module. Can be repeated" sep:"none"`
+	Replace       []string `help:"Force recreation of Terraform resource. Can be repeated" sep:"none"`
+	LinkSSHConfig bool     `help:"Link snippet with SSH host entries into ~/.ssh/config.d"`
+	SkipChecks    bool     `help:"Do not run health checks after setup"`
+	Resume        bool     `help:"Skip phases completed by previous setup, if configuration and template did not change" xor:"phases"`
+	FromPhase     string   `help:"Skip phases before given one: fetch, render, terraform, ssh-config, ansible-render, ansible or checks" xor:"phases"`
+	OnlyPhase     string   `help:"Run only given phase: render, terraform, ssh-config, ansible-render, ansible or checks" xor:"phases"`
+}
+
+type PlanCmd struct {
+	ConfigFiles `embed:""`
+	Target      []string `help:"Limit plan to Terraform resource or module. Can be repeated" sep:"none"`
+	Replace     []string `help:"Plan recreation of Terraform resource. Can be repeated" sep:"none"`
 }
 
 type TearDownCmd struct {
+	ConfigFiles    `embed:""`
+	Render         bool     `help:"Render templates before destroying infrastructure"`
+	SkipPreDestroy bool     `help:"Do not run template pre-destroy playbook"`
+	KeepArtifacts  bool     `help:"Keep generated files and other local artifacts"`
+	Target         []string `help:"Destroy only Terraform resource or module. Can be repeated" sep:"none"`
+	Yes            bool     `short:"y" help:"Destroy targeted resources without confirmation"`
 }
 
 type VersionCmd struct {
@@ -45,64 +98,72 @@ type VersionCmd struct {
 type TestTemplateCmd struct {
 }
 
-func (s *SetupCmd) Run(ctx *kong.Context) error {
+func (s *SetupCmd) Run(cli *CLI) error {
 	log.Logger.Info().Msg("Executing setup...")
-	configFile := extractArgumentValue(ctx.Args, configFileArg, 1, common.DefaultConfigFileName)
-	conf, err := config.LoadConfig(configFile)
-	if err != nil {
+	return cli.runProjects(s.ConfigFiles, func(project *liftoff.Project, _ *zerolog.Logger) error {
+		_, err := project.Setup(context.Background(), liftoff.SetupOptions{
+			SkipTerraform: s.SkipTerraform,
+			SkipAnsible:   s.SkipAnsible,
+			Targets:       s.Target,
+			Replace:       s.Replace,
+			LinkSSHConfig: s.LinkSSHConfig,
+			SkipChecks:    s.SkipChecks,
+			Resume:        s.Resume,
+			FromPhase:     s.FromPhase,
+			OnlyPhase:     s.OnlyPhase,
+		})
 		return err
-	}
-	configFileAbsPath, err := filepath.Abs(configFile)
-	if err != nil {
-		return err
-	}
-	log.Logger.Info().Msgf("Reading configuration file %s", configFileAbsPath)
-	executionConfig := exec.ExecutionConfig{
-		Config:              conf,
-		ConfigFilePath:      configFileAbsPath,
-		SkipTerraform:       s.SkipTerraform,
-		SkipAnsible:         s.SkipAnsible,
-		TerraformPath:       extractArgumentValue(ctx.Args, terraformPathArg, 1, ""),
-		AnsiblePlaybookPath: extractArgumentValue(ctx.Args, ansiblePlaybookPathArg, 1, ""),
-	}
-	return executionConfig.ExecuteSetup()
+	})
+}
+
+func (p *PlanCmd) Run(cli *CLI) error {
+	log.Logger.Info().Msg("Executing plan...")
+	return cli.runProjects(p.ConfigFiles, func(project *liftoff.Project, logger *zerolog.Logger) error {
+		result, err := project.Plan(context.Background(), liftoff.PlanOptions{
+			Targets: p.Target,
+			Replace: p.Replace,
+		})
+		if err != nil {
+			return err
+		}
+		if result.HasChanges {
+			logger.Info().Msg("Infrastructure changes are required")
+		} else {
+			logger.Info().Msg("Infrastructure is up to date")
+		}
+		return nil
+	})
 }
 
-func (t *TearDownCmd) Run(ctx *kong.Context) error {
+func (t *TearDownCmd) Run(cli *CLI) error {
 	log.Logger.Info().Msg("Executing teardown...")
-	configFile := extractArgumentValue(ctx.Args, configFileArg, 1, common.DefaultConfigFileName)
-	conf, err := config.LoadConfig(configFile)
-	if err != nil {
-		return err
-	}
-	configFileAbsPath, err := filepath.Abs(configFile)
-	if err != nil {
+	return cli.runProjects(t.ConfigFiles, func(project *liftoff.Project, _ *zerolog.Logger) error {
+		_, err := project.Teardown(context.Background(), liftoff.TeardownOptions{
+			Render:         t.Render,
+			SkipPreDestroy: t.SkipPreDestroy,
+			KeepArtifacts:  t.KeepArtifacts,
+			Targets:        t.Target,
+			AutoApprove:    t.Yes,
+			Confirm:        confirm,
+		})
 		return err
-	}
-	log.Logger.Info().Msgf("Reading configuration file %s", configFileAbsPath)
-	executionConfig := exec.ExecutionConfig{
-		Config:              conf,
-		ConfigFilePath:      configFileAbsPath,
-		TerraformPath:       extractArgumentValue(ctx.Args, terraformPathArg, 1, ""),
-		AnsiblePlaybookPath: extractArgumentValue(ctx.Args, ansiblePlaybookPathArg, 1, ""),
-	}
-	return executionConfig.ExecuteTeardown()
+	})
 }
 
-func (vc *VersionCmd) Run(ctx *kong.Context) error {
+func (vc *VersionCmd) Run() error {
 	fmt.Printf("Version: %s\nBuild number: %s\nCommit ID: %s\n",
 		ProgramVersion.Version, ProgramVersion.BuildNumber, ProgramVersion.CommitID)
 	return nil
 }
 
-func (tc *TestTemplateCmd) Run(ctx *kong.Context) error {
+func (tc *TestTemplateCmd) Run(cli *CLI) error {
 	log.Logger.Info().Msg("Performing template test...")
-	configFile := extractArgumentValue(ctx.Args, configFileArg, 1, common.DefaultConfigFileName)
-	conf, err := config.LoadConfig(configFile)
+	configFileAbsPath, err := filepath.Abs(cli.ConfigFile)
 	if err != nil {
 		return err
 	}
-	configFileAbsPath, err := filepath.Abs(configFile)
+	cli.startRun(configFileAbsPath)
+	conf, err := config.LoadConfigWithOverrides(cli.ConfigFile, cli.overrides())
 	if err != nil {
 		return err
 	}
@@ -110,17 +171,180 @@ func (tc *TestTemplateCmd) Run(ctx *kong.Context) error {
 	executionConfig := exec.ExecutionConfig{
 		Config:         conf,
 		ConfigFilePath: configFileAbsPath,
+		Logger:         &log.Logger,
+		TerraformPath:  cli.TerraformPath,
+		RunID:          cli.runID,
+		RunLog:         cli.runLogWriter(),
 	}
 	return executionConfig.ExecuteTestTemplate()
 }
 
-func extractArgumentValue(args []string, argument string, valueIndex int8, defaultValue string) string { //nolint:unparam
-	value := defaultValue
-	for i, s := range args {
-		if s == argument {
-			value = args[i+int(valueIndex)]
-			break
+// ConfigureLogging sets up logger according to command line flags
+func (cli *CLI) ConfigureLogging() error {
+	return log.Configure(cli.logConfig())
+}
+
+func (cli *CLI) logConfig() log.Config {
+	level := cli.LogLevel
+	if cli.EnableDebug {
+		level = "debug"
+	}
+	return log.Config{
+		Level:  level,
+		Format: cli.LogFormat,
+		RunID:  cli.runID,
+	}
+}
+
+// starts a run by generating run ID and opening per-run log file, which receives all log messages.
+// Run logs are stored in directory for generated files, or in liftoff home directory if it is not writable
+func (cli *CLI) startRun(configPath string) {
+	cli.startRunIn(path.Join(exec.OutputDirPath(configPath), exec.RunLogsDirName))
+}
+
+// starts a run with run log in given directory. Empty directory selects liftoff home directory
+func (cli *CLI) startRunIn(logsDir string) {
+	cli.Close()
+	cli.runLog = nil
+	cli.runID = log.NewRunID()
+	retention := log.Retention{MaxRuns: cli.LogRetention, MaxAge: cli.LogMaxAge}
+	var runLog *log.RunLog
+	err := errors.New("run log directory is not set")
+	if logsDir != "" {
+		runLog, err = log.OpenRunLog(logsDir, cli.runID, retention)
+	}
+	if err != nil {
+		log.Logger.Debug().Err(err).Msgf("Failed to create run log in %s", logsDir)
+		homeDir, herr := os.UserHomeDir()
+		if herr == nil {
+			runLog, err = log.OpenRunLog(path.Join(homeDir, common.LiftoffHomeDirName, common.LogsDirName), cli.runID, retention)
 		}
 	}
-	return value
+	cfg := cli.logConfig()
+	if err == nil {
+		cli.runLog = runLog
+		cfg.File = runLog
+	}
+	if cerr := log.Configure(cfg); cerr != nil {
+		log.Logger.Warn().Err(cerr).Msg("Failed to configure logging")
+	}
+	if cli.runLog != nil {
+		log.Logger.Info().Msgf("Run log file: %s", cli.runLog.Path)
+	} else {
+		log.Logger.Warn().Err(err).Msg("Failed to create run log file")
+	}
+}
+
+func (cli *CLI) runLogWriter() io.Writer {
+	if cli.runLog == nil {
+		return nil
+	}
+	return cli.runLog
+}
+
+// Close releases resources held during the run
+func (cli *CLI) Close() {
+	if cli.runLog != nil {
+		_ = cli.runLog.Close()
+	}
+}
+
+func (cli *CLI) loadProject() (*liftoff.Project, error) {
+	return cli.loadProjectFile(cli.ConfigFile)
+}
+
+func (cli *CLI) loadProjectFile(configFile string) (*liftoff.Project, error) {
+	return cli.loadProjectWithOverrides(configFile, cli.overrides())
+}
+
+// loads project with given variable overrides instead of ones set on command line
+func (cli *CLI) loadProjectWithOverrides(configFile string, overrides config.Overrides) (*liftoff.Project, error) {
+	configFileAbsPath, err := filepath.Abs(configFile)
+	if err != nil {
+		return nil, err
+	}
+	cli.startRun(configFileAbsPath)
+	options := cli.projectOptions(os.Stdout, os.Stderr, &log.Logger)
+	options.Overrides = overrides
+	if cli.Output == outputJSON {
+		options.OnEvent = cli.eventHandler()
+	} else {
+		cli.view = progress.NewView(os.Stdout)
+		options.OnEvent = cli.view.Handle
+	}
+	return cli.newProject(configFile, options)
+}
+
+// returns project options common for all commands. Event handler is set by caller
+func (cli *CLI) projectOptions(stdout, stderr io.Writer, logger *zerolog.Logger) liftoff.Options {
+	options := liftoff.Options{
+		Logger:              logger,
+		Stdout:              stdout,
+		Stderr:              stderr,
+		TerraformPath:       cli.TerraformPath,
+		AnsiblePlaybookPath: cli.PlaybookBinPath,
+		RunID:               cli.runID,
+		RunLog:              cli.runLogWriter(),
+		MachineReadable:     cli.Output == outputJSON,
+		Overrides:           cli.overrides(),
+	}
+	store, err := history.DefaultStore()
+	if err != nil {
+		logger.Warn().Err(err).Msg("Run history is not available")
+	} else {
+		options.History = store
+	}
+	return options
+}
+
+func (cli *CLI) newProject(configFile string, options liftoff.Options) (*liftoff.Project, error) {
+	project, err := liftoff.Load(context.Background(), configFile, options)
+	if err != nil {
+		return nil, err
+	}
+	options.Logger.Info().Msgf("Reading configuration file %s", project.ConfigPath())
+	return project, nil
+}
+
+func (cli *CLI) eventHandler() event.Handler {
+	if cli.events == nil {
+		cli.events = event.NewJSONHandler(os.Stdout)
+	}
+	return cli.events
+}
+
+// ReportError emits error event if JSON output is enabled
+func (cli *CLI) ReportError(err error) {
+	if cli.Output == outputJSON {
+		cli.eventHandler()(event.Event{Type: event.Error, Error: err.Error()})
+	}
+}
+
+// writes end-of-run summary table in text output mode
+func (cli *CLI) writeSummary() {
+	if cli.view == nil {
+		return
+	}
+	fmt.Println()
+	if err := cli.view.WriteSummary(os.Stdout); err != nil {
+		log.Logger.Warn().Err(err).Msg("Failed to write summary")
+	}
+}
+
+// serializes confirmation prompts of configurations processed concurrently
+var confirmMu sync.Mutex
+
+// reader of standard input shared by all prompts, so that input buffered for one prompt is available to next ones
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// asks user for confirmation on standard input. Only "yes" is accepted as confirmation
+func confirm(message string) (bool, error) {
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+	fmt.Fprintf(os.Stderr, "%s Only 'yes' will be accepted to confirm.\nEnter a value: ", message)
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return strings.TrimSpace(answer) == "yes", nil
 }
@@ -0,0 +1,49 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"os"
+
+	"github.com/bitshifted/liftoff/config"
+	"gopkg.in/yaml.v3"
+)
+
+type ConfigCmd struct {
+	Show ConfigShowCmd `cmd:"" help:"Print configuration file"`
+}
+
+type ConfigShowCmd struct {
+	Resolved bool `help:"Print effective configuration, with includes, variables files and overrides applied. Secrets are masked. Files included from template are not applied"`
+}
+
+func (s *ConfigShowCmd) Run(cli *CLI) error {
+	if !s.Resolved {
+		data, err := os.ReadFile(cli.ConfigFile)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	conf, err := config.LoadConfigWithOverrides(cli.ConfigFile, cli.overrides())
+	if err != nil {
+		return err
+	}
+	resolved, err := conf.Resolved()
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(resolved); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// returns variable overrides set on command line
+func (cli *CLI) overrides() config.Overrides {
+	return config.Overrides{VarFiles: cli.VarFile, Vars: cli.Var}
+}
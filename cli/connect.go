@@ -0,0 +1,86 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bitshifted/liftoff/liftoff"
+	"github.com/bitshifted/liftoff/log"
+)
+
+type SSHCmd struct {
+	Stack   string   `help:"Stack of configuration with multiple stacks"`
+	List    bool     `help:"Print aliases of known hosts, one per line, and exit. Useful for shell completion"`
+	Host    string   `arg:"" optional:"" help:"Host alias from generated SSH config, or host address"`
+	Command []string `arg:"" optional:"" passthrough:"" help:"Command to run instead of interactive shell"`
+}
+
+type ExecCmd struct {
+	Stack       string   `help:"Stack of configuration with multiple stacks"`
+	Parallelism int      `help:"Maximum number of hosts on which command runs at the same time" default:"10"`
+	Pattern     string   `arg:"" help:"Comma separated host aliases or glob patterns"`
+	Command     []string `arg:"" passthrough:"" help:"Command to run on matching hosts"`
+}
+
+func (s *SSHCmd) Run(cli *CLI) error {
+	project, err := cli.loadReadOnlyProject()
+	if err != nil {
+		return err
+	}
+	if s.List {
+		hosts, err := project.SSHHosts(context.Background(), s.Stack)
+		if err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			fmt.Println(host.Alias)
+		}
+		return nil
+	}
+	if s.Host == "" {
+		return errors.New("host is required")
+	}
+	return project.SSH(context.Background(), liftoff.SSHOptions{
+		Stack:   s.Stack,
+		Host:    s.Host,
+		Command: trimSeparator(s.Command),
+	})
+}
+
+func (e *ExecCmd) Run(cli *CLI) error {
+	command := trimSeparator(e.Command)
+	if len(command) == 0 {
+		return errors.New("command is required")
+	}
+	project, err := cli.loadReadOnlyProject()
+	if err != nil {
+		return err
+	}
+	_, err = project.Exec(context.Background(), liftoff.ExecOptions{
+		Stack:       e.Stack,
+		Pattern:     e.Pattern,
+		Command:     command,
+		Parallelism: e.Parallelism,
+	})
+	return err
+}
+
+// loads project for commands which do not change infrastructure, so run log is not created
+func (cli *CLI) loadReadOnlyProject() (*liftoff.Project, error) {
+	options := cli.projectOptions(os.Stdout, os.Stderr, &log.Logger)
+	options.Stdin = os.Stdin
+	return cli.newProject(cli.ConfigFile, options)
+}
+
+// removes "--" separating command from liftoff arguments
+func trimSeparator(command []string) []string {
+	if len(command) > 0 && command[0] == "--" {
+		return command[1:]
+	}
+	return command
+}
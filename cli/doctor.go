@@ -0,0 +1,46 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/doctor"
+)
+
+type DoctorCmd struct {
+}
+
+func (d *DoctorCmd) Run(cli *CLI) error {
+	configPath, err := filepath.Abs(cli.ConfigFile)
+	if err != nil {
+		return err
+	}
+	opts := doctor.Options{
+		ConfigPath:          configPath,
+		TerraformPath:       cli.TerraformPath,
+		AnsiblePlaybookPath: cli.PlaybookBinPath,
+	}
+	opts.Config, opts.ConfigError = config.LoadConfigWithOverrides(configPath, cli.overrides())
+	checks := doctor.Run(context.Background(), opts)
+	if cli.Output == outputJSON {
+		if err = json.NewEncoder(os.Stdout).Encode(checks); err != nil {
+			return err
+		}
+	} else {
+		for _, check := range checks {
+			fmt.Printf("[%s] %-22s %s\n", strings.ToUpper(string(check.Status)), check.Name, check.Message)
+		}
+	}
+	if failed := doctor.Failed(checks); failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bitshifted/liftoff/liftoff"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputFormatJSON   = "json"
+	outputFormatYAML   = "yaml"
+	outputFormatExport = "export"
+	outputFormatDotenv = "dotenv"
+)
+
+type OutputCmd struct {
+	Stack         string `help:"Stack of configuration with multiple stacks. Outputs of all stacks are shown if not set"`
+	Format        string `help:"Format of printed values" enum:"raw,json,yaml,export,dotenv" default:"raw"`
+	ShowSensitive bool   `help:"Show values of sensitive outputs"`
+	Name          string `arg:"" optional:"" help:"Name of output, or path to value inside it, like 'servers[0].ipv4'"`
+}
+
+func (o *OutputCmd) Run(cli *CLI) error {
+	project, err := cli.loadReadOnlyProject()
+	if err != nil {
+		return err
+	}
+	outputs, err := project.Outputs(context.Background(), o.Stack)
+	if err != nil {
+		return err
+	}
+	values := outputs.Values
+	if !o.ShowSensitive {
+		values = outputs.Masked()
+	}
+	if o.Name == "" {
+		return writeOutput(os.Stdout, o.Format, "", values)
+	}
+	if outputs.IsSensitive(o.Name) {
+		if outputs.Cached() {
+			return fmt.Errorf("output '%s' is sensitive and its value is not recorded in run history", o.Name)
+		}
+		if !o.ShowSensitive {
+			return fmt.Errorf("output '%s' is sensitive, use --show-sensitive to show it", o.Name)
+		}
+	}
+	value, err := liftoff.SelectOutput(values, o.Name)
+	if err != nil {
+		return err
+	}
+	return writeOutput(os.Stdout, o.Format, o.Name, value)
+}
+
+// writes value in selected format. Name is used for variable names in shell formats
+func writeOutput(out io.Writer, format, name string, value interface{}) error {
+	switch format {
+	case outputFormatJSON:
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case outputFormatYAML:
+		return yaml.NewEncoder(out).Encode(value)
+	case outputFormatExport, outputFormatDotenv:
+		return writeEnvOutput(out, format, name, value)
+	default:
+		text, err := rawValue(value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, text)
+		return err
+	}
+}
+
+// writes value as environment variables. Each key of a map becomes a variable, prefixed with name if set
+func writeEnvOutput(out io.Writer, format, name string, value interface{}) error {
+	values, ok := value.(map[string]interface{})
+	prefix := ""
+	if !ok {
+		values = map[string]interface{}{name: value}
+	} else if name != "" {
+		prefix = name + "_"
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		text, err := envValue(values[key])
+		if err != nil {
+			return err
+		}
+		if format == outputFormatExport {
+			_, err = fmt.Fprintf(out, "export %s='%s'\n", envName(prefix+key), strings.ReplaceAll(text, "'", `'\''`))
+		} else {
+			_, err = fmt.Fprintf(out, "%s=%s\n", envName(prefix+key), dotenvQuote(text))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns strings as they are, and other values as JSON. Complex values are indented
+func rawValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	default:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+}
+
+// returns strings as they are, and other values as compact JSON
+func envValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// converts output name to environment variable name, like "db-host" to "DB_HOST"
+func envName(name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name))
+	if mapped != "" && mapped[0] >= '0' && mapped[0] <= '9' {
+		mapped = "_" + mapped
+	}
+	return mapped
+}
+
+func dotenvQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/history"
+	"github.com/bitshifted/liftoff/liftoff"
+	"github.com/bitshifted/liftoff/log"
+)
+
+type ReapCmd struct {
+	Yes bool `short:"y" help:"Tear down expired stacks. Without this flag, expired stacks are only listed"`
+}
+
+func (r *ReapCmd) Run(cli *CLI) error {
+	store, err := history.DefaultStore()
+	if err != nil {
+		return err
+	}
+	expired, err := liftoff.ExpiredStacks(store, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		log.Logger.Info().Msg("No expired stacks found")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STACK\tCONFIG\tTTL\tEXPIRED AT")
+	for _, stack := range expired {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", stack.ID, stack.ConfigFile, stack.TTL, stack.ExpiresAt.Format(time.RFC3339))
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+	if !r.Yes {
+		log.Logger.Info().Msg("Dry run, no stacks were torn down. Use --yes to tear down expired stacks")
+		return nil
+	}
+	var errs []error
+	for _, stack := range expired {
+		log.Logger.Info().Msgf("Tearing down expired stack %s", stack.ID)
+		err = cli.reapStack(stack)
+		if err != nil {
+			log.Logger.Error().Err(err).Msgf("Failed to tear down stack %s", stack.ID)
+			errs = append(errs, fmt.Errorf("%s: %w", stack.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tears down stack with variable overrides recorded at setup, so that the same infrastructure is destroyed
+func (cli *CLI) reapStack(stack *history.Stack) error {
+	overrides := config.Overrides{VarFiles: stack.VarFiles, Vars: stack.Vars}
+	project, err := cli.loadProjectWithOverrides(stack.ConfigFile, overrides)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, name := range stack.Stacks {
+		if !slices.Contains(project.Stacks(), name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("stacks %s were set up, but are no longer in configuration", strings.Join(missing, ", "))
+	}
+	_, err = project.Teardown(context.Background(), liftoff.TeardownOptions{})
+	cli.writeSummary()
+	return err
+}
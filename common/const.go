@@ -9,4 +9,6 @@ const (
 	DefaultTerraformDir         = "terraform"
 	DefaultAnsibleDir           = "ansible"
 	DefaultAnsibleInventoryFile = "inventory"
+	LiftoffHomeDirName          = ".liftoff"
+	LogsDirName                 = "logs"
 )
@@ -7,8 +7,6 @@ import (
 	"fmt"
 	"os"
 	"strings"
-
-	"github.com/bitshifted/liftoff/log"
 )
 
 type ValueType int8
@@ -23,12 +21,10 @@ const (
 
 func ValueTypeFromString(input string) ValueType {
 	if strings.HasPrefix(input, envPrefix) {
-		log.Logger.Debug().Msgf("Found environment variable setting: %s", input)
 		return EnvVariableString
 	}
 	// check if it's file content reference
 	if strings.HasPrefix(input, contentPrefix) {
-		log.Logger.Debug().Msgf("Found file content setting: %s", input)
 		return FileContentString
 	}
 	return PlainString
@@ -43,6 +39,21 @@ func ExtractEnvVarName(input string) string {
 	return strings.Replace(input, envPrefix, "", 1)
 }
 
+// ExtractFilePath returns path of file referenced with "fromfile:" prefix, with home directory expanded
+func ExtractFilePath(input string) (string, error) {
+	// strip prefix
+	path := strings.Replace(input, contentPrefix, "", 1)
+	// adjust path for home directory
+	if strings.HasPrefix(path, "~") {
+		homeDirPath, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = strings.Replace(path, "~", homeDirPath, 1)
+	}
+	return path, nil
+}
+
 func ProcessStringValue(input string) (string, error) {
 	valueType := ValueTypeFromString(input)
 	switch valueType {
@@ -51,22 +62,14 @@ func ProcessStringValue(input string) (string, error) {
 		varName := ExtractEnvVarName(input)
 		if !IsEnvVariableSet(varName) {
 			err := fmt.Errorf("referenced environment variable %s is not set", varName)
-			log.Logger.Error().Err(err).Msg("Environment variable is not set")
 			return "", err
 		} else {
 			return osGetEnv(varName), nil
 		}
 	case FileContentString:
-		// strip prefix
-		path := input[len(contentPrefix):]
-		// adjust path for home directory
-		if strings.HasPrefix(path, "~") {
-			homeDirPath, err := os.UserHomeDir()
-			if err != nil {
-				return "", err
-			}
-			log.Logger.Debug().Msgf("Home directory: %s", homeDirPath)
-			path = strings.Replace(path, "~", homeDirPath, 1)
+		path, err := ExtractFilePath(input)
+		if err != nil {
+			return "", err
 		}
 		// read file content into string
 		data, err := os.ReadFile(path)
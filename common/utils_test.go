@@ -75,3 +75,14 @@ func (ts *UtilsTestSuite) TestShouldReturnFileContentAbsPath() {
 	ts.NoError(err)
 	ts.Equal("sample text", content)
 }
+
+func (ts *UtilsTestSuite) TestShouldExtractFilePath() {
+	path, err := ExtractFilePath("fromfile:/path/to/file")
+	ts.NoError(err)
+	ts.Equal("/path/to/file", path)
+	home, err := os.UserHomeDir()
+	ts.NoError(err)
+	path, err = ExtractFilePath("fromfile:~/.ssh/id_ed25519.pub")
+	ts.NoError(err)
+	ts.Equal(home+"/.ssh/id_ed25519.pub", path)
+}
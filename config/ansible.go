@@ -3,7 +3,28 @@
 
 package config
 
+import (
+	"fmt"
+	"time"
+)
+
 type AnsibleConfig struct {
 	InventoryFile string `yaml:"inventory-file"`
 	PlaybookFile  string `yaml:"playbook-file"`
+	// Wait until all inventory hosts accept SSH connections before running playbook, at most given
+	// duration, like "5m". Disabled if not set
+	WaitForSSH         string        `yaml:"wait-for-ssh,omitempty"`
+	WaitForSSHDuration time.Duration `yaml:"-"`
+}
+
+func (a *AnsibleConfig) postLoad() error {
+	if a == nil || a.WaitForSSH == "" {
+		return nil
+	}
+	duration, err := parsePositiveDuration(a.WaitForSSH, 0)
+	if err != nil {
+		return fmt.Errorf("invalid wait-for-ssh: %w", err)
+	}
+	a.WaitForSSHDuration = duration
+	return nil
 }
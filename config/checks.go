@@ -0,0 +1,131 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// types of health checks
+const (
+	// TCP port is open. Target is "host:port"
+	CheckTCP = "tcp"
+	// HTTP(S) request returns expected status and body. Target is URL
+	CheckHTTP = "http"
+	// host name resolves, optionally to expected address. Target is host name
+	CheckDNS = "dns"
+	// command run over SSH exits with expected code. Target is host alias from generated SSH config, or address
+	CheckSSH = "ssh"
+)
+
+// defaults for health checks
+const (
+	DefaultCheckRetries  = 5
+	DefaultCheckInterval = 2 * time.Second
+	DefaultCheckTimeout  = 10 * time.Second
+)
+
+// Check is health check run after infrastructure is configured. Target and expected values can reference
+// Terraform outputs and variables with templates, like "[[ .Outputs.server_ip ]]:443"
+type Check struct {
+	// Name shown in logs. Defaults to type and target
+	Name   string `yaml:"name,omitempty"`
+	Type   string `yaml:"type"`
+	Target string `yaml:"target"`
+	// Expected HTTP status. Defaults to 200
+	Status int `yaml:"status,omitempty"`
+	// Regular expression which HTTP response body must match
+	Body string `yaml:"body,omitempty"`
+	// Do not verify TLS certificate of HTTPS target
+	Insecure bool `yaml:"insecure,omitempty"`
+	// Address to which DNS name must resolve
+	Address string `yaml:"address,omitempty"`
+	// Command run on SSH target
+	Command string `yaml:"command,omitempty"`
+	// Expected exit code of SSH command
+	ExitCode int `yaml:"exit-code,omitempty"`
+	// Number of retries after failed attempt. Defaults to 5
+	Retries *int `yaml:"retries,omitempty"`
+	// Wait before first retry, doubled after each retry, like "2s". Defaults to 2 seconds
+	Interval string `yaml:"interval,omitempty"`
+	// Maximum duration of single attempt, like "10s". Defaults to 10 seconds
+	Timeout          string        `yaml:"timeout,omitempty"`
+	IntervalDuration time.Duration `yaml:"-"`
+	TimeoutDuration  time.Duration `yaml:"-"`
+	RetryCount       int           `yaml:"-"`
+}
+
+// DisplayName returns name of check, or its type and target if name is not set
+func (c *Check) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Type + " " + c.Target
+}
+
+// validates checks and sets defaults
+func postLoadChecks(checks []Check) error {
+	for i := range checks {
+		if err := checks[i].postLoad(); err != nil {
+			return fmt.Errorf("check %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (c *Check) postLoad() error {
+	if c.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	switch c.Type {
+	case CheckTCP, CheckDNS:
+	case CheckHTTP:
+		if c.Status == 0 {
+			c.Status = 200
+		}
+		if _, err := regexp.Compile(c.Body); err != nil {
+			return fmt.Errorf("invalid body pattern: %w", err)
+		}
+	case CheckSSH:
+		if c.Command == "" {
+			return fmt.Errorf("command is required for ssh check")
+		}
+	default:
+		return fmt.Errorf("unknown check type '%s', expected one of tcp, http, dns, ssh", c.Type)
+	}
+	c.RetryCount = DefaultCheckRetries
+	if c.Retries != nil {
+		if *c.Retries < 0 {
+			return fmt.Errorf("retries can not be negative")
+		}
+		c.RetryCount = *c.Retries
+	}
+	var err error
+	c.IntervalDuration, err = parsePositiveDuration(c.Interval, DefaultCheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid interval: %w", err)
+	}
+	c.TimeoutDuration, err = parsePositiveDuration(c.Timeout, DefaultCheckTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+	return nil
+}
+
+// parses duration, returning default value if it is not set
+func parsePositiveDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("'%s' must be positive", value)
+	}
+	return duration, nil
+}
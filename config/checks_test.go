@@ -0,0 +1,53 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestChecksPostLoadSetsDefaults(t *testing.T) {
+	var checks []Check
+	err := yaml.Unmarshal([]byte(`
+- type: http
+  target: "https://[[ .Outputs.server_ip ]]/health"
+  body: healthy
+- name: ssh port
+  type: tcp
+  target: "[[ .Outputs.server_ip ]]:22"
+  retries: 0
+  interval: 500ms
+  timeout: 3s
+`), &checks)
+	assert.NoError(t, err)
+	assert.NoError(t, postLoadChecks(checks))
+	assert.Equal(t, 200, checks[0].Status)
+	assert.Equal(t, DefaultCheckRetries, checks[0].RetryCount)
+	assert.Equal(t, DefaultCheckInterval, checks[0].IntervalDuration)
+	assert.Equal(t, DefaultCheckTimeout, checks[0].TimeoutDuration)
+	assert.Equal(t, "http https://[[ .Outputs.server_ip ]]/health", checks[0].DisplayName())
+	assert.Equal(t, 0, checks[1].RetryCount)
+	assert.Equal(t, 500*time.Millisecond, checks[1].IntervalDuration)
+	assert.Equal(t, 3*time.Second, checks[1].TimeoutDuration)
+	assert.Equal(t, "ssh port", checks[1].DisplayName())
+}
+
+func TestChecksPostLoadInvalid(t *testing.T) {
+	negative := -1
+	for _, check := range []Check{
+		{Type: "ping", Target: "10.0.0.5"},
+		{Type: CheckTCP},
+		{Type: CheckSSH, Target: "web"},
+		{Type: CheckHTTP, Target: "http://web", Body: "("},
+		{Type: CheckTCP, Target: "web:22", Retries: &negative},
+		{Type: CheckTCP, Target: "web:22", Interval: "soon"},
+		{Type: CheckTCP, Target: "web:22", Timeout: "0s"},
+	} {
+		assert.Error(t, postLoadChecks([]Check{check}), "%v", check)
+	}
+}
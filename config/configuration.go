@@ -4,11 +4,14 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/bitshifted/liftoff/log"
+	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
 )
 
@@ -24,49 +27,86 @@ type Configuration struct {
 	Ansible        *AnsibleConfig    `yaml:"ansible,omitempty"`
 	Variables      ConfigVariables   `yaml:"variables"`
 	Tags           map[string]string `yaml:"tags"`
-	ProcessingVars map[string]interface{}
-	TemplateConfig *TemplateConfig
+	// Stacks applied in dependency order. If set, top level template and Terraform settings are defaults for stacks
+	Stacks []Stack `yaml:"stacks,omitempty"`
+	// Time after which provisioned infrastructure is considered expired, like "3h" or "7d"
+	TTL         string        `yaml:"ttl,omitempty"`
+	TTLDuration time.Duration `yaml:"-"`
+	// Files with variables merged into configuration variables, relative to configuration file
+	VariablesFiles []string `yaml:"variables-files,omitempty"`
+	// Commands run before and after execution phases, run in directory of configuration file
+	Hooks Hooks `yaml:"hooks,omitempty"`
+	// Health checks run after infrastructure is configured
+	Checks []Check `yaml:"checks,omitempty"`
+	// Retry policies of steps, keyed by step name: "terraform", "ansible" or "destroy"
+	Retry RetryPolicies `yaml:"retry,omitempty"`
+	// Files included from template directory, merged when template is available
+	TemplateIncludes []string               `yaml:"-"`
+	ProcessingVars   map[string]interface{} `yaml:"-"`
+	// Values of Terraform outputs, available in templates as .Outputs. Set after Terraform is applied
+	Outputs map[string]interface{} `yaml:"-"`
+	// Names of Terraform outputs marked as sensitive
+	SensitiveOutputs []string        `yaml:"-"`
+	TemplateConfig   *TemplateConfig `yaml:"-"`
+	// variables before secrets were resolved, used for masking
+	rawVars map[string]interface{}
+	// variables with secrets resolved, before references were interpolated
+	unresolvedVars map[string]interface{}
+	// directory containing configuration file
+	configDir string
+	// name of the stack, for configuration of single stack
+	stackName string
+	// variables set on command line
+	overrideVars map[string]interface{}
 }
 
 type TemplateConfig struct {
 	TerraformExtraDir string `yaml:"terraform-extra-dir,omitempty"`
 	AnsibleRolesDir   string `yaml:"ansible-roles-dir,omitempty"`
+	// Playbook run before infrastructure is destroyed, relative to Ansible directory
+	PreDestroyPlaybook string `yaml:"pre-destroy-playbook,omitempty"`
+	// Commands run before and after execution phases, run in template directory. Template hooks run
+	// before hooks from configuration
+	Hooks Hooks `yaml:"hooks,omitempty"`
+	// Health checks run after infrastructure is configured, before checks from configuration
+	Checks []Check `yaml:"checks,omitempty"`
+	// Write variables to liftoff.auto.tfvars.json and declare them in liftoff_variables.tf, so that
+	// Terraform templates can use them as var.<name>
+	TerraformVariables bool `yaml:"terraform-variables,omitempty"`
 }
 
 func LoadConfig(configPath string) (*Configuration, error) {
-	var config Configuration
-	bytes, err := os.ReadFile(configPath)
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to load configuration file")
-		return nil, err
-	}
-	err = yaml.Unmarshal(bytes, &config)
-	if err != nil {
-		log.Logger.Error().Err(err).Msgf("Failed to parse configuration file %s", configPath)
-		return nil, err
-	}
-	err = config.postLoad()
-	if err != nil {
-		return nil, err
-	}
-	return &config, nil
+	return LoadConfigWithOverrides(configPath, Overrides{})
 }
 
-func LoadTemplateConfig(templateDir string) (*TemplateConfig, error) {
+// LoadTemplateConfig loads template configuration from template directory. Returns nil if template does not
+// have configuration file. Messages are logged to given logger, or discarded if it is nil
+func LoadTemplateConfig(templateDir string, logger *zerolog.Logger) (*TemplateConfig, error) {
+	logger = log.OrNop(logger)
 	tmplConfigPath := path.Join(templateDir, templateConfigFileName)
 	if _, err := os.Stat(tmplConfigPath); os.IsNotExist(err) {
-		log.Logger.Info().Msgf("Template config file does not exist: %s", tmplConfigPath)
+		logger.Info().Msgf("Template config file does not exist: %s", tmplConfigPath)
 		return nil, nil
 	}
 	bytes, err := os.ReadFile(tmplConfigPath)
 	if err != nil {
-		log.Logger.Error().Err(err).Msgf("Failed to read template config file %s", tmplConfigPath)
+		logger.Error().Err(err).Msgf("Failed to read template config file %s", tmplConfigPath)
 		return nil, err
 	}
 	var tmplConfig TemplateConfig
 	err = yaml.Unmarshal(bytes, &tmplConfig)
 	if err != nil {
-		log.Logger.Error().Err(err).Msgf("Failed to parse template config file %s", tmplConfigPath)
+		logger.Error().Err(err).Msgf("Failed to parse template config file %s", tmplConfigPath)
+		return nil, err
+	}
+	err = tmplConfig.Hooks.postLoad()
+	if err != nil {
+		logger.Error().Err(err).Msgf("Invalid hooks in template config file %s", tmplConfigPath)
+		return nil, err
+	}
+	err = postLoadChecks(tmplConfig.Checks)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Invalid checks in template config file %s", tmplConfigPath)
 		return nil, err
 	}
 	// convert paths to absolute paths
@@ -82,10 +122,34 @@ func LoadTemplateConfig(templateDir string) (*TemplateConfig, error) {
 }
 
 func (c *Configuration) postLoad() error {
-	c.ProcessingVars = c.Variables.forEnvironment()
-	err := processVariables(c.ProcessingVars)
+	if c.TTL != "" {
+		ttl, err := ParseTTL(c.TTL)
+		if err != nil {
+			return err
+		}
+		c.TTLDuration = ttl
+	}
+	if err := c.Hooks.postLoad(); err != nil {
+		return err
+	}
+	if err := postLoadChecks(c.Checks); err != nil {
+		return err
+	}
+	if err := c.Retry.postLoad(); err != nil {
+		return err
+	}
+	if err := c.Ansible.postLoad(); err != nil {
+		return err
+	}
+	err := c.mergeVariables()
 	if err != nil {
 		return err
 	}
+	if c.HasStacks() {
+		return c.postLoadStacks()
+	}
+	if c.Terraform == nil {
+		return errors.New("terraform configuration is required")
+	}
 	return c.Terraform.postLoad()
 }
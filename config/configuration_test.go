@@ -75,7 +75,7 @@ func TestShouldErrorForInvalidBackendType(t *testing.T) {
 }
 
 func TestShouldReturnNilWhenNoTemplateConfig(t *testing.T) {
-	config, err := LoadTemplateConfig("./test_files")
+	config, err := LoadTemplateConfig("./test_files", nil)
 	assert.NoError(t, err)
 	assert.Nil(t, config)
 }
@@ -83,7 +83,7 @@ func TestShouldReturnNilWhenNoTemplateConfig(t *testing.T) {
 func TestShouldReturnAbsolutePathForTemplateRelativePaths(t *testing.T) {
 	absPath, err := filepath.Abs("./test_files/tmpl-test-dir")
 	assert.NoError(t, err)
-	config, err := LoadTemplateConfig(absPath)
+	config, err := LoadTemplateConfig(absPath, nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, config)
 	assert.Equal(t, path.Join(absPath, "tf-extra-dir"), config.TerraformExtraDir)
@@ -93,7 +93,7 @@ func TestShouldReturnAbsolutePathForTemplateRelativePaths(t *testing.T) {
 func TestShouldReturnSameForAbsolutePath(t *testing.T) {
 	absPath, err := filepath.Abs("./test_files/abs-tmpl-dir")
 	assert.NoError(t, err)
-	config, err := LoadTemplateConfig(absPath)
+	config, err := LoadTemplateConfig(absPath, nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, config)
 	assert.Equal(t, "/tmp/terraform", config.TerraformExtraDir)
@@ -0,0 +1,115 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bitshifted/liftoff/common"
+)
+
+// ResolveCredentials resolves credentials aliased in configuration and checks that credentials of given
+// providers are available. Returns aliased credentials as environment variables in "key=value" format,
+// and descriptions of all missing credentials
+func (t *Terraform) ResolveCredentials(providers []Provider) ([]string, []string) {
+	names := make([]string, 0, len(t.Credentials))
+	for envVar := range t.Credentials {
+		names = append(names, envVar)
+	}
+	sort.Strings(names)
+	var env, missing []string
+	for _, envVar := range names {
+		value, err := common.ProcessStringValue(t.Credentials[envVar])
+		if err != nil || value == "" {
+			missing = append(missing, fmt.Sprintf("%s is set from %s, which is not available", envVar, t.Credentials[envVar]))
+			continue
+		}
+		env = append(env, envVar+"="+value)
+	}
+	for _, provider := range providers {
+		required := CredentialSource{EnvVars: provider.EnvVars, CredentialFiles: provider.CredentialFiles}
+		for _, problem := range t.missingCredentials(required) {
+			missing = append(missing, provider.Name+": "+problem)
+		}
+		if len(provider.CredentialSources) > 0 && !t.anyCredentialSource(provider.CredentialSources) {
+			alternatives := make([]string, 0, len(provider.CredentialSources))
+			for _, source := range provider.CredentialSources {
+				alternatives = append(alternatives, source.describe())
+			}
+			missing = append(missing, fmt.Sprintf("%s: no credentials found, provide one of: %s", provider.Name,
+				strings.Join(alternatives, "; ")))
+		}
+	}
+	return env, missing
+}
+
+// returns descriptions of environment variables and files of credential source which are not available
+func (t *Terraform) missingCredentials(source CredentialSource) []string {
+	var missing []string
+	for _, envVar := range source.EnvVars {
+		if _, aliased := t.Credentials[envVar]; !aliased && os.Getenv(envVar) == "" {
+			missing = append(missing, fmt.Sprintf("environment variable %s is not set", envVar))
+		}
+	}
+	for _, file := range source.CredentialFiles {
+		filePath := expandHome(file)
+		if _, err := os.Stat(filePath); err != nil {
+			missing = append(missing, fmt.Sprintf("credentials file %s does not exist", filePath))
+		}
+	}
+	return missing
+}
+
+// returns true if any of credential sources is completely available
+func (t *Terraform) anyCredentialSource(sources []CredentialSource) bool {
+	for _, source := range sources {
+		if len(t.missingCredentials(source)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// describes credential source, like "environment variables A, B and credentials file F"
+func (s CredentialSource) describe() string {
+	var parts []string
+	switch len(s.EnvVars) {
+	case 0:
+	case 1:
+		parts = append(parts, "environment variable "+s.EnvVars[0])
+	default:
+		parts = append(parts, "environment variables "+strings.Join(s.EnvVars, ", "))
+	}
+	switch len(s.CredentialFiles) {
+	case 0:
+	case 1:
+		parts = append(parts, "credentials file "+s.CredentialFiles[0])
+	default:
+		parts = append(parts, "credentials files "+strings.Join(s.CredentialFiles, ", "))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// KnownProviders returns configured providers found in registry. Unknown providers are skipped
+func (t *Terraform) KnownProviders(registry *ProviderRegistry) []Provider {
+	var providers []Provider
+	for _, name := range t.Providers {
+		if provider, ok := registry.Lookup(name); ok {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+func expandHome(filePath string) string {
+	if strings.HasPrefix(filePath, "~") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return homeDir + filePath[1:]
+		}
+	}
+	return filePath
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// points of execution at which hooks are run
+const (
+	HookPreRender     = "pre-render"
+	HookPostRender    = "post-render"
+	HookPreTerraform  = "pre-terraform"
+	HookPostTerraform = "post-terraform"
+	HookPreAnsible    = "pre-ansible"
+	HookPostAnsible   = "post-ansible"
+	HookPreDestroy    = "pre-destroy"
+	HookPostDestroy   = "post-destroy"
+	// run when setup or teardown fails
+	HookOnFailure = "on-failure"
+)
+
+// what happens when hook fails
+const (
+	// execution stops with error
+	HookFailurePolicyFail = "fail"
+	// warning is logged and execution continues
+	HookFailurePolicyContinue = "continue"
+)
+
+// DefaultHookTimeout is maximum time hook can run if timeout is not configured
+const DefaultHookTimeout = 10 * time.Minute
+
+var hookPoints = []string{
+	HookPreRender, HookPostRender, HookPreTerraform, HookPostTerraform, HookPreAnsible, HookPostAnsible,
+	HookPreDestroy, HookPostDestroy, HookOnFailure,
+}
+
+// Hooks maps points of execution to commands run at them, in order
+type Hooks map[string][]Hook
+
+// Hook is user-defined command run before or after execution phase
+type Hook struct {
+	// Name shown in logs. Defaults to command
+	Name string `yaml:"name,omitempty"`
+	// Command run with "sh -c"
+	Command string `yaml:"command"`
+	// Maximum time hook can run, like "30s". Defaults to 10 minutes
+	Timeout         string        `yaml:"timeout,omitempty"`
+	TimeoutDuration time.Duration `yaml:"-"`
+	// Either "fail" (default) to stop execution when hook fails, or "continue" to only log warning
+	FailurePolicy string `yaml:"failure-policy,omitempty"`
+}
+
+// DisplayName returns name of hook, or its command if name is not set
+func (h *Hook) DisplayName() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Command
+}
+
+// checks hook points and commands, and sets defaults
+func (h Hooks) postLoad() error {
+	points := make([]string, 0, len(h))
+	for point := range h {
+		points = append(points, point)
+	}
+	sort.Strings(points)
+	for _, point := range points {
+		if !slices.Contains(hookPoints, point) {
+			return fmt.Errorf("unknown hook '%s', expected one of %v", point, hookPoints)
+		}
+		for i := range h[point] {
+			if err := h[point][i].postLoad(); err != nil {
+				return fmt.Errorf("hook %s: %w", point, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Hook) postLoad() error {
+	if h.Command == "" {
+		return fmt.Errorf("command is required")
+	}
+	h.TimeoutDuration = DefaultHookTimeout
+	if h.Timeout != "" {
+		timeout, err := time.ParseDuration(h.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout '%s': %w", h.Timeout, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout '%s': must be positive", h.Timeout)
+		}
+		h.TimeoutDuration = timeout
+	}
+	switch h.FailurePolicy {
+	case "":
+		h.FailurePolicy = HookFailurePolicyFail
+	case HookFailurePolicyFail, HookFailurePolicyContinue:
+	default:
+		return fmt.Errorf("invalid failure policy '%s', expected '%s' or '%s'", h.FailurePolicy,
+			HookFailurePolicyFail, HookFailurePolicyContinue)
+	}
+	return nil
+}
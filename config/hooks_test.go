@@ -0,0 +1,45 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestHooksPostLoadSetsDefaults(t *testing.T) {
+	var hooks Hooks
+	err := yaml.Unmarshal([]byte(`
+pre-terraform:
+  - command: ./wait-for-dns.sh
+    timeout: 30s
+post-ansible:
+  - name: notify
+    command: curl -X POST https://hooks.example.com
+    failure-policy: continue
+`), &hooks)
+	assert.NoError(t, err)
+	assert.NoError(t, hooks.postLoad())
+	assert.Equal(t, 30*time.Second, hooks[HookPreTerraform][0].TimeoutDuration)
+	assert.Equal(t, HookFailurePolicyFail, hooks[HookPreTerraform][0].FailurePolicy)
+	assert.Equal(t, "./wait-for-dns.sh", hooks[HookPreTerraform][0].DisplayName())
+	assert.Equal(t, DefaultHookTimeout, hooks[HookPostAnsible][0].TimeoutDuration)
+	assert.Equal(t, HookFailurePolicyContinue, hooks[HookPostAnsible][0].FailurePolicy)
+	assert.Equal(t, "notify", hooks[HookPostAnsible][0].DisplayName())
+}
+
+func TestHooksPostLoadInvalid(t *testing.T) {
+	for _, hooks := range []Hooks{
+		{"pre-plan": {{Command: "true"}}},
+		{HookPreRender: {{}}},
+		{HookPreRender: {{Command: "true", Timeout: "soon"}}},
+		{HookPreRender: {{Command: "true", Timeout: "-1s"}}},
+		{HookPreRender: {{Command: "true", FailurePolicy: "retry"}}},
+	} {
+		assert.Error(t, hooks.postLoad(), "%v", hooks)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// prefix of included files located in template directory
+	templateIncludePrefix = "template:"
+	includeKey            = "include"
+	variablesFilesKey     = "variables-files"
+)
+
+// loads configuration file merged with files it includes. Included files are merged in order, and
+// including file is merged last, so its values take precedence. Includes from template directory are
+// returned separately, since template is not available when configuration is loaded
+func loadDocument(configPath string, visiting map[string]bool) (map[string]interface{}, []string, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if visiting[absPath] {
+		return nil, nil, fmt.Errorf("configuration file %s is included recursively", absPath)
+	}
+	visiting[absPath] = true
+	defer delete(visiting, absPath)
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := map[string]interface{}{}
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse configuration file %s: %w", absPath, err)
+	}
+	baseDir := filepath.Dir(absPath)
+	// variables files are relative to the file which declares them
+	if files, ok := doc[variablesFilesKey].([]interface{}); ok {
+		for i, file := range files {
+			if name, ok := file.(string); ok {
+				files[i] = resolvePath(baseDir, name)
+			}
+		}
+	}
+	includes, err := stringList(doc[includeKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid include in %s: %w", absPath, err)
+	}
+	delete(doc, includeKey)
+
+	merged := map[string]interface{}{}
+	var templateIncludes []string
+	for _, include := range includes {
+		if tmplPath, found := strings.CutPrefix(include, templateIncludePrefix); found {
+			templateIncludes = append(templateIncludes, tmplPath)
+			continue
+		}
+		included, tmplIncludes, err := loadDocument(resolvePath(baseDir, include), visiting)
+		if err != nil {
+			return nil, nil, err
+		}
+		merged = deepMerge(merged, included)
+		templateIncludes = append(templateIncludes, tmplIncludes...)
+	}
+	return deepMerge(merged, doc), templateIncludes, nil
+}
+
+// ApplyTemplateIncludes merges variables and tags from files included from template directory.
+// Values already set in configuration take precedence. Secrets in included variables are resolved and
+// references are interpolated, same as in configuration file
+func (c *Configuration) ApplyTemplateIncludes(templateDir string) error {
+	for _, include := range c.TemplateIncludes {
+		doc, _, err := loadDocument(filepath.Join(templateDir, include), map[string]bool{})
+		if err != nil {
+			return err
+		}
+		var included Configuration
+		if err = decodeDocument(doc, &included); err != nil {
+			return fmt.Errorf("invalid template include %s: %w", include, err)
+		}
+		// tags may be shared with other stacks, so they are copied
+		tags := make(map[string]string, len(included.Tags)+len(c.Tags))
+		for k, v := range included.Tags {
+			tags[k] = v
+		}
+		for k, v := range c.Tags {
+			tags[k] = v
+		}
+		c.Tags = tags
+		raw := copyMap(included.Variables.forEnvironment())
+		vars := copyMap(raw)
+		if err = processVariables(vars); err != nil {
+			return err
+		}
+		err = interpolateWith(vars, raw, c.ProcessingVars, c.Tags, builtinValues(c.configDir, c.stackName))
+		if err != nil {
+			return fmt.Errorf("template include %s: %w", include, err)
+		}
+		c.ProcessingVars = deepMerge(vars, c.ProcessingVars)
+		// raw values are used to find variables which hold secrets
+		c.rawVars = deepMerge(raw, c.rawVars)
+	}
+	return nil
+}
+
+// decodes merged YAML document into configuration structure
+func decodeDocument(doc map[string]interface{}, out interface{}) error {
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
+
+// returns copy of dst with values from src added. Maps are merged recursively, other values from src
+// replace values in dst
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		result[k] = v
+	}
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := result[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			result[k] = deepMerge(dstMap, srcMap)
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// returns deep copy of variables map, so that processing does not modify original
+func copyMap(src map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		result[k] = copyValue(v)
+	}
+	return result
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyMap(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = copyValue(item)
+		}
+		return list
+	}
+	return value
+}
+
+func stringList(value interface{}) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected list of file names")
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		name, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected file name, got %v", item)
+		}
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// resolves path relative to base directory. Paths starting with ~ are relative to home directory
+func resolvePath(baseDir, name string) string {
+	if strings.HasPrefix(name, "~") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, name[1:])
+		}
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(baseDir, name)
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigWithIncludes(t *testing.T) {
+	t.Setenv("INCLUDE_DB_PASSWORD", "secret-password")
+	t.Setenv("INCLUDE_API_URL", "https://api.example.com")
+	conf, err := LoadConfig("./test_files/include/main.yaml")
+	assert.NoError(t, err)
+	assert.NotNil(t, conf.Terraform)
+	assert.Equal(t, Local, conf.Terraform.Backend.Type)
+	assert.Equal(t, []string{"shared.yaml"}, conf.TemplateIncludes)
+	assert.Equal(t, map[string]string{"owner": "base", "env": "test"}, conf.Tags)
+
+	vars := conf.ProcessingVars
+	// included file is overridden by including file
+	assert.Equal(t, "cx22", vars["server_type"])
+	// variables files override configuration file
+	assert.Equal(t, "nbg1", vars["region"])
+	assert.Equal(t, true, vars["monitoring"])
+	assert.Equal(t, map[string]interface{}{
+		"image":  "ubuntu-24.04",
+		"count":  3,
+		"labels": []interface{}{"web", "app"},
+	}, vars["server"])
+	assert.Equal(t, "secret-password", vars["db_password"])
+}
+
+func TestApplyTemplateIncludes(t *testing.T) {
+	t.Setenv("INCLUDE_DB_PASSWORD", "secret-password")
+	t.Setenv("INCLUDE_API_URL", "https://api.example.com")
+	t.Setenv("INCLUDE_METRICS_ENDPOINT", "https://${var.region}.example.com")
+	conf, err := LoadConfig("./test_files/include/main.yaml")
+	assert.NoError(t, err)
+	err = conf.ApplyTemplateIncludes("./test_files/include/template")
+	assert.NoError(t, err)
+	// template values do not override configuration
+	assert.Equal(t, "nbg1", conf.ProcessingVars["region"])
+	assert.Equal(t, 22, conf.ProcessingVars["ssh_port"])
+	assert.Equal(t, "base", conf.Tags["owner"])
+	assert.Equal(t, "liftoff", conf.Tags["managed-by"])
+	// references in included variables are resolved against configuration
+	assert.Equal(t, "cx22-test", conf.ProcessingVars["server_label"])
+	server := conf.ProcessingVars["server"].(map[string]interface{})
+	assert.Equal(t, "nbg1", server["location"])
+	assert.Equal(t, 3, server["count"])
+	// secrets are used as they are and marked as sensitive
+	assert.Equal(t, "https://${var.region}.example.com", conf.ProcessingVars["metrics_endpoint"])
+	assert.Contains(t, conf.SensitiveVariables(), "metrics_endpoint")
+}
+
+func TestApplyTemplateIncludesToStack(t *testing.T) {
+	conf, err := LoadConfig("./test_files/stacks-config.yaml")
+	assert.NoError(t, err)
+	stackConf, err := conf.StackConfig("app")
+	assert.NoError(t, err)
+	stackConf.TemplateIncludes = []string{"stack.yaml"}
+	err = stackConf.ApplyTemplateIncludes("./test_files/include/template")
+	assert.NoError(t, err)
+	assert.Equal(t, "app-nbg1", stackConf.ProcessingVars["stack_label"])
+}
+
+func TestIncludeCycleShouldFail(t *testing.T) {
+	_, err := LoadConfig("./test_files/include/cycle-a.yaml")
+	assert.ErrorContains(t, err, "included recursively")
+}
+
+func TestDeepMerge(t *testing.T) {
+	dst := map[string]interface{}{
+		"a": 1,
+		"nested": map[string]interface{}{
+			"x": "dst",
+			"y": "dst",
+		},
+		"list": []interface{}{1, 2},
+	}
+	src := map[string]interface{}{
+		"b": 2,
+		"nested": map[string]interface{}{
+			"y": "src",
+		},
+		"list": []interface{}{3},
+	}
+	merged := deepMerge(dst, src)
+	assert.Equal(t, map[string]interface{}{
+		"a":    1,
+		"b":    2,
+		"list": []interface{}{3},
+		"nested": map[string]interface{}{
+			"x": "dst",
+			"y": "src",
+		},
+	}, merged)
+	// inputs are not modified
+	assert.Equal(t, "dst", dst["nested"].(map[string]interface{})["y"])
+}
@@ -0,0 +1,302 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// namespaces of references in variable values, like ${var.server_name}
+	namespaceVar     = "var"
+	namespaceTags    = "tags"
+	namespaceBuiltin = "liftoff"
+	// limit for following references when checking for secrets
+	maxReferenceDepth = 32
+)
+
+// matches ${...} references. References prefixed with another $ are escaped
+var referencePattern = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// resolves references to other variables, tags and built-in values in string values of variables
+type interpolator struct {
+	vars map[string]interface{}
+	// variables before secrets were resolved, used to find values read from environment or files
+	raw       map[string]interface{}
+	tags      map[string]string
+	builtins  map[string]string
+	resolved  map[string]interface{}
+	resolving []string
+	// variables which are already interpolated, used as they are
+	done map[string]interface{}
+}
+
+// builtinValues returns built-in values which can be referenced as ${liftoff.<name>}
+func builtinValues(configDir, stack string) map[string]string {
+	values := map[string]string{
+		"environment": envDefault,
+		"config_dir":  configDir,
+		"user":        os.Getenv("USER"),
+	}
+	if current, err := user.Current(); err == nil {
+		values["user"] = current.Username
+	}
+	if stack != "" {
+		values["stack"] = stack
+	}
+	return values
+}
+
+// interpolateVariables replaces references in variable values. Reference which is the whole value keeps type
+// of referenced value, otherwise referenced value is converted to string. Values read from environment or files
+// are used as they are, since secrets may contain text which looks like a reference
+func interpolateVariables(vars, raw map[string]interface{}, tags map[string]string, builtins map[string]string) error {
+	return interpolateWith(vars, raw, nil, tags, builtins)
+}
+
+// same as interpolateVariables, but references to variables in done, which are already interpolated, resolve
+// to their values as they are. Variables in done take precedence over vars
+func interpolateWith(vars, raw, done map[string]interface{}, tags map[string]string, builtins map[string]string) error {
+	in := &interpolator{
+		vars:     deepMerge(vars, done),
+		raw:      raw,
+		tags:     tags,
+		builtins: builtins,
+		resolved: map[string]interface{}{},
+		done:     done,
+	}
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	// sorted, so that errors are reported consistently
+	sort.Strings(keys)
+	results := make(map[string]interface{}, len(vars))
+	for _, key := range keys {
+		var value interface{}
+		var err error
+		if _, ok := done[key]; ok {
+			// value is merged with already interpolated one, so only its own references are resolved
+			rawValue, _ := lookupPath(raw, key)
+			value, err = in.value(vars[key], rawValue)
+		} else {
+			value, err = in.variable(key)
+		}
+		if err != nil {
+			return fmt.Errorf("variable '%s': %w", key, err)
+		}
+		results[key] = value
+	}
+	for key, value := range results {
+		vars[key] = value
+	}
+	return nil
+}
+
+// returns resolved value of variable with dotted path
+func (in *interpolator) variable(path string) (interface{}, error) {
+	if value, ok := in.resolved[path]; ok {
+		return value, nil
+	}
+	if value, ok := lookupPath(in.done, path); ok {
+		return value, nil
+	}
+	for i, name := range in.resolving {
+		if name == path {
+			cycle := append(append([]string{}, in.resolving[i:]...), path)
+			return nil, fmt.Errorf("reference cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	current, ok := lookupPath(in.vars, path)
+	if !ok {
+		return nil, fmt.Errorf("unknown variable '%s'", path)
+	}
+	raw, _ := lookupPath(in.raw, path)
+	in.resolving = append(in.resolving, path)
+	value, err := in.value(current, raw)
+	in.resolving = in.resolving[:len(in.resolving)-1]
+	if err != nil {
+		return nil, err
+	}
+	in.resolved[path] = value
+	return value, nil
+}
+
+// returns value with references resolved. Raw value is corresponding value before secrets were resolved
+func (in *interpolator) value(value, raw interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if rawString, ok := raw.(string); ok && isSecretReference(rawString) {
+			return v, nil
+		}
+		return in.interpolate(v)
+	case []interface{}:
+		rawList, _ := raw.([]interface{})
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			var rawItem interface{}
+			if i < len(rawList) {
+				rawItem = rawList[i]
+			}
+			resolved, err := in.value(item, rawItem)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	case map[string]interface{}:
+		rawMap, _ := raw.(map[string]interface{})
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved, err := in.value(item, rawMap[key])
+			if err != nil {
+				return nil, err
+			}
+			result[key] = resolved
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+func (in *interpolator) interpolate(s string) (interface{}, error) {
+	matches := referencePattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+	// whole value is a single reference
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) && !strings.HasPrefix(s, "$$") {
+		if value, ok, err := in.reference(s[matches[0][2]:matches[0][3]]); ok || err != nil {
+			return value, err
+		}
+	}
+	var sb strings.Builder
+	last := 0
+	for _, match := range matches {
+		sb.WriteString(s[last:match[0]])
+		last = match[1]
+		text := s[match[0]:match[1]]
+		if strings.HasPrefix(text, "$$") {
+			sb.WriteString(text[1:])
+			continue
+		}
+		value, ok, err := in.reference(s[match[2]:match[3]])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			sb.WriteString(text)
+			continue
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("reference '%s' can not be embedded in string, because it is not a simple value", text)
+		case nil:
+		default:
+			sb.WriteString(fmt.Sprint(value))
+		}
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), nil
+}
+
+// returns value of reference. References outside of known namespaces are not resolved, since they may
+// be meant for Terraform or Ansible
+func (in *interpolator) reference(ref string) (interface{}, bool, error) {
+	namespace, name, _ := strings.Cut(strings.TrimSpace(ref), ".")
+	switch namespace {
+	case namespaceVar:
+		value, err := in.variable(name)
+		return value, true, err
+	case namespaceTags:
+		value, ok := in.tags[name]
+		if !ok {
+			return nil, true, fmt.Errorf("unknown tag '%s'", name)
+		}
+		return value, true, nil
+	case namespaceBuiltin:
+		value, ok := in.builtins[name]
+		if !ok {
+			return nil, true, fmt.Errorf("unknown built-in value '%s'", name)
+		}
+		return value, true, nil
+	}
+	return nil, false, nil
+}
+
+// returns value at dotted path in nested maps
+func lookupPath(vars map[string]interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return nil, false
+	}
+	if value, ok := vars[path]; ok {
+		return value, true
+	}
+	current := vars
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		value, ok := current[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return value, true
+		}
+		if current, ok = value.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// returns true if string references a secret variable
+func referencesSecret(s string, raw map[string]interface{}, depth int) bool {
+	if depth > maxReferenceDepth {
+		return false
+	}
+	for _, match := range referencePattern.FindAllStringSubmatch(s, -1) {
+		if strings.HasPrefix(match[0], "$$") {
+			continue
+		}
+		namespace, name, _ := strings.Cut(strings.TrimSpace(match[1]), ".")
+		if namespace != namespaceVar {
+			continue
+		}
+		if secretNamePattern.MatchString(name) {
+			return true
+		}
+		value, _ := lookupPath(raw, name)
+		if isSecret(value, raw, depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true if raw value is read from environment or file, or references such value
+func isSecret(value interface{}, raw map[string]interface{}, depth int) bool {
+	switch v := value.(type) {
+	case string:
+		return isSecretReference(v) || referencesSecret(v, raw, depth)
+	case []interface{}:
+		for _, item := range v {
+			if isSecret(item, raw, depth) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if isSecret(item, raw, depth) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bitshifted/liftoff/common"
+	"gopkg.in/yaml.v3"
+)
+
+const maskedValue = "********"
+
+// variables whose names match this pattern are masked when configuration is printed
+var secretNamePattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|private_key|api_key|credential)`)
+
+// Overrides contains variables set on command line. They take precedence over variables from configuration
+// file and variables files
+type Overrides struct {
+	// Paths to variables files (YAML, JSON or .tfvars), applied in order
+	VarFiles []string
+	// Variable assignments in form key=value. Nested values are set with dotted keys, like "server.type=cx22"
+	Vars []string
+}
+
+// loads all variables files and assignments into single map
+func (o Overrides) variables() (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, file := range o.VarFiles {
+		fileVars, err := loadVariablesFile(resolvePath("", file))
+		if err != nil {
+			return nil, err
+		}
+		vars = deepMerge(vars, fileVars)
+	}
+	for _, assignment := range o.Vars {
+		if err := setVariable(vars, assignment); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+// loads variables from file. Files with .tfvars extension are parsed as Terraform variable definitions,
+// other files as YAML, which includes JSON
+func loadVariablesFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read variables file: %w", err)
+	}
+	var vars map[string]interface{}
+	if filepath.Ext(path) == ".tfvars" {
+		vars, err = parseTFVars(string(data))
+	} else {
+		err = yaml.Unmarshal(data, &vars)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse variables file %s: %w", path, err)
+	}
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	return vars, nil
+}
+
+// sets variable from assignment in form key=value. Value is parsed as YAML, so numbers, booleans and
+// lists get their natural types
+func setVariable(vars map[string]interface{}, assignment string) error {
+	key, raw, found := strings.Cut(assignment, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return fmt.Errorf("invalid variable '%s', expected key=value", assignment)
+	}
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+	if _, isMap := value.(map[string]interface{}); isMap {
+		// only dotted keys set nested values
+		value = raw
+	}
+	parts := strings.Split(key, ".")
+	current := vars
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+	return nil
+}
+
+// LoadConfigWithOverrides loads configuration file and applies command line variable overrides. Variables
+// are merged in this order, later ones taking precedence: files included from template, included files,
+// configuration file, variables files, command line variables files and command line variables
+func LoadConfigWithOverrides(configPath string, overrides Overrides) (*Configuration, error) {
+	doc, templateIncludes, err := loadDocument(configPath, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	var config Configuration
+	if err = decodeDocument(doc, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", configPath, err)
+	}
+	config.TemplateIncludes = templateIncludes
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	config.configDir = filepath.Dir(absPath)
+	vars, err := overrides.variables()
+	if err != nil {
+		return nil, err
+	}
+	config.overrideVars = vars
+	if err = config.postLoad(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// merges variables files and overrides into top level variables, resolves secrets and interpolates
+// references. With stacks, references are interpolated for each stack, since they may point to stack variables
+func (c *Configuration) mergeVariables() error {
+	vars := copyMap(c.Variables.forEnvironment())
+	for _, file := range c.VariablesFiles {
+		fileVars, err := loadVariablesFile(file)
+		if err != nil {
+			return err
+		}
+		vars = deepMerge(vars, fileVars)
+	}
+	c.ProcessingVars = deepMerge(vars, copyMap(c.overrideVars))
+	c.rawVars = copyMap(c.ProcessingVars)
+	if err := processVariables(c.ProcessingVars); err != nil {
+		return err
+	}
+	c.unresolvedVars = copyMap(c.ProcessingVars)
+	if c.HasStacks() {
+		return nil
+	}
+	return interpolateVariables(c.ProcessingVars, c.rawVars, c.Tags, builtinValues(c.configDir, ""))
+}
+
+// Resolved returns effective configuration, with variables merged from all sources. Values of secret
+// variables are masked
+func (c *Configuration) Resolved() (map[string]interface{}, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, variablesFilesKey)
+	maskCredentials(doc)
+	doc["variables"] = maskVariables(c.rawVars, c.ProcessingVars, c.rawVars)
+	if stacks, ok := doc["stacks"].([]interface{}); ok {
+		for i, stack := range stacks {
+			stackDoc, ok := stack.(map[string]interface{})
+			if !ok || i >= len(c.Stacks) {
+				continue
+			}
+			maskCredentials(stackDoc)
+			stackConf, err := c.StackConfig(c.Stacks[i].Name)
+			if err != nil {
+				return nil, err
+			}
+			// only variables declared by stack are shown, with references resolved
+			vars := make(map[string]interface{}, len(c.Stacks[i].rawVars))
+			for key := range c.Stacks[i].rawVars {
+				vars[key] = stackConf.ProcessingVars[key]
+			}
+			stackDoc["variables"] = maskVariables(c.Stacks[i].rawVars, vars, deepMerge(c.rawVars, c.Stacks[i].rawVars))
+		}
+	}
+	return doc, nil
+}
+
+// returns copy of processed variables with secrets replaced by mask. Variable is secret if its value was
+// read from environment or file, if it references such variable, or if its name looks like name of a secret.
+// References are looked up in root
+func maskVariables(raw, processed, root map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(processed))
+	for key, value := range processed {
+		rawValue := raw[key]
+		if secretNamePattern.MatchString(key) {
+			result[key] = maskedValue
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			rawMap, _ := rawValue.(map[string]interface{})
+			result[key] = maskVariables(rawMap, v, root)
+		case []interface{}:
+			rawList, _ := rawValue.([]interface{})
+			list := make([]interface{}, len(v))
+			for i, item := range v {
+				list[i] = item
+				if i < len(rawList) && isSecret(rawList[i], root, 0) {
+					list[i] = maskedValue
+				}
+			}
+			result[key] = list
+		default:
+			if isSecret(rawValue, root, 0) {
+				result[key] = maskedValue
+			} else {
+				result[key] = value
+			}
+		}
+	}
+	return result
+}
+
+// masks Terraform credentials set directly in configuration. References to environment variables and
+// files are kept, since they do not contain secrets
+func maskCredentials(doc map[string]interface{}) {
+	terraform, ok := doc["terraform"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	credentials, ok := terraform["credentials"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key, value := range credentials {
+		if s, ok := value.(string); !ok || !isSecretReference(s) {
+			credentials[key] = maskedValue
+		}
+	}
+}
+
+func isSecretReference(s string) bool {
+	valueType := common.ValueTypeFromString(s)
+	return valueType == common.EnvVariableString || valueType == common.FileContentString
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigWithOverrides(t *testing.T) {
+	t.Setenv("INCLUDE_DB_PASSWORD", "secret-password")
+	t.Setenv("INCLUDE_API_URL", "https://api.example.com")
+	conf, err := LoadConfigWithOverrides("./test_files/include/main.yaml", Overrides{
+		VarFiles: []string{"./test_files/include/override.yaml"},
+		Vars:     []string{"server_type=cx42", "server.count=5", "debug=true", "note=a=b"},
+	})
+	assert.NoError(t, err)
+	vars := conf.ProcessingVars
+	// command line variable overrides variables file
+	assert.Equal(t, "cx42", vars["server_type"])
+	assert.Equal(t, true, vars["debug"])
+	assert.Equal(t, "a=b", vars["note"])
+	assert.Equal(t, map[string]interface{}{
+		"image":  "ubuntu-24.04",
+		"count":  5,
+		"labels": []interface{}{"override"},
+	}, vars["server"])
+}
+
+func TestInvalidVariableOverride(t *testing.T) {
+	_, err := LoadConfigWithOverrides("./test_files/simple-config.yaml", Overrides{Vars: []string{"novalue"}})
+	assert.ErrorContains(t, err, "expected key=value")
+}
+
+func TestOverridesApplyToStacks(t *testing.T) {
+	conf, err := LoadConfigWithOverrides("./test_files/stacks-config.yaml", Overrides{Vars: []string{"region=hel1"}})
+	assert.NoError(t, err)
+	app, err := conf.StackConfig("app")
+	assert.NoError(t, err)
+	assert.Equal(t, "hel1", app.ProcessingVars["region"])
+}
+
+func TestResolvedConfigMasksSecrets(t *testing.T) {
+	t.Setenv("INCLUDE_DB_PASSWORD", "secret-password")
+	t.Setenv("INCLUDE_API_URL", "https://api.example.com")
+	conf, err := LoadConfigWithOverrides("./test_files/include/main.yaml", Overrides{
+		Vars: []string{"hcloud_token=abc123"},
+	})
+	assert.NoError(t, err)
+	resolved, err := conf.Resolved()
+	assert.NoError(t, err)
+	assert.NotContains(t, resolved, "variables-files")
+	assert.NotContains(t, resolved, "include")
+	vars := resolved["variables"].(map[string]interface{})
+	assert.Equal(t, maskedValue, vars["db_password"])
+	assert.Equal(t, maskedValue, vars["api_url"])
+	assert.Equal(t, maskedValue, vars["hcloud_token"])
+	assert.Equal(t, "cx22", vars["server_type"])
+	assert.Equal(t, 3, vars["server"].(map[string]interface{})["count"])
+}
+
+func TestResolvedConfigMasksCredentials(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "liftoff.yaml")
+	content := `
+terraform:
+  providers:
+    - hcloud
+  credentials:
+    HCLOUD_TOKEN: fromenv:PROD_HCLOUD_TOKEN
+    CLOUDFLARE_API_TOKEN: plain-token
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0o600))
+	conf, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	resolved, err := conf.Resolved()
+	assert.NoError(t, err)
+	credentials := resolved["terraform"].(map[string]interface{})["credentials"].(map[string]interface{})
+	assert.Equal(t, "fromenv:PROD_HCLOUD_TOKEN", credentials["HCLOUD_TOKEN"])
+	assert.Equal(t, maskedValue, credentials["CLOUDFLARE_API_TOKEN"])
+}
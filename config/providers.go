@@ -0,0 +1,154 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProvidersFileName is the name of file in template directory which declares additional providers
+const ProvidersFileName = "providers.yaml"
+
+//go:embed resources/providers.yaml
+var builtinProviders []byte
+
+// Provider describes Terraform provider which can be used in configuration
+type Provider struct {
+	// Name used in configuration and as local name in Terraform
+	Name string `yaml:"name"`
+	// Terraform source address, like "hetznercloud/hcloud"
+	Source string `yaml:"source"`
+	// Version constraint, like "~> 1.49"
+	Version string `yaml:"version,omitempty"`
+	// Environment variables with provider credentials
+	EnvVars []string `yaml:"env-vars,omitempty"`
+	// Files with provider credentials, like "~/.aws/credentials"
+	CredentialFiles []string `yaml:"credential-files,omitempty"`
+	// Alternative sources of credentials, at least one of which must be available. They are checked in addition
+	// to EnvVars and CredentialFiles, which are always required
+	CredentialSources []CredentialSource `yaml:"credential-sources,omitempty"`
+}
+
+// CredentialSource is a set of environment variables and files which together provide credentials
+type CredentialSource struct {
+	EnvVars         []string `yaml:"env-vars,omitempty"`
+	CredentialFiles []string `yaml:"credential-files,omitempty"`
+}
+
+type providersFile struct {
+	Providers []Provider `yaml:"providers"`
+}
+
+// ProviderRegistry contains providers known to liftoff and providers declared by template
+type ProviderRegistry struct {
+	providers map[string]Provider
+}
+
+// DefaultProviderRegistry returns registry with built-in providers
+func DefaultProviderRegistry() (*ProviderRegistry, error) {
+	registry := &ProviderRegistry{providers: map[string]Provider{}}
+	if err := registry.add(builtinProviders, "built-in providers"); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// LoadProviderRegistry returns registry with built-in providers and providers declared in template
+// directory. Template providers override built-in providers with the same name
+func LoadProviderRegistry(templateDir string) (*ProviderRegistry, error) {
+	registry, err := DefaultProviderRegistry()
+	if err != nil {
+		return nil, err
+	}
+	providersPath := path.Join(templateDir, ProvidersFileName)
+	data, err := os.ReadFile(providersPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = registry.add(data, providersPath); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+func (r *ProviderRegistry) add(data []byte, source string) error {
+	var file providersFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	for _, provider := range file.Providers {
+		if provider.Name == "" || provider.Source == "" {
+			return fmt.Errorf("%s: provider name and source are required", source)
+		}
+		for _, credentials := range provider.CredentialSources {
+			if len(credentials.EnvVars) == 0 && len(credentials.CredentialFiles) == 0 {
+				return fmt.Errorf("%s: credential source of provider %s is empty", source, provider.Name)
+			}
+		}
+		r.providers[provider.Name] = provider
+	}
+	return nil
+}
+
+// Lookup returns provider with given name
+func (r *ProviderRegistry) Lookup(name string) (Provider, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names returns sorted names of all providers in registry
+func (r *ProviderRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns providers with given names. All unknown providers are reported in single error
+func (r *ProviderRegistry) Resolve(names []string) ([]Provider, error) {
+	providers := make([]Provider, 0, len(names))
+	var unknown []string
+	for _, name := range names {
+		provider, ok := r.providers[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unsupported providers: %s. Known providers are %s, others can be declared in template %s",
+			strings.Join(unknown, ", "), strings.Join(r.Names(), ", "), ProvidersFileName)
+	}
+	return providers, nil
+}
+
+// RequiredProvidersBlock returns Terraform block declaring required providers
+func RequiredProvidersBlock(providers []Provider) string {
+	var sb strings.Builder
+	sb.WriteString("terraform {\n  required_providers {\n")
+	for _, provider := range providers {
+		if provider.Version != "" {
+			fmt.Fprintf(&sb, "    %s = {\n      source  = %q\n      version = %q\n", provider.Name, provider.Source, provider.Version)
+		} else {
+			fmt.Fprintf(&sb, "    %s = {\n      source = %q\n", provider.Name, provider.Source)
+		}
+		sb.WriteString("    }\n")
+	}
+	sb.WriteString("  }\n}\n")
+	return sb.String()
+}
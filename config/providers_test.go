@@ -0,0 +1,73 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultProviderRegistry(t *testing.T) {
+	registry, err := DefaultProviderRegistry()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aws", providerCloudflare, providerDigitalOcean, "google", providerHcloud,
+		providerHetznerdns, "linode"}, registry.Names())
+	hcloud, ok := registry.Lookup(providerHcloud)
+	assert.True(t, ok)
+	assert.Equal(t, "hetznercloud/hcloud", hcloud.Source)
+	assert.Equal(t, []string{"HCLOUD_TOKEN"}, hcloud.EnvVars)
+	aws, _ := registry.Lookup("aws")
+	assert.Empty(t, aws.EnvVars)
+	assert.Len(t, aws.CredentialSources, 4)
+}
+
+func TestLoadProviderRegistryWithTemplateProviders(t *testing.T) {
+	registry, err := LoadProviderRegistry("./test_files/providers")
+	assert.NoError(t, err)
+	scaleway, ok := registry.Lookup("scaleway")
+	assert.True(t, ok)
+	assert.Equal(t, "scaleway/scaleway", scaleway.Source)
+	// template overrides built-in provider
+	hcloud, _ := registry.Lookup(providerHcloud)
+	assert.Equal(t, "= 1.50.0", hcloud.Version)
+	// registry without template providers
+	registry, err = LoadProviderRegistry("./test_files")
+	assert.NoError(t, err)
+	_, ok = registry.Lookup("scaleway")
+	assert.False(t, ok)
+}
+
+func TestResolveProvidersReportsAllUnknown(t *testing.T) {
+	registry, err := DefaultProviderRegistry()
+	assert.NoError(t, err)
+	tf := Terraform{Providers: []string{providerHcloud, "vultr", "ovh"}}
+	_, err = tf.ResolveProviders(registry)
+	assert.ErrorContains(t, err, "unsupported providers: vultr, ovh")
+	tf.Providers = []string{providerHcloud, providerCloudflare}
+	providers, err := tf.ResolveProviders(registry)
+	assert.NoError(t, err)
+	assert.Len(t, providers, 2)
+	assert.Equal(t, providerCloudflare, providers[1].Name)
+}
+
+func TestRequiredProvidersBlock(t *testing.T) {
+	block := RequiredProvidersBlock([]Provider{
+		{Name: "hcloud", Source: "hetznercloud/hcloud", Version: "~> 1.49"},
+		{Name: "custom", Source: "example/custom"},
+	})
+	expected := `terraform {
+  required_providers {
+    hcloud = {
+      source  = "hetznercloud/hcloud"
+      version = "~> 1.49"
+    }
+    custom = {
+      source = "example/custom"
+    }
+  }
+}
+`
+	assert.Equal(t, expected, block)
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+)
+
+// steps for which retry policies can be configured
+const (
+	// Terraform init and apply during setup
+	RetryTerraform = "terraform"
+	// Ansible playbook. Retries are limited to hosts which failed
+	RetryAnsible = "ansible"
+	// Terraform destroy during teardown
+	RetryDestroy = "destroy"
+)
+
+// defaults for retry policies
+const (
+	DefaultRetryBackoff    = 10 * time.Second
+	DefaultRetryMaxBackoff = 5 * time.Minute
+)
+
+var retrySteps = []string{RetryTerraform, RetryAnsible, RetryDestroy}
+
+// RetryPolicies maps steps to their retry policies
+type RetryPolicies map[string]*RetryPolicy
+
+// RetryPolicy controls how failed step is retried
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one
+	MaxAttempts int `yaml:"max-attempts"`
+	// Wait before first retry, like "10s", doubled after each retry. Defaults to 10 seconds
+	Backoff string `yaml:"backoff,omitempty"`
+	// Longest wait between attempts. Defaults to 5 minutes
+	MaxBackoff string `yaml:"max-backoff,omitempty"`
+	// Regular expressions matched against output of failed attempt. If set, attempt is retried only if
+	// one of them matches
+	RetryableErrors    []string      `yaml:"retryable-errors,omitempty"`
+	BackoffDuration    time.Duration `yaml:"-"`
+	MaxBackoffDuration time.Duration `yaml:"-"`
+	retryablePatterns  []*regexp.Regexp
+}
+
+// Policy returns retry policy for step. Step is attempted once if policy is not configured
+func (r RetryPolicies) Policy(step string) RetryPolicy {
+	if policy, ok := r[step]; ok && policy != nil {
+		return *policy
+	}
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// Retryable returns true if failed attempt with given output should be retried
+func (p *RetryPolicy) Retryable(output string) bool {
+	if len(p.retryablePatterns) == 0 {
+		return true
+	}
+	for _, pattern := range p.retryablePatterns {
+		if pattern.MatchString(output) {
+			return true
+		}
+	}
+	return false
+}
+
+// validates retry policies and sets defaults
+func (r RetryPolicies) postLoad() error {
+	steps := make([]string, 0, len(r))
+	for step := range r {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		if !slices.Contains(retrySteps, step) {
+			return fmt.Errorf("unknown retry step '%s', expected one of %v", step, retrySteps)
+		}
+		if r[step] == nil {
+			r[step] = &RetryPolicy{}
+		}
+		if err := r[step].postLoad(); err != nil {
+			return fmt.Errorf("retry %s: %w", step, err)
+		}
+	}
+	return nil
+}
+
+func (p *RetryPolicy) postLoad() error {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 1
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("max-attempts can not be negative")
+	}
+	var err error
+	p.BackoffDuration, err = parsePositiveDuration(p.Backoff, DefaultRetryBackoff)
+	if err != nil {
+		return fmt.Errorf("invalid backoff: %w", err)
+	}
+	p.MaxBackoffDuration, err = parsePositiveDuration(p.MaxBackoff, DefaultRetryMaxBackoff)
+	if err != nil {
+		return fmt.Errorf("invalid max-backoff: %w", err)
+	}
+	p.retryablePatterns = nil
+	for _, expr := range p.RetryableErrors {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid retryable error pattern: %w", err)
+		}
+		p.retryablePatterns = append(p.retryablePatterns, pattern)
+	}
+	return nil
+}
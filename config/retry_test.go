@@ -0,0 +1,64 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetryPostLoadSetsDefaults(t *testing.T) {
+	var retry RetryPolicies
+	err := yaml.Unmarshal([]byte(`
+terraform:
+  max-attempts: 3
+  retryable-errors:
+    - "(?i)rate limit"
+    - "timeout while waiting"
+ansible:
+  max-attempts: 2
+  backoff: 30s
+  max-backoff: 1m
+`), &retry)
+	assert.NoError(t, err)
+	assert.NoError(t, retry.postLoad())
+
+	terraform := retry.Policy(RetryTerraform)
+	assert.Equal(t, 3, terraform.MaxAttempts)
+	assert.Equal(t, DefaultRetryBackoff, terraform.BackoffDuration)
+	assert.Equal(t, DefaultRetryMaxBackoff, terraform.MaxBackoffDuration)
+	assert.True(t, terraform.Retryable("Error: Rate Limit exceeded"))
+	assert.False(t, terraform.Retryable("Error: invalid token"))
+
+	ansible := retry.Policy(RetryAnsible)
+	assert.Equal(t, 30*time.Second, ansible.BackoffDuration)
+	assert.Equal(t, time.Minute, ansible.MaxBackoffDuration)
+	assert.True(t, ansible.Retryable("anything"))
+
+	assert.Equal(t, 1, retry.Policy(RetryDestroy).MaxAttempts)
+}
+
+func TestRetryPostLoadInvalid(t *testing.T) {
+	for _, retry := range []RetryPolicies{
+		{"plan": {MaxAttempts: 2}},
+		{RetryTerraform: {MaxAttempts: -1}},
+		{RetryTerraform: {MaxAttempts: 2, Backoff: "later"}},
+		{RetryTerraform: {MaxAttempts: 2, MaxBackoff: "-1s"}},
+		{RetryAnsible: {MaxAttempts: 2, RetryableErrors: []string{"("}}},
+	} {
+		assert.Error(t, retry.postLoad(), "%v", retry)
+	}
+}
+
+func TestAnsibleWaitForSSH(t *testing.T) {
+	ansible := &AnsibleConfig{WaitForSSH: "5m"}
+	assert.NoError(t, ansible.postLoad())
+	assert.Equal(t, 5*time.Minute, ansible.WaitForSSHDuration)
+	assert.Error(t, (&AnsibleConfig{WaitForSSH: "soon"}).postLoad())
+	var missing *AnsibleConfig
+	assert.NoError(t, missing.postLoad())
+}
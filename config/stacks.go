@@ -0,0 +1,316 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const fromStackPrefix = "fromstack:"
+
+// Stack is part of infrastructure with its own template and Terraform root module
+type Stack struct {
+	Name           string          `yaml:"name"`
+	TemplateRepo   string          `yaml:"template-repo,omitempty"`
+	TempateVersion string          `yaml:"template-version,omitempty"`
+	TemplateDir    string          `yaml:"template-dir,omitempty"`
+	Terraform      *Terraform      `yaml:"terraform,omitempty"`
+	Ansible        *AnsibleConfig  `yaml:"ansible,omitempty"`
+	Variables      ConfigVariables `yaml:"variables"`
+	DependsOn      []string        `yaml:"depends-on,omitempty"`
+	processingVars map[string]interface{}
+	rawVars        map[string]interface{}
+}
+
+// StackReference points to Terraform output of another stack, written as "fromstack:<stack>.<output>"
+type StackReference struct {
+	Stack  string
+	Output string
+}
+
+// ParseStackReference parses stack output reference. Returns false if value is not a reference
+func ParseStackReference(value string) (StackReference, bool, error) {
+	ref, found := strings.CutPrefix(value, fromStackPrefix)
+	if !found {
+		return StackReference{}, false, nil
+	}
+	stack, output, found := strings.Cut(ref, ".")
+	if !found || stack == "" || output == "" {
+		return StackReference{}, true, fmt.Errorf("invalid stack reference '%s', expected %s<stack>.<output>", value, fromStackPrefix)
+	}
+	return StackReference{Stack: stack, Output: output}, true, nil
+}
+
+// Dependencies returns names of stacks which must be applied before this one. These are stacks listed
+// in depends-on and stacks whose outputs are referenced in variables
+func (s *Stack) Dependencies() ([]string, error) {
+	deps := map[string]bool{}
+	for _, dep := range s.DependsOn {
+		deps[dep] = true
+	}
+	err := walkStrings(s.processingVars, func(value string) error {
+		ref, ok, err := ParseStackReference(value)
+		if ok && err == nil {
+			deps[ref.Stack] = true
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(deps))
+	for dep := range deps {
+		result = append(result, dep)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// HasStacks returns true if configuration consists of multiple stacks
+func (c *Configuration) HasStacks() bool {
+	return len(c.Stacks) > 0
+}
+
+// StackDependencies returns dependencies of each stack
+func (c *Configuration) StackDependencies() (map[string][]string, error) {
+	deps := make(map[string][]string, len(c.Stacks))
+	for i := range c.Stacks {
+		stackDeps, err := c.Stacks[i].Dependencies()
+		if err != nil {
+			return nil, fmt.Errorf("stack '%s': %w", c.Stacks[i].Name, err)
+		}
+		deps[c.Stacks[i].Name] = stackDeps
+	}
+	return deps, nil
+}
+
+// StackOrder returns stack names ordered so that each stack comes after all stacks it depends on.
+// Stacks without mutual dependencies keep the order in which they are declared
+func (c *Configuration) StackOrder() ([]string, error) {
+	deps, err := c.StackDependencies()
+	if err != nil {
+		return nil, err
+	}
+	for _, stack := range c.Stacks {
+		for _, dep := range deps[stack.Name] {
+			if _, ok := deps[dep]; !ok {
+				return nil, fmt.Errorf("stack '%s' depends on unknown stack '%s'", stack.Name, dep)
+			}
+			if dep == stack.Name {
+				return nil, fmt.Errorf("stack '%s' depends on itself", stack.Name)
+			}
+		}
+	}
+	order := make([]string, 0, len(c.Stacks))
+	done := map[string]bool{}
+	for len(order) < len(c.Stacks) {
+		progress := false
+		for _, stack := range c.Stacks {
+			if done[stack.Name] || !allDone(deps[stack.Name], done) {
+				continue
+			}
+			done[stack.Name] = true
+			order = append(order, stack.Name)
+			progress = true
+			// start over, so that earlier declared stacks go first
+			break
+		}
+		if !progress {
+			var cycle []string
+			for _, stack := range c.Stacks {
+				if !done[stack.Name] {
+					cycle = append(cycle, stack.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between stacks: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+func allDone(names []string, done map[string]bool) bool {
+	for _, name := range names {
+		if !done[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// StackConfig returns configuration of single stack. Template repository and version, Terraform
+// configuration, tags and TTL are inherited from top level configuration if stack does not set them.
+// Stack variables override top level variables. References in variables are interpolated for each stack
+func (c *Configuration) StackConfig(name string) (*Configuration, error) {
+	for i := range c.Stacks {
+		stack := &c.Stacks[i]
+		if stack.Name != name {
+			continue
+		}
+		conf := &Configuration{
+			TemplateRepo:     c.TemplateRepo,
+			TempateVersion:   c.TempateVersion,
+			TemplateDir:      stack.TemplateDir,
+			Terraform:        c.Terraform,
+			Ansible:          stack.Ansible,
+			Tags:             c.Tags,
+			TTL:              c.TTL,
+			TTLDuration:      c.TTLDuration,
+			Hooks:            c.Hooks,
+			Checks:           c.Checks,
+			Retry:            c.Retry,
+			ProcessingVars:   map[string]interface{}{},
+			TemplateIncludes: c.TemplateIncludes,
+			configDir:        c.configDir,
+			stackName:        name,
+		}
+		if stack.TemplateRepo != "" {
+			conf.TemplateRepo = stack.TemplateRepo
+			conf.TempateVersion = stack.TempateVersion
+		}
+		if stack.Terraform != nil {
+			conf.Terraform = stack.Terraform
+		}
+		// command line variables take precedence over stack variables, as they do when values are merged below
+		conf.rawVars = deepMerge(deepMerge(c.rawVars, stack.rawVars), c.overrideVars)
+		for k, v := range c.unresolvedVars {
+			conf.ProcessingVars[k] = v
+		}
+		for k, v := range stack.processingVars {
+			conf.ProcessingVars[k] = v
+		}
+		// command line variables are applied to all stacks
+		overrides := copyMap(c.overrideVars)
+		if err := processVariables(overrides); err != nil {
+			return nil, err
+		}
+		conf.ProcessingVars = copyMap(deepMerge(conf.ProcessingVars, overrides))
+		if err := interpolateVariables(conf.ProcessingVars, conf.rawVars, conf.Tags, builtinValues(conf.configDir, conf.stackName)); err != nil {
+			return nil, fmt.Errorf("stack '%s': %w", name, err)
+		}
+		return conf, nil
+	}
+	return nil, fmt.Errorf("unknown stack '%s'", name)
+}
+
+// ResolveStackReferences replaces references to other stacks' outputs in variables with output values
+func ResolveStackReferences(vars map[string]interface{}, outputs map[string]map[string]interface{}) error {
+	for key, val := range vars {
+		resolved, err := resolveStackValue(val, outputs)
+		if err != nil {
+			return err
+		}
+		vars[key] = resolved
+	}
+	return nil
+}
+
+func resolveStackValue(value interface{}, outputs map[string]map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		ref, ok, err := ParseStackReference(v)
+		if !ok || err != nil {
+			return v, err
+		}
+		stackOutputs, ok := outputs[ref.Stack]
+		if !ok {
+			return nil, fmt.Errorf("outputs of stack '%s' are not available", ref.Stack)
+		}
+		out, ok := stackOutputs[ref.Output]
+		if !ok {
+			return nil, fmt.Errorf("stack '%s' has no output '%s'", ref.Stack, ref.Output)
+		}
+		return out, nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			resolved, err := resolveStackValue(item, outputs)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, resolved)
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			resolved, err := resolveStackValue(item, outputs)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = resolved
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// calls fn for each string value in variables, including values nested in lists and maps
+func walkStrings(value interface{}, fn func(value string) error) error {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case []interface{}:
+		for _, item := range v {
+			if err := walkStrings(item, fn); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := walkStrings(item, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validates stacks and processes their variables
+func (c *Configuration) postLoadStacks() error {
+	names := map[string]bool{}
+	for i := range c.Stacks {
+		stack := &c.Stacks[i]
+		if stack.Name == "" {
+			return errors.New("stack name is required")
+		}
+		if names[stack.Name] {
+			return fmt.Errorf("duplicate stack name '%s'", stack.Name)
+		}
+		names[stack.Name] = true
+		if stack.TemplateDir == "" && stack.TemplateRepo == "" {
+			return fmt.Errorf("stack '%s': either template repository or template directory must be specified", stack.Name)
+		}
+		stack.processingVars = copyMap(stack.Variables.forEnvironment())
+		stack.rawVars = copyMap(stack.processingVars)
+		if err := processVariables(stack.processingVars); err != nil {
+			return err
+		}
+		if err := stack.Ansible.postLoad(); err != nil {
+			return fmt.Errorf("stack '%s': %w", stack.Name, err)
+		}
+		terraform := stack.Terraform
+		if terraform == nil {
+			terraform = c.Terraform
+		}
+		if terraform == nil {
+			return fmt.Errorf("stack '%s': Terraform configuration is required", stack.Name)
+		}
+		if err := terraform.postLoad(); err != nil {
+			return fmt.Errorf("stack '%s': %w", stack.Name, err)
+		}
+	}
+	if _, err := c.StackOrder(); err != nil {
+		return err
+	}
+	// validates references in variables of each stack
+	for _, stack := range c.Stacks {
+		if _, err := c.StackConfig(stack.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStackReference(t *testing.T) {
+	ref, ok, err := ParseStackReference("fromstack:network.vpc_id")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, StackReference{Stack: "network", Output: "vpc_id"}, ref)
+
+	_, ok, err = ParseStackReference("plain value")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, invalid := range []string{"fromstack:network", "fromstack:.vpc_id", "fromstack:network."} {
+		_, ok, err = ParseStackReference(invalid)
+		assert.True(t, ok)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoadStacksConfig(t *testing.T) {
+	conf, err := LoadConfig("./test_files/stacks-config.yaml")
+	assert.NoError(t, err)
+	assert.True(t, conf.HasStacks())
+	order, err := conf.StackOrder()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"network", "database", "app"}, order)
+	deps, err := conf.StackDependencies()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"database", "network"}, deps["app"])
+	assert.Equal(t, []string{"network"}, deps["database"])
+	assert.Empty(t, deps["network"])
+}
+
+func TestStackConfigInheritsSettings(t *testing.T) {
+	conf, err := LoadConfig("./test_files/stacks-config.yaml")
+	assert.NoError(t, err)
+
+	app, err := conf.StackConfig("app")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/templates.git", app.TemplateRepo)
+	assert.Equal(t, "v1", app.TempateVersion)
+	assert.Equal(t, "app", app.TemplateDir)
+	assert.Equal(t, []string{"hcloud"}, app.Terraform.Providers)
+	assert.Equal(t, "app.yaml", app.Ansible.PlaybookFile)
+	assert.Equal(t, "test", app.Tags["env"])
+	assert.Equal(t, "example.com", app.ProcessingVars["domain"])
+	assert.Equal(t, "nbg1", app.ProcessingVars["region"])
+	// top level variables are not modified
+	assert.Equal(t, "fsn1", conf.ProcessingVars["region"])
+
+	network, err := conf.StackConfig("network")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/network.git", network.TemplateRepo)
+	assert.Equal(t, "v2", network.TempateVersion)
+	assert.Equal(t, []string{"digitalocean"}, network.Terraform.Providers)
+	assert.Nil(t, network.Ansible)
+
+	_, err = conf.StackConfig("missing")
+	assert.Error(t, err)
+}
+
+func TestResolveStackReferences(t *testing.T) {
+	vars := map[string]interface{}{
+		"vpc_id":  "fromstack:network.vpc_id",
+		"subnets": []interface{}{"fromstack:network.subnet_id", "static"},
+		"nested":  map[string]interface{}{"id": "fromstack:network.vpc_id"},
+		"count":   3,
+	}
+	outputs := map[string]map[string]interface{}{
+		"network": {"vpc_id": "vpc-1", "subnet_id": "subnet-1"},
+	}
+	err := ResolveStackReferences(vars, outputs)
+	assert.NoError(t, err)
+	assert.Equal(t, "vpc-1", vars["vpc_id"])
+	assert.Equal(t, []interface{}{"subnet-1", "static"}, vars["subnets"])
+	assert.Equal(t, map[string]interface{}{"id": "vpc-1"}, vars["nested"])
+	assert.Equal(t, 3, vars["count"])
+
+	err = ResolveStackReferences(map[string]interface{}{"x": "fromstack:network.missing"}, outputs)
+	assert.EqualError(t, err, "stack 'network' has no output 'missing'")
+	err = ResolveStackReferences(map[string]interface{}{"x": "fromstack:db.host"}, outputs)
+	assert.EqualError(t, err, "outputs of stack 'db' are not available")
+}
+
+func TestStackOrderErrors(t *testing.T) {
+	conf := &Configuration{Stacks: []Stack{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c"},
+	}}
+	_, err := conf.StackOrder()
+	assert.EqualError(t, err, "dependency cycle between stacks: a, b")
+
+	conf = &Configuration{Stacks: []Stack{{Name: "a", DependsOn: []string{"missing"}}}}
+	_, err = conf.StackOrder()
+	assert.EqualError(t, err, "stack 'a' depends on unknown stack 'missing'")
+
+	conf = &Configuration{Stacks: []Stack{{Name: "a", processingVars: map[string]interface{}{"x": "fromstack:a.out"}}}}
+	_, err = conf.StackOrder()
+	assert.EqualError(t, err, "stack 'a' depends on itself")
+}
+
+func TestStacksValidation(t *testing.T) {
+	terraform := &Terraform{Providers: []string{"hcloud"}}
+	conf := &Configuration{Terraform: terraform, Stacks: []Stack{{Name: "a", TemplateDir: "a"}, {Name: "a", TemplateDir: "b"}}}
+	assert.EqualError(t, conf.postLoad(), "duplicate stack name 'a'")
+	conf = &Configuration{Terraform: terraform, Stacks: []Stack{{Name: "a"}}}
+	assert.Error(t, conf.postLoad())
+	conf = &Configuration{Stacks: []Stack{{Name: "a", TemplateDir: "a"}}}
+	assert.EqualError(t, conf.postLoad(), "stack 'a': Terraform configuration is required")
+}
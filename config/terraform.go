@@ -17,18 +17,19 @@ const (
 	defaultTfStateFileName                 = "terraform.tfstate"
 	defaultTfWorkspaceDirName              = "terraform.tf.d"
 	defaultTerraformDatDirName             = ".terraform"
-	// providers
+	// built-in providers
 	providerHcloud       = "hcloud"
 	providerHetznerdns   = "hetznerdns"
 	providerDigitalOcean = "digitalocean"
 	providerCloudflare   = "cloudflare"
 )
 
-var supportedProviders = []string{providerHcloud, providerHetznerdns, providerDigitalOcean, providerCloudflare}
-
 type Terraform struct {
 	Backend   *TerraformBackend `yaml:"backend,omitempty"`
 	Providers []string          `yaml:"providers"`
+	// Provider credentials passed to Terraform as environment variables. Values are usually read from
+	// other environment variables or files, like "HCLOUD_TOKEN: fromenv:PROD_HCLOUD_TOKEN"
+	Credentials map[string]string `yaml:"credentials,omitempty"`
 }
 
 func (t *Terraform) HasProvider(name string) bool {
@@ -56,25 +57,13 @@ func (t *Terraform) postLoad() error {
 	if len(t.Providers) == 0 {
 		return errors.New("at least one Terraform provider is required")
 	}
-	return t.checkSupportedProviders()
-}
-
-func (t *Terraform) checkSupportedProviders() error {
-	for _, prov := range t.Providers {
-		if !t.isSupportedProvider(prov) {
-			return fmt.Errorf("provider '%s' is not supported", prov)
-		}
-	}
 	return nil
 }
 
-func (t *Terraform) isSupportedProvider(provider string) bool {
-	for _, prov := range supportedProviders {
-		if provider == prov {
-			return true
-		}
-	}
-	return false
+// ResolveProviders returns descriptions of configured providers from registry. Providers are resolved
+// when template is available, since template can declare additional providers
+func (t *Terraform) ResolveProviders(registry *ProviderRegistry) ([]Provider, error) {
+	return registry.Resolve(t.Providers)
 }
 
 type TerraformBackend struct {
@@ -40,6 +40,8 @@ func (ts *TerraformTestSuite) ShouldFailOnUnsupportedProvider() {
 	tf := Terraform{
 		Providers: []string{providerHcloud, providerHetznerdns, "foo"},
 	}
-	err := tf.checkSupportedProviders()
+	registry, err := DefaultProviderRegistry()
+	ts.NoError(err)
+	_, err = tf.ResolveProviders(registry)
 	ts.Error(err)
 }
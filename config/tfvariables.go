@@ -0,0 +1,128 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var terraformVariableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// names which Terraform does not allow for input variables
+var reservedVariableNames = []string{"source", "version", "providers", "count", "for_each", "lifecycle", "depends_on", "locals"}
+
+// ValidTerraformVariableName returns true if name can be used as name of Terraform input variable
+func ValidTerraformVariableName(name string) bool {
+	return terraformVariableNamePattern.MatchString(name) && !slices.Contains(reservedVariableNames, name)
+}
+
+// SensitiveVariables returns names of top level variables which hold secrets. Variable holds secret if its
+// value, or any nested value, was read from environment or file, references such value, or if its name looks
+// like name of a secret
+func (c *Configuration) SensitiveVariables() []string {
+	var names []string
+	for name := range c.ProcessingVars {
+		if holdsSecret(name, c.rawVars[name], c.rawVars) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func holdsSecret(name string, raw interface{}, root map[string]interface{}) bool {
+	if secretNamePattern.MatchString(name) {
+		return true
+	}
+	if rawMap, ok := raw.(map[string]interface{}); ok {
+		for key, value := range rawMap {
+			if holdsSecret(key, value, root) {
+				return true
+			}
+		}
+		return false
+	}
+	return isSecret(raw, root, 0)
+}
+
+// TerraformType returns Terraform type constraint inferred from variable value
+func TerraformType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int64, uint64, float64:
+		return "number"
+	case []interface{}:
+		if elem, ok := commonType(v); ok {
+			return "list(" + elem + ")"
+		}
+		types := make([]string, 0, len(v))
+		for _, item := range v {
+			types = append(types, TerraformType(item))
+		}
+		return "tuple([" + strings.Join(types, ", ") + "])"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		items := make([]interface{}, 0, len(v))
+		for key, item := range v {
+			keys = append(keys, key)
+			items = append(items, item)
+		}
+		sort.Strings(keys)
+		attrs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			// object attributes must be identifiers, otherwise map is used if values have the same type
+			if !terraformVariableNamePattern.MatchString(key) {
+				if elem, ok := commonType(items); ok {
+					return "map(" + elem + ")"
+				}
+				return "any"
+			}
+			attrs = append(attrs, fmt.Sprintf("%s = %s", key, TerraformType(v[key])))
+		}
+		return "object({" + strings.Join(attrs, ", ") + "})"
+	}
+	return "any"
+}
+
+// returns type shared by all items of list. Empty list has elements of any type
+func commonType(items []interface{}) (string, bool) {
+	if len(items) == 0 {
+		return "any", true
+	}
+	elem := TerraformType(items[0])
+	for _, item := range items[1:] {
+		if TerraformType(item) != elem {
+			return "", false
+		}
+	}
+	return elem, true
+}
+
+// TerraformVariablesBlock returns declarations of Terraform input variables with types inferred from values
+func TerraformVariablesBlock(vars map[string]interface{}, sensitive []string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "variable %q {\n  type = %s\n", name, TerraformType(vars[name]))
+		if slices.Contains(sensitive, name) {
+			sb.WriteString("  sensitive = true\n")
+		}
+		sb.WriteString("}\n")
+	}
+	return sb.String()
+}
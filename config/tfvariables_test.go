@@ -0,0 +1,79 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerraformType(t *testing.T) {
+	assert.Equal(t, "string", TerraformType("web"))
+	assert.Equal(t, "number", TerraformType(3))
+	assert.Equal(t, "number", TerraformType(1.5))
+	assert.Equal(t, "bool", TerraformType(true))
+	assert.Equal(t, "any", TerraformType(nil))
+	assert.Equal(t, "list(string)", TerraformType([]interface{}{"a", "b"}))
+	assert.Equal(t, "list(any)", TerraformType([]interface{}{}))
+	assert.Equal(t, "tuple([string, number])", TerraformType([]interface{}{"a", 1}))
+	assert.Equal(t, "object({count = number, server-type = string})", TerraformType(map[string]interface{}{
+		"count":       2,
+		"server-type": "cx22",
+	}))
+	assert.Equal(t, "map(string)", TerraformType(map[string]interface{}{
+		"app.kubernetes.io/name": "web",
+		"tier":                   "frontend",
+	}))
+	assert.Equal(t, "any", TerraformType(map[string]interface{}{"app.version": 2, "tier": "frontend"}))
+}
+
+func TestValidTerraformVariableName(t *testing.T) {
+	assert.True(t, ValidTerraformVariableName("server_type"))
+	assert.True(t, ValidTerraformVariableName("server-type"))
+	assert.False(t, ValidTerraformVariableName("1server"))
+	assert.False(t, ValidTerraformVariableName("server.type"))
+	assert.False(t, ValidTerraformVariableName("count"))
+}
+
+func TestTerraformVariablesBlock(t *testing.T) {
+	block := TerraformVariablesBlock(map[string]interface{}{
+		"server_type": "cx22",
+		"db_password": "secret",
+	}, []string{"db_password"})
+	assert.Equal(t, `variable "db_password" {
+  type = string
+  sensitive = true
+}
+
+variable "server_type" {
+  type = string
+}
+`, block)
+}
+
+func TestSensitiveVariables(t *testing.T) {
+	t.Setenv("API_URL", "https://api.example.com")
+	configPath := filepath.Join(t.TempDir(), "liftoff.yaml")
+	content := `
+terraform:
+  providers:
+    - hcloud
+variables:
+  default:
+    server_type: cx22
+    api_url: fromenv:API_URL
+    endpoint: "${var.api_url}/v1"
+    database:
+      name: app
+      password: changeme
+    hcloud_token: plain
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0o600))
+	conf, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api_url", "database", "endpoint", "hcloud_token"}, conf.SensitiveVariables())
+}
@@ -0,0 +1,252 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parseTFVars parses Terraform variable definitions file. Only literal values are supported: strings,
+// numbers, booleans, null, lists and objects. Expressions, functions and heredocs are not supported
+func parseTFVars(data string) (map[string]interface{}, error) {
+	p := &tfvarsParser{input: []rune(data), line: 1}
+	result := map[string]interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return result, nil
+		}
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if !p.consume('=') {
+			return nil, p.errorf("expected '=' after '%s'", key)
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+		p.skipSpace(false)
+		if !p.eof() && !p.consume('\n') {
+			return nil, p.errorf("expected new line after value of '%s'", key)
+		}
+		p.line++
+	}
+}
+
+type tfvarsParser struct {
+	input []rune
+	pos   int
+	line  int
+}
+
+func (p *tfvarsParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *tfvarsParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *tfvarsParser) consume(r rune) bool {
+	if p.peek() == r && !p.eof() {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tfvarsParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("tfvars line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skips whitespace and comments. New lines are skipped only if requested
+func (p *tfvarsParser) skipSpace(newLines bool) {
+	for !p.eof() {
+		r := p.peek()
+		switch {
+		case r == '\n':
+			if !newLines {
+				return
+			}
+			p.line++
+			p.pos++
+		case unicode.IsSpace(r):
+			p.pos++
+		case r == '#' || (r == '/' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '/'):
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case r == '/' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '*':
+			p.pos += 2
+			for !p.eof() && !(p.peek() == '*' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '/') {
+				if p.peek() == '\n' {
+					p.line++
+				}
+				p.pos++
+			}
+			p.pos += 2
+		default:
+			return
+		}
+	}
+}
+
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
+// parses identifier or quoted string used as variable name or object key
+func (p *tfvarsParser) parseKey() (string, error) {
+	if p.peek() == '"' {
+		return p.parseString()
+	}
+	start := p.pos
+	for !p.eof() && isIdentifierRune(p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("unexpected character '%c'", p.peek())
+	}
+	return string(p.input[start:p.pos]), nil
+}
+
+func (p *tfvarsParser) parseValue() (interface{}, error) {
+	p.skipSpace(false)
+	r := p.peek()
+	switch {
+	case r == '"':
+		return p.parseString()
+	case r == '[':
+		return p.parseList()
+	case r == '{':
+		return p.parseObject()
+	case r == '-' || unicode.IsDigit(r):
+		return p.parseNumber()
+	case unicode.IsLetter(r):
+		word, _ := p.parseKey()
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return nil, p.errorf("unsupported expression '%s'", word)
+	}
+	return nil, p.errorf("unexpected character '%c'", r)
+}
+
+func (p *tfvarsParser) parseString() (string, error) {
+	p.pos++
+	var sb strings.Builder
+	for !p.eof() {
+		r := p.peek()
+		p.pos++
+		switch r {
+		case '"':
+			return sb.String(), nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			escaped := p.peek()
+			p.pos++
+			switch escaped {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case '"', '\\':
+				sb.WriteRune(escaped)
+			default:
+				return "", p.errorf("unsupported escape sequence '\\%c'", escaped)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *tfvarsParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	p.consume('-')
+	for !p.eof() && (unicode.IsDigit(p.peek()) || strings.ContainsRune(".eE+-", p.peek())) {
+		p.pos++
+	}
+	text := string(p.input[start:p.pos])
+	if i, err := strconv.Atoi(text); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number '%s'", text)
+	}
+	return f, nil
+}
+
+func (p *tfvarsParser) parseList() ([]interface{}, error) {
+	p.pos++
+	list := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.consume(']') {
+			return list, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+		p.skipSpace(true)
+		if p.consume(']') {
+			return list, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("expected ',' or ']' in list")
+		}
+	}
+}
+
+func (p *tfvarsParser) parseObject() (map[string]interface{}, error) {
+	p.pos++
+	object := map[string]interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.consume('}') {
+			return object, nil
+		}
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if !p.consume('=') && !p.consume(':') {
+			return nil, p.errorf("expected '=' after object key '%s'", key)
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		object[key] = value
+		p.skipSpace(false)
+		// attributes are separated by comma or new line
+		p.consume(',')
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTFVars(t *testing.T) {
+	input := `
+# comment
+name     = "web \"server\""
+count    = 3
+ratio    = 0.5
+enabled  = true
+missing  = null // trailing comment
+/* block
+   comment */
+zones = ["fsn1", "nbg1",]
+labels = {
+  env  = "test"
+  "app.io/name": "liftoff",
+  ports = [80, 443]
+}
+`
+	vars, err := parseTFVars(input)
+	assert.NoError(t, err)
+	assert.Equal(t, `web "server"`, vars["name"])
+	assert.Equal(t, 3, vars["count"])
+	assert.Equal(t, 0.5, vars["ratio"])
+	assert.Equal(t, true, vars["enabled"])
+	assert.Contains(t, vars, "missing")
+	assert.Nil(t, vars["missing"])
+	assert.Equal(t, []interface{}{"fsn1", "nbg1"}, vars["zones"])
+	assert.Equal(t, map[string]interface{}{
+		"env":         "test",
+		"app.io/name": "liftoff",
+		"ports":       []interface{}{80, 443},
+	}, vars["labels"])
+}
+
+func TestParseTFVarsErrors(t *testing.T) {
+	cases := map[string]string{
+		"expression":    "name = var.other\n",
+		"missing value": "name =\n",
+		"unterminated":  "name = \"web\n",
+		"missing equal": "name \"web\"\n",
+		"two values":    "a = 1 b = 2\n",
+		"list":          "zones = [\"a\" \"b\"]\n",
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseTFVars(input)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const hoursPerDay = 24
+
+// ParseTTL parses time-to-live value. Besides units supported by time.ParseDuration, days can be
+// specified with "d" suffix, like "7d"
+func ParseTTL(value string) (time.Duration, error) {
+	var ttl time.Duration
+	var err error
+	if days, found := strings.CutSuffix(value, "d"); found {
+		var count int
+		count, err = strconv.Atoi(days)
+		ttl = time.Duration(count) * hoursPerDay * time.Hour
+	} else {
+		ttl, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid TTL '%s': %w", value, err)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("invalid TTL '%s': must be positive", value)
+	}
+	return ttl, nil
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTTL(t *testing.T) {
+	ttl, err := ParseTTL("3h")
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Hour, ttl)
+	ttl, err = ParseTTL("2d")
+	assert.NoError(t, err)
+	assert.Equal(t, 48*time.Hour, ttl)
+	ttl, err = ParseTTL("1h30m")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, ttl)
+}
+
+func TestParseTTLInvalid(t *testing.T) {
+	for _, value := range []string{"", "3x", "d", "-1h", "0d"} {
+		_, err := ParseTTL(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,596 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitshifted/liftoff/common"
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/exec"
+	"github.com/bitshifted/liftoff/gitops"
+	"gopkg.in/yaml.v3"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+const (
+	terraformCmd       = "terraform"
+	openTofuCmd        = "tofu"
+	ansiblePlaybookCmd = "ansible-playbook"
+	ansibleGalaxyCmd   = "ansible-galaxy"
+	// collection providing JSON callback for Ansible
+	ansibleJSONCollection = "ansible.posix"
+	repoCheckTimeout      = 30 * time.Second
+)
+
+// variables whose names match this pattern are expected to contain paths of SSH keys
+var sshKeyVarPattern = regexp.MustCompile(`(?i)(ssh.*(key|identity)|private_key|identity_file)`)
+
+// matches version of ansible-playbook, like "ansible-playbook [core 2.17.1]"
+var ansibleVersionPattern = regexp.MustCompile(`\[core ([^\]]+)\]`)
+
+// names of Ansible requirements files in template, relative to template directory
+var requirementsFiles = []string{
+	"ansible/requirements.yml",
+	"ansible/requirements.yaml",
+	"requirements.yml",
+	"requirements.yaml",
+}
+
+// Check is result of single diagnostic check
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+// Options control which environment is checked
+type Options struct {
+	// Path to configuration file
+	ConfigPath string
+	// Loaded configuration. Checks which depend on configuration are skipped if not set
+	Config *config.Configuration
+	// Error from loading configuration, reported as failed check
+	ConfigError error
+	// Paths to binaries. Looked up in PATH if not set
+	TerraformPath       string
+	AnsiblePlaybookPath string
+	// Runner for external commands. Defaults to running real binaries
+	Runner exec.Runner
+	// Home directory of the user. Defaults to current user's home directory
+	HomeDir string
+	// Checks that template repository can be reached. Defaults to listing remote references
+	CheckRepo func(ctx context.Context, url string) error
+}
+
+type doctor struct {
+	opts   Options
+	ctx    context.Context
+	checks []Check
+}
+
+// Run performs all checks and returns their results in order
+func Run(ctx context.Context, opts Options) []Check {
+	if opts.Runner == nil {
+		opts.Runner = &exec.OSRunner{}
+	}
+	if opts.CheckRepo == nil {
+		opts.CheckRepo = func(ctx context.Context, url string) error {
+			handler := gitops.GitHandler{URL: url}
+			return handler.CheckReachable(ctx)
+		}
+	}
+	d := &doctor{opts: opts, ctx: ctx}
+	d.checkConfiguration()
+	d.checkTerraform()
+	playbookPath := d.checkAnsiblePlaybook()
+	d.checkLiftoffHome()
+	if opts.Config == nil {
+		return d.checks
+	}
+	d.checkCollections(playbookPath)
+	d.checkSSHKeys()
+	d.checkTemplateRepos()
+	d.checkCredentials()
+	return d.checks
+}
+
+// Failed returns number of failed checks
+func Failed(checks []Check) int {
+	count := 0
+	for _, check := range checks {
+		if check.Status == StatusFail {
+			count++
+		}
+	}
+	return count
+}
+
+func (d *doctor) add(name string, status Status, format string, args ...interface{}) {
+	d.checks = append(d.checks, Check{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// returns configuration of each stack, or configuration itself if it does not have stacks
+func (d *doctor) configurations() []*config.Configuration {
+	conf := d.opts.Config
+	if !conf.HasStacks() {
+		return []*config.Configuration{conf}
+	}
+	var result []*config.Configuration
+	for _, stack := range conf.Stacks {
+		if stackConf, err := conf.StackConfig(stack.Name); err == nil {
+			result = append(result, stackConf)
+		}
+	}
+	return result
+}
+
+// runs command and returns its combined output
+func (d *doctor) output(cmdPath string, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := d.opts.Runner.Run(d.ctx, &exec.Command{
+		Path:   cmdPath,
+		Args:   args,
+		Env:    os.Environ(),
+		Stdout: &out,
+		Stderr: &out,
+	})
+	return out.String(), err
+}
+
+func (d *doctor) checkConfiguration() {
+	const name = "configuration"
+	if d.opts.ConfigError != nil {
+		d.add(name, StatusFail, "%s: %v", d.opts.ConfigPath, d.opts.ConfigError)
+	} else if d.opts.Config != nil {
+		d.add(name, StatusPass, "%s", d.opts.ConfigPath)
+	}
+	data, err := os.ReadFile(d.opts.ConfigPath)
+	if err != nil {
+		return
+	}
+	var doc interface{}
+	if yaml.Unmarshal(data, &doc) != nil {
+		return
+	}
+	var problems []string
+	walkStrings(doc, func(value string) {
+		switch common.ValueTypeFromString(value) {
+		case common.EnvVariableString:
+			if varName := common.ExtractEnvVarName(value); !common.IsEnvVariableSet(varName) {
+				problems = append(problems, fmt.Sprintf("environment variable %s is not set", varName))
+			}
+		case common.FileContentString:
+			filePath, err := common.ExtractFilePath(value)
+			if err == nil {
+				_, err = os.ReadFile(filePath)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("file %s is not readable", filePath))
+			}
+		}
+	})
+	if len(problems) > 0 {
+		d.add("config references", StatusFail, "%s", strings.Join(problems, "; "))
+	}
+}
+
+func (d *doctor) checkTerraform() {
+	const name = "terraform"
+	tfPath := d.opts.TerraformPath
+	product := "Terraform"
+	if tfPath == "" {
+		var err error
+		tfPath, err = d.opts.Runner.LookPath(terraformCmd)
+		if err != nil {
+			tofuPath, tofuErr := d.opts.Runner.LookPath(openTofuCmd)
+			if tofuErr != nil {
+				d.add(name, StatusFail, "neither terraform nor tofu found in PATH")
+				return
+			}
+			tfPath = tofuPath
+			product = "OpenTofu"
+		}
+	}
+	out, err := d.output(tfPath, "version", "-json")
+	if err != nil {
+		d.add(name, StatusFail, "failed to run %s version: %v", tfPath, err)
+		return
+	}
+	var version struct {
+		Version string `json:"terraform_version"`
+	}
+	if err = json.Unmarshal([]byte(out), &version); err != nil || version.Version == "" {
+		d.add(name, StatusWarn, "could not determine version of %s", tfPath)
+		return
+	}
+	if compareVersions(version.Version, config.TerraformMinVersion) < 0 {
+		d.add(name, StatusFail, "%s %s at %s is older than required %s", product, version.Version, tfPath, config.TerraformMinVersion)
+		return
+	}
+	if product == "OpenTofu" {
+		d.add(name, StatusWarn, "%s %s found at %s, use --terraform-path to use it", product, version.Version, tfPath)
+		return
+	}
+	d.add(name, StatusPass, "%s %s at %s", product, version.Version, tfPath)
+}
+
+// checks ansible-playbook and returns its path, or empty string if it was not found
+func (d *doctor) checkAnsiblePlaybook() string {
+	const name = "ansible-playbook"
+	// missing Ansible is only a problem if configuration uses it
+	missingStatus := StatusWarn
+	if d.opts.Config != nil && d.usesAnsible() {
+		missingStatus = StatusFail
+	}
+	playbookPath := d.opts.AnsiblePlaybookPath
+	if playbookPath == "" {
+		var err error
+		playbookPath, err = d.opts.Runner.LookPath(ansiblePlaybookCmd)
+		if err != nil {
+			d.add(name, missingStatus, "ansible-playbook not found in PATH")
+			return ""
+		}
+	}
+	out, err := d.output(playbookPath, "--version")
+	if err != nil {
+		d.add(name, missingStatus, "failed to run %s --version: %v", playbookPath, err)
+		return ""
+	}
+	version := "unknown version"
+	if match := ansibleVersionPattern.FindStringSubmatch(out); match != nil {
+		version = match[1]
+	}
+	d.add(name, StatusPass, "ansible-core %s at %s", version, playbookPath)
+	return playbookPath
+}
+
+func (d *doctor) usesAnsible() bool {
+	for _, conf := range d.configurations() {
+		if conf.Ansible != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *doctor) checkLiftoffHome() {
+	const name = "liftoff home"
+	homeDir := d.opts.HomeDir
+	if homeDir == "" {
+		var err error
+		homeDir, err = os.UserHomeDir()
+		if err != nil {
+			d.add(name, StatusFail, "home directory is not available: %v", err)
+			return
+		}
+	}
+	liftoffHome := path.Join(homeDir, common.LiftoffHomeDirName)
+	err := os.MkdirAll(liftoffHome, 0o755)
+	if err == nil {
+		var probe *os.File
+		probe, err = os.CreateTemp(liftoffHome, ".doctor-*")
+		if err == nil {
+			_ = probe.Close()
+			err = os.Remove(probe.Name())
+		}
+	}
+	if err != nil {
+		d.add(name, StatusFail, "%s is not writable: %v", liftoffHome, err)
+		return
+	}
+	d.add(name, StatusPass, "%s is writable", liftoffHome)
+}
+
+func (d *doctor) checkCollections(playbookPath string) {
+	const name = "ansible collections"
+	// collection with JSON callback used for reporting Ansible task progress is always needed
+	required := map[string]bool{ansibleJSONCollection: true}
+	for _, conf := range d.configurations() {
+		if conf.TemplateRepo != "" || conf.TemplateDir == "" {
+			continue
+		}
+		collections, err := templateCollections(conf.TemplateDir)
+		if err != nil {
+			d.add(name, StatusFail, "%v", err)
+			return
+		}
+		for _, collection := range collections {
+			required[collection] = true
+		}
+	}
+	if playbookPath == "" {
+		d.add(name, StatusFail, "ansible is not installed")
+		return
+	}
+	galaxyPath := filepath.Join(filepath.Dir(playbookPath), ansibleGalaxyCmd)
+	out, err := d.output(galaxyPath, "collection", "list", "--format", "json")
+	if err != nil {
+		d.add(name, StatusFail, "failed to list installed collections: %v", err)
+		return
+	}
+	installed, err := installedCollections(out)
+	if err != nil {
+		d.add(name, StatusWarn, "could not parse installed collections: %v", err)
+		return
+	}
+	var missing []string
+	for collection := range required {
+		if !installed[collection] {
+			missing = append(missing, collection)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		d.add(name, StatusFail, "missing collections: %s. Install them with ansible-galaxy collection install",
+			strings.Join(missing, ", "))
+		return
+	}
+	if d.hasRemoteTemplate() {
+		d.add(name, StatusWarn, "%d required collections installed, collections of templates fetched from repository "+
+			"are not checked", len(required))
+		return
+	}
+	d.add(name, StatusPass, "%d required collections installed", len(required))
+}
+
+func (d *doctor) hasRemoteTemplate() bool {
+	for _, conf := range d.configurations() {
+		if conf.TemplateRepo != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// returns collections listed in Ansible requirements file of template
+func templateCollections(templateDir string) ([]string, error) {
+	for _, name := range requirementsFiles {
+		data, err := os.ReadFile(path.Join(templateDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var requirements struct {
+			Collections []interface{} `yaml:"collections"`
+		}
+		if err = yaml.Unmarshal(data, &requirements); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		var collections []string
+		for _, item := range requirements.Collections {
+			switch v := item.(type) {
+			case string:
+				collections = append(collections, v)
+			case map[string]interface{}:
+				if collection, ok := v["name"].(string); ok {
+					collections = append(collections, collection)
+				}
+			}
+		}
+		return collections, nil
+	}
+	return nil, nil
+}
+
+// parses output of "ansible-galaxy collection list --format json", which maps collection directories
+// to collections installed in them
+func installedCollections(out string) (map[string]bool, error) {
+	var dirs map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &dirs); err != nil {
+		return nil, err
+	}
+	installed := map[string]bool{}
+	for _, collections := range dirs {
+		for collection := range collections {
+			installed[collection] = true
+		}
+	}
+	return installed, nil
+}
+
+func (d *doctor) checkSSHKeys() {
+	const name = "ssh keys"
+	keys := map[string]bool{}
+	for _, conf := range d.configurations() {
+		collectKeyFiles(conf.ProcessingVars, keys)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	files := make([]string, 0, len(keys))
+	for file := range keys {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var problems, warnings []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s does not exist", file))
+			continue
+		}
+		if _, err = os.ReadFile(file); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is not readable", file))
+			continue
+		}
+		if !strings.HasSuffix(file, ".pub") && info.Mode().Perm()&0o077 != 0 {
+			warnings = append(warnings, fmt.Sprintf("%s is accessible by other users, ssh may refuse to use it", file))
+		}
+	}
+	switch {
+	case len(problems) > 0:
+		d.add(name, StatusFail, "%s", strings.Join(append(problems, warnings...), "; "))
+	case len(warnings) > 0:
+		d.add(name, StatusWarn, "%s", strings.Join(warnings, "; "))
+	default:
+		d.add(name, StatusPass, "%d key files found", len(files))
+	}
+}
+
+// collects paths of SSH key files from variables whose names look like SSH key variables. Values
+// which are not paths, like key content read from files, are skipped
+func collectKeyFiles(vars map[string]interface{}, keys map[string]bool) {
+	for key, value := range vars {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			collectKeyFiles(v, keys)
+		case string:
+			if sshKeyVarPattern.MatchString(key) && looksLikePath(v) {
+				filePath, err := common.ExtractFilePath(v)
+				if err == nil {
+					keys[filePath] = true
+				}
+			}
+		}
+	}
+}
+
+func looksLikePath(value string) bool {
+	if value == "" || strings.ContainsAny(value, " \t\n") {
+		return false
+	}
+	return strings.HasPrefix(value, "~") || strings.Contains(value, "/")
+}
+
+func (d *doctor) checkTemplateRepos() {
+	const name = "template repository"
+	repos := map[string]bool{}
+	for _, conf := range d.configurations() {
+		if conf.TemplateRepo != "" {
+			repos[conf.TemplateRepo] = true
+		}
+	}
+	urls := make([]string, 0, len(repos))
+	for url := range repos {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		ctx, cancel := context.WithTimeout(d.ctx, repoCheckTimeout)
+		err := d.opts.CheckRepo(ctx, url)
+		cancel()
+		if err != nil {
+			d.add(name, StatusFail, "%s is not reachable: %v", url, err)
+		} else {
+			d.add(name, StatusPass, "%s is reachable", url)
+		}
+	}
+}
+
+func (d *doctor) checkCredentials() {
+	const name = "provider credentials"
+	var missing, unknown []string
+	checked := 0
+	for _, conf := range d.configurations() {
+		if conf.Terraform == nil {
+			continue
+		}
+		registry, err := d.providerRegistry(conf)
+		if err != nil {
+			d.add(name, StatusFail, "%v", err)
+			return
+		}
+		providers := conf.Terraform.KnownProviders(registry)
+		checked += len(providers)
+		for _, provider := range conf.Terraform.Providers {
+			if _, ok := registry.Lookup(provider); !ok {
+				unknown = append(unknown, provider)
+			}
+		}
+		_, problems := conf.Terraform.ResolveCredentials(providers)
+		missing = append(missing, problems...)
+	}
+	switch {
+	case len(missing) > 0:
+		d.add(name, StatusFail, "%s", strings.Join(dedupe(missing), "; "))
+	case len(unknown) > 0:
+		d.add(name, StatusWarn, "credentials of providers %s were not checked, they are not built-in providers",
+			strings.Join(dedupe(unknown), ", "))
+	default:
+		d.add(name, StatusPass, "credentials of %d providers are available", checked)
+	}
+}
+
+// returns registry with providers declared in local template, or built-in providers for remote templates
+func (d *doctor) providerRegistry(conf *config.Configuration) (*config.ProviderRegistry, error) {
+	if conf.TemplateRepo == "" && conf.TemplateDir != "" {
+		return config.LoadProviderRegistry(conf.TemplateDir)
+	}
+	return config.DefaultProviderRegistry()
+}
+
+func dedupe(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func walkStrings(value interface{}, fn func(value string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case []interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	}
+}
+
+// compares dotted version numbers. Pre-release suffixes are ignored
+func compareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aNum, bNum := versionPart(aParts, i), versionPart(bParts, i)
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	part, _, _ := strings.Cut(parts[i], "-")
+	num, _ := strconv.Atoi(part)
+	return num
+}
@@ -0,0 +1,231 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package doctor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/exec"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunner finds binaries from paths map and returns output configured for command line
+type fakeRunner struct {
+	paths   map[string]string
+	outputs map[string]string
+}
+
+func (r *fakeRunner) LookPath(file string) (string, error) {
+	if p, ok := r.paths[file]; ok {
+		return p, nil
+	}
+	return "", errors.New("executable file not found in $PATH")
+}
+
+func (r *fakeRunner) Run(_ context.Context, cmd *exec.Command) error {
+	line := filepath.Base(cmd.Path) + " " + strings.Join(cmd.Args, " ")
+	out, ok := r.outputs[line]
+	if !ok {
+		return errors.New("unexpected command " + line)
+	}
+	_, err := io.WriteString(cmd.Stdout, out)
+	return err
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{
+		paths: map[string]string{
+			"terraform":        "/usr/bin/terraform",
+			"ansible-playbook": "/usr/bin/ansible-playbook",
+		},
+		outputs: map[string]string{
+			"terraform version -json":                      `{"terraform_version": "1.9.5"}`,
+			"ansible-playbook --version":                   "ansible-playbook [core 2.17.1]\n  config file = None\n",
+			"ansible-galaxy collection list --format json": `{"/usr/share/ansible/collections": {"ansible.posix": {"version": "1.6.2"}, "community.general": {"version": "9.0.0"}}}`,
+		},
+	}
+}
+
+func findCheck(checks []Check, name string) *Check {
+	for i := range checks {
+		if checks[i].Name == name {
+			return &checks[i]
+		}
+	}
+	return nil
+}
+
+func writeConfig(t *testing.T, content string) (string, *config.Configuration) {
+	configPath := filepath.Join(t.TempDir(), "liftoff.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0o600))
+	conf, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	return configPath, conf
+}
+
+func TestRunPassesWithCompleteEnvironment(t *testing.T) {
+	t.Setenv("HCLOUD_TOKEN", "token")
+	keyDir := t.TempDir()
+	keyPath := filepath.Join(keyDir, "id_ed25519")
+	assert.NoError(t, os.WriteFile(keyPath, []byte("key"), 0o600))
+	tmplDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmplDir, "ansible"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmplDir, "ansible", "requirements.yml"),
+		[]byte("collections:\n  - name: community.general\n"), 0o600))
+	configPath, conf := writeConfig(t, `
+template-dir: `+tmplDir+`
+template-repo: ""
+terraform:
+  providers:
+    - hcloud
+ansible:
+  inventory-file: inventory
+  playbook-file: site.yaml
+variables:
+  default:
+    ansible_ssh_private_key: `+keyPath+`
+`)
+	checks := Run(context.Background(), Options{
+		ConfigPath: configPath,
+		Config:     conf,
+		Runner:     newFakeRunner(),
+		HomeDir:    t.TempDir(),
+	})
+	for _, check := range checks {
+		assert.Equal(t, StatusPass, check.Status, "%s: %s", check.Name, check.Message)
+	}
+	assert.Equal(t, 0, Failed(checks))
+	assert.Contains(t, findCheck(checks, "terraform").Message, "Terraform 1.9.5")
+	assert.Contains(t, findCheck(checks, "ansible-playbook").Message, "2.17.1")
+	assert.Equal(t, "2 required collections installed", findCheck(checks, "ansible collections").Message)
+	assert.Equal(t, "1 key files found", findCheck(checks, "ssh keys").Message)
+}
+
+func TestRunReportsProblems(t *testing.T) {
+	t.Setenv("HCLOUD_TOKEN", "")
+	keyDir := t.TempDir()
+	openKey := filepath.Join(keyDir, "open_key")
+	assert.NoError(t, os.WriteFile(openKey, []byte("key"), 0o644))
+	configPath, conf := writeConfig(t, `
+template-repo: https://example.com/templates.git
+terraform:
+  providers:
+    - hcloud
+ansible:
+  inventory-file: inventory
+  playbook-file: site.yaml
+variables:
+  default:
+    ansible_ssh_private_key: `+filepath.Join(keyDir, "missing")+`
+    bastion_ssh_key: `+openKey+`
+    ssh_public_key_content: ssh-ed25519 AAAA user@host
+`)
+	runner := newFakeRunner()
+	runner.outputs["terraform version -json"] = `{"terraform_version": "1.5.7"}`
+	delete(runner.paths, "ansible-playbook")
+	checks := Run(context.Background(), Options{
+		ConfigPath: configPath,
+		Config:     conf,
+		Runner:     runner,
+		HomeDir:    t.TempDir(),
+		CheckRepo: func(_ context.Context, url string) error {
+			return errors.New("authentication required")
+		},
+	})
+	assert.Equal(t, StatusFail, findCheck(checks, "terraform").Status)
+	assert.Contains(t, findCheck(checks, "terraform").Message, "older than required")
+	assert.Equal(t, StatusFail, findCheck(checks, "ansible-playbook").Status)
+	assert.Equal(t, StatusFail, findCheck(checks, "ansible collections").Status)
+	sshKeys := findCheck(checks, "ssh keys")
+	assert.Equal(t, StatusFail, sshKeys.Status)
+	assert.Contains(t, sshKeys.Message, "missing does not exist")
+	assert.Contains(t, sshKeys.Message, "open_key is accessible by other users")
+	assert.NotContains(t, sshKeys.Message, "ssh-ed25519")
+	assert.Equal(t, StatusFail, findCheck(checks, "template repository").Status)
+	assert.Contains(t, findCheck(checks, "provider credentials").Message, "HCLOUD_TOKEN")
+	assert.Equal(t, 6, Failed(checks))
+}
+
+func TestRunReportsConfigurationErrors(t *testing.T) {
+	t.Setenv("DOCTOR_MISSING_VAR", "")
+	configPath := filepath.Join(t.TempDir(), "liftoff.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`
+terraform:
+  providers:
+    - hcloud
+variables:
+  default:
+    token: fromenv:DOCTOR_MISSING_VAR
+    key: fromfile:/nonexistent/key.pub
+`), 0o600))
+	conf, err := config.LoadConfig(configPath)
+	assert.Error(t, err)
+	runner := newFakeRunner()
+	delete(runner.paths, "terraform")
+	runner.paths["tofu"] = "/usr/bin/tofu"
+	runner.outputs["tofu version -json"] = `{"terraform_version": "1.9.0"}`
+	checks := Run(context.Background(), Options{
+		ConfigPath:  configPath,
+		Config:      conf,
+		ConfigError: err,
+		Runner:      runner,
+		HomeDir:     t.TempDir(),
+	})
+	assert.Equal(t, StatusFail, findCheck(checks, "configuration").Status)
+	references := findCheck(checks, "config references")
+	assert.Contains(t, references.Message, "environment variable DOCTOR_MISSING_VAR is not set")
+	assert.Contains(t, references.Message, "file /nonexistent/key.pub is not readable")
+	tf := findCheck(checks, "terraform")
+	assert.Equal(t, StatusWarn, tf.Status)
+	assert.Contains(t, tf.Message, "OpenTofu 1.9.0")
+	// Ansible is not required without configuration
+	assert.Equal(t, StatusPass, findCheck(checks, "ansible-playbook").Status)
+	assert.Nil(t, findCheck(checks, "provider credentials"))
+}
+
+func TestLiftoffHomeNotWritable(t *testing.T) {
+	homeDir := t.TempDir()
+	// file in place of directory can not be written to
+	assert.NoError(t, os.WriteFile(filepath.Join(homeDir, ".liftoff"), []byte{}, 0o600))
+	checks := Run(context.Background(), Options{Runner: newFakeRunner(), HomeDir: homeDir})
+	assert.Equal(t, StatusFail, findCheck(checks, "liftoff home").Status)
+}
+
+func TestCollectionsRequireJSONCallback(t *testing.T) {
+	configPath, conf := writeConfig(t, `
+template-repo: https://example.com/templates.git
+terraform:
+  providers:
+    - hcloud
+ansible:
+  inventory-file: inventory
+  playbook-file: site.yaml
+`)
+	runner := newFakeRunner()
+	runner.outputs["ansible-galaxy collection list --format json"] = `{"/usr/share/ansible/collections": {}}`
+	checks := Run(context.Background(), Options{
+		ConfigPath: configPath,
+		Config:     conf,
+		Runner:     runner,
+		HomeDir:    t.TempDir(),
+		CheckRepo:  func(_ context.Context, url string) error { return nil },
+	})
+	collections := findCheck(checks, "ansible collections")
+	assert.Equal(t, StatusFail, collections.Status)
+	assert.Contains(t, collections.Message, "missing collections: ansible.posix")
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("1.9.0", "1.9.0"))
+	assert.Equal(t, 1, compareVersions("1.10.0", "1.9.0"))
+	assert.Equal(t, -1, compareVersions("1.9.0-rc1", "1.9.1"))
+	assert.Equal(t, 0, compareVersions("v1.9", "1.9.0"))
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Type string
+
+const (
+	PhaseStarted     Type = "phase-started"
+	PhaseFinished    Type = "phase-finished"
+	TemplateRendered Type = "template-rendered"
+	ResourceChanged  Type = "resource-change"
+	TaskFinished     Type = "task-result"
+	Error            Type = "error"
+)
+
+// status of resource change or Ansible task
+const (
+	StatusStarted     = "started"
+	StatusInProgress  = "in-progress"
+	StatusComplete    = "complete"
+	StatusErrored     = "errored"
+	StatusOK          = "ok"
+	StatusChanged     = "changed"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"
+	StatusUnreachable = "unreachable"
+)
+
+// Event describes progress of liftoff execution
+type Event struct {
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	// Configuration file, when multiple configurations are processed at once
+	Config string `json:"config,omitempty"`
+	// Name of the stack, for configurations with multiple stacks
+	Stack    string                 `json:"stack,omitempty"`
+	Phase    string                 `json:"phase,omitempty"`
+	Duration time.Duration          `json:"-"`
+	Message  string                 `json:"message,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Resource *ResourceChange        `json:"resource,omitempty"`
+	Task     *TaskResult            `json:"task,omitempty"`
+	// Output of external commands executed during the phase, if it was captured
+	Output string `json:"output,omitempty"`
+}
+
+// ResourceChange describes change of single Terraform resource
+type ResourceChange struct {
+	Address string `json:"address"`
+	// Terraform action, like "create", "update" or "delete"
+	Action  string        `json:"action"`
+	Status  string        `json:"status"`
+	Elapsed time.Duration `json:"-"`
+}
+
+// TaskResult describes result of Ansible task on single host
+type TaskResult struct {
+	Play    string        `json:"play,omitempty"`
+	Task    string        `json:"task"`
+	Host    string        `json:"host"`
+	Status  string        `json:"status"`
+	Message string        `json:"message,omitempty"`
+	Elapsed time.Duration `json:"-"`
+}
+
+// Handler is a callback invoked for each emitted event
+type Handler func(Event)
+
+// MarshalJSON encodes event with duration in milliseconds
+func (e Event) MarshalJSON() ([]byte, error) {
+	type plain Event
+	return json.Marshal(struct {
+		plain
+		DurationMs int64 `json:"duration_ms,omitempty"`
+	}{plain(e), e.Duration.Milliseconds()})
+}
+
+// MarshalJSON encodes resource change with elapsed time in milliseconds
+func (rc ResourceChange) MarshalJSON() ([]byte, error) {
+	type plain ResourceChange
+	return json.Marshal(struct {
+		plain
+		ElapsedMs int64 `json:"elapsed_ms,omitempty"`
+	}{plain(rc), rc.Elapsed.Milliseconds()})
+}
+
+// MarshalJSON encodes task result with elapsed time in milliseconds
+func (tr TaskResult) MarshalJSON() ([]byte, error) {
+	type plain TaskResult
+	return json.Marshal(struct {
+		plain
+		ElapsedMs int64 `json:"elapsed_ms,omitempty"`
+	}{plain(tr), tr.Elapsed.Milliseconds()})
+}
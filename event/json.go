@@ -0,0 +1,26 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// NewJSONHandler returns handler which writes events to writer as newline-delimited JSON
+func NewJSONHandler(w io.Writer) Handler {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+	return func(e Event) {
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// there is nowhere to report failure to write an event
+		_ = encoder.Encode(e)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONHandlerWritesOneEventPerLine(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewJSONHandler(&buf)
+	handler(Event{Type: PhaseStarted, Phase: "terraform"})
+	handler(Event{
+		Type:     PhaseFinished,
+		Phase:    "terraform",
+		Duration: 1500 * time.Millisecond,
+		Resource: &ResourceChange{Address: "hcloud_server.web", Action: "create", Status: StatusComplete, Elapsed: 2 * time.Second},
+	})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &decoded))
+	assert.Equal(t, "phase-finished", decoded["type"])
+	assert.Equal(t, float64(1500), decoded["duration_ms"])
+	resource := decoded["resource"].(map[string]interface{})
+	assert.Equal(t, "hcloud_server.web", resource["address"])
+	assert.Equal(t, float64(2000), resource["elapsed_ms"])
+	assert.NotContains(t, lines[0], "duration_ms")
+}
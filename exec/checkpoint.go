@@ -0,0 +1,236 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const checkpointFileName = "checkpoint.json"
+
+// SetupPhases are phases of setup recorded in checkpoints, in order of execution
+var SetupPhases = []string{
+	PhaseFetch,
+	PhaseRender,
+	PhaseTerraform,
+	PhaseSSHConfig,
+	PhaseAnsibleRender,
+	PhaseAnsible,
+	PhaseChecks,
+}
+
+// checkpoint records setup phases completed with given inputs
+type checkpoint struct {
+	RunID string `json:"run_id"`
+	// Hash of configuration, including variables
+	ConfigHash string `json:"config_hash"`
+	// Commit of template repository, or hash of local template directory
+	TemplateRevision string    `json:"template_revision"`
+	Completed        []string  `json:"completed"`
+	Updated          time.Time `json:"updated"`
+}
+
+func (ec *ExecutionConfig) checkpointFilePath() string {
+	return path.Join(ec.OutputDir, checkpointFileName)
+}
+
+// validates resume, from-phase and only-phase options
+func (ec *ExecutionConfig) validatePhaseSelection() error {
+	selected := 0
+	for _, option := range []bool{ec.Resume, ec.FromPhase != "", ec.OnlyPhase != ""} {
+		if option {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return errors.New("only one of resume, from-phase and only-phase can be set")
+	}
+	for _, phase := range []string{ec.FromPhase, ec.OnlyPhase} {
+		if phase != "" && !slices.Contains(SetupPhases, phase) {
+			return fmt.Errorf("unknown setup phase '%s', expected one of %s", phase, strings.Join(SetupPhases, ", "))
+		}
+	}
+	return nil
+}
+
+// returns true if setup phase is not skipped
+func (ec *ExecutionConfig) runsPhase(phase string) bool {
+	return !ec.skippedPhases[phase]
+}
+
+// loads checkpoint of previous run, selects phases to skip and starts checkpoint of this run
+func (ec *ExecutionConfig) startCheckpoint(configHash string) error {
+	revision, err := ec.templateInputRevision()
+	if err != nil {
+		return err
+	}
+	current := &checkpoint{
+		RunID:            ec.runID(),
+		ConfigHash:       configHash,
+		TemplateRevision: revision,
+	}
+	previous, err := ec.loadCheckpoint()
+	if err != nil {
+		ec.logger().Warn().Err(err).Msg("Failed to read checkpoint of previous run")
+	}
+	var completed []string
+	if previous != nil && previous.ConfigHash == configHash && previous.TemplateRevision == revision {
+		completed = previous.Completed
+	} else if previous != nil && ec.Resume {
+		ec.logger().Warn().Msg("Configuration, template or targets changed since previous run, running all phases")
+	}
+	fromIndex := 0
+	if ec.FromPhase != "" {
+		fromIndex = slices.Index(SetupPhases, ec.FromPhase)
+	}
+	if ec.Resume {
+		fromIndex = slices.IndexFunc(SetupPhases, func(phase string) bool {
+			return !slices.Contains(completed, phase)
+		})
+		if fromIndex < 0 {
+			fromIndex = len(SetupPhases)
+			ec.logger().Info().Msg("All setup phases were completed by previous run")
+		} else {
+			ec.logger().Info().Msgf("Resuming setup from phase %s", SetupPhases[fromIndex])
+		}
+	}
+	ec.skippedPhases = map[string]bool{}
+	// templates are always fetched, since other phases need them
+	for i := 1; i < len(SetupPhases); i++ {
+		phase := SetupPhases[i]
+		if i >= fromIndex && (ec.OnlyPhase == "" || phase == ec.OnlyPhase) {
+			continue
+		}
+		ec.skippedPhases[phase] = true
+		ec.logger().Info().Msgf("Skipping phase %s", phase)
+		// skipped phases stay completed, phases which run are recorded again when they complete
+		if slices.Contains(completed, phase) {
+			current.Completed = append(current.Completed, phase)
+		}
+	}
+	ec.checkpoint = current
+	return ec.completePhase(PhaseFetch)
+}
+
+// records completed setup phase in checkpoint
+func (ec *ExecutionConfig) completePhase(phase string) error {
+	if ec.checkpoint == nil {
+		return nil
+	}
+	if !slices.Contains(ec.checkpoint.Completed, phase) {
+		ec.checkpoint.Completed = append(ec.checkpoint.Completed, phase)
+	}
+	ec.checkpoint.Updated = time.Now()
+	data, err := json.MarshalIndent(ec.checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writePrivateFile(ec.checkpointFilePath(), data)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to save checkpoint")
+	}
+	return err
+}
+
+// runs setup phase and records it in checkpoint when it succeeds
+func (ec *ExecutionConfig) runSetupPhase(phase string, fn func() error) error {
+	err := ec.runPhase(phase, fn)
+	if err != nil {
+		return err
+	}
+	return ec.completePhase(phase)
+}
+
+func (ec *ExecutionConfig) loadCheckpoint() (*checkpoint, error) {
+	data, err := os.ReadFile(ec.checkpointFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// removes checkpoint, since infrastructure it describes is gone
+func (ec *ExecutionConfig) removeCheckpoint() error {
+	err := os.Remove(ec.checkpointFilePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// returns hash of configuration, including resolved variables, and of targeted and replaced resources, since
+// phases completed for different resources can not be reused
+func (ec *ExecutionConfig) configHash() (string, error) {
+	targets := slices.Sorted(slices.Values(ec.Targets))
+	replace := slices.Sorted(slices.Values(ec.Replace))
+	data, err := yaml.Marshal(struct {
+		Config    interface{}            `yaml:"config"`
+		Variables map[string]interface{} `yaml:"variables"`
+		Stack     string                 `yaml:"stack"`
+		Targets   []string               `yaml:"targets"`
+		Replace   []string               `yaml:"replace"`
+	}{ec.Config, ec.Config.ProcessingVars, ec.StackName, targets, replace})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash configuration: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// returns commit of template repository. Local template directory does not have commit, so hash of its
+// content is used instead
+func (ec *ExecutionConfig) templateInputRevision() (string, error) {
+	if ec.templateRevision != "" {
+		return ec.templateRevision, nil
+	}
+	hash := sha256.New()
+	err := filepath.WalkDir(ec.templateDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(ec.templateDir, filePath)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, _ = io.WriteString(hash, relPath+"\x00")
+		_, err = io.Copy(hash, file)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash template directory: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
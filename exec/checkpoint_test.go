@@ -0,0 +1,128 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runs setup with Ansible failing, so that only phases before Ansible are completed
+func runFailedSetup(t *testing.T) *ExecutionConfig {
+	runner := newScriptedRunner().
+		withTerraformOutputs(`{"server_ip": {"type": "string", "value": "10.0.0.5"}}`).
+		withTransientFailure("-i inventory", "UNREACHABLE", 1)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	err := ec.ExecuteSetup()
+	assert.ErrorIs(t, err, errScripted)
+	checkpoint, err := ec.loadCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{PhaseFetch, PhaseRender, PhaseTerraform, PhaseSSHConfig, PhaseAnsibleRender}, checkpoint.Completed)
+	return ec
+}
+
+// returns execution of the same configuration as previous one
+func rerunExecution(t *testing.T, previous *ExecutionConfig, runner Runner) *ExecutionConfig {
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.ConfigFilePath = previous.ConfigFilePath
+	return ec
+}
+
+func TestExecuteSetup_ResumesFromFailedPhase(t *testing.T) {
+	previous := runFailedSetup(t)
+	runner := newScriptedRunner().withTerraformOutputs(`{"server_ip": {"type": "string", "value": "10.0.0.5"}}`)
+	ec := rerunExecution(t, previous, runner)
+	ec.Resume = true
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform output -json",
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+	}, runner.commandLines())
+	assert.Equal(t, "10.0.0.5", ec.Config.Outputs["server_ip"])
+	checkpoint, err := ec.loadCheckpoint()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, SetupPhases, checkpoint.Completed)
+}
+
+func TestExecuteSetup_ResumeRunsAllPhasesIfConfigurationChanged(t *testing.T) {
+	previous := runFailedSetup(t)
+	runner := newScriptedRunner().withTerraformOutputs(`{}`)
+	ec := rerunExecution(t, previous, runner)
+	ec.Config.ProcessingVars["server_type"] = "cx22"
+	ec.Resume = true
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform output -json",
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+	}, runner.commandLines())
+}
+
+func TestExecuteSetup_ResumeRunsAllPhasesIfTargetsChanged(t *testing.T) {
+	previous := runFailedSetup(t)
+	runner := newScriptedRunner().withTerraformOutputs(`{}`)
+	ec := rerunExecution(t, previous, runner)
+	ec.Targets = []string{"hcloud_server.web"}
+	ec.Resume = true
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -target=hcloud_server.web -json",
+	}, runner.commandLines()[:2])
+}
+
+func TestExecuteSetup_RunsOnlySelectedPhase(t *testing.T) {
+	previous := runFailedSetup(t)
+	runner := newScriptedRunner().withTerraformOutputs(`{}`)
+	ec := rerunExecution(t, previous, runner)
+	ec.OnlyPhase = PhaseTerraform
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform output -json",
+	}, runner.commandLines())
+	// completion of skipped phases is kept
+	checkpoint, err := ec.loadCheckpoint()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{PhaseFetch, PhaseRender, PhaseTerraform, PhaseSSHConfig, PhaseAnsibleRender}, checkpoint.Completed)
+}
+
+func TestExecuteSetup_RunsPhasesFromSelectedOne(t *testing.T) {
+	runner := newScriptedRunner().withTerraformOutputs(`{}`)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.FromPhase = PhaseAnsible
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform output -json",
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+	}, runner.commandLines())
+}
+
+func TestExecuteSetup_InvalidPhaseSelection(t *testing.T) {
+	ec := newHooksExecutionConfig(t, &recordingRunner{}, nil)
+	ec.FromPhase = "deploy"
+	assert.ErrorContains(t, ec.ExecuteSetup(), "unknown setup phase 'deploy'")
+
+	ec = newHooksExecutionConfig(t, &recordingRunner{}, nil)
+	ec.Resume = true
+	ec.OnlyPhase = PhaseAnsible
+	assert.Error(t, ec.ExecuteSetup())
+}
+
+func TestExecuteTeardown_RemovesCheckpoint(t *testing.T) {
+	previous := runFailedSetup(t)
+	ec := rerunExecution(t, previous, newScriptedRunner())
+	ec.KeepArtifacts = true
+	err := ec.ExecuteTeardown()
+	assert.NoError(t, err)
+	assert.NoFileExists(t, previous.checkpointFilePath())
+}
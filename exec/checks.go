@@ -0,0 +1,251 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	gotmpl "text/template"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+)
+
+const (
+	// longest wait between attempts of a check
+	maxCheckInterval = time.Minute
+	// maximum size of HTTP response body matched against expected pattern
+	maxCheckBodySize = 1 << 20
+)
+
+// CheckResult is result of single health check
+type CheckResult struct {
+	Name     string
+	Type     string
+	Target   string
+	Passed   bool
+	Attempts int
+	// Error of the last attempt, if check did not pass
+	Error string
+}
+
+// data available to templates in checks
+type checkData struct {
+	Outputs        map[string]interface{}
+	ProcessingVars map[string]interface{}
+}
+
+// returns health checks. Checks from template run before checks from configuration
+func (ec *ExecutionConfig) checks() []config.Check {
+	var result []config.Check
+	if ec.Config.TemplateConfig != nil {
+		result = append(result, ec.Config.TemplateConfig.Checks...)
+	}
+	return append(result, ec.Config.Checks...)
+}
+
+// runs health checks as separate phase. Phase fails if any check does not pass after all retries
+func (ec *ExecutionConfig) runChecks() error {
+	if !ec.runsPhase(PhaseChecks) {
+		return nil
+	}
+	checks := ec.checks()
+	if len(checks) == 0 {
+		return ec.completePhase(PhaseChecks)
+	}
+	if ec.SkipChecks {
+		ec.logger().Info().Msg("Skipping health checks")
+		return nil
+	}
+	return ec.runSetupPhase(PhaseChecks, func() error {
+		ec.logger().Info().Msgf("Running %d health checks", len(checks))
+		var errs []error
+		for _, check := range checks {
+			result := ec.runCheck(check)
+			ec.report().Checks = append(ec.report().Checks, result)
+			if result.Passed {
+				ec.logger().Info().Msgf("Check %s passed", result.Name)
+				continue
+			}
+			if err := ec.context().Err(); err != nil {
+				return err
+			}
+			ec.logger().Error().Msgf("Check %s failed after %d attempts: %s", result.Name, result.Attempts, result.Error)
+			errs = append(errs, fmt.Errorf("check %s failed: %s", result.Name, result.Error))
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// runs check until it passes or retries are exhausted, waiting longer after each failed attempt
+func (ec *ExecutionConfig) runCheck(check config.Check) CheckResult {
+	result := CheckResult{Type: check.Type}
+	resolved, err := ec.resolveCheck(check)
+	if err != nil {
+		result.Name = check.DisplayName()
+		result.Target = check.Target
+		result.Error = err.Error()
+		return result
+	}
+	result.Name = resolved.DisplayName()
+	result.Target = resolved.Target
+	interval := resolved.IntervalDuration
+	for {
+		result.Attempts++
+		err = ec.attemptCheck(resolved)
+		if err == nil {
+			result.Passed = true
+			result.Error = ""
+			return result
+		}
+		result.Error = err.Error()
+		if result.Attempts > resolved.RetryCount {
+			return result
+		}
+		ec.logger().Debug().Err(err).Msgf("Check %s failed, retrying in %s", result.Name, interval)
+		select {
+		case <-ec.context().Done():
+			return result
+		case <-time.After(interval):
+		}
+		interval = min(interval*2, maxCheckInterval)
+	}
+}
+
+// renders templates in check target and expected values
+func (ec *ExecutionConfig) resolveCheck(check config.Check) (config.Check, error) {
+	data := checkData{Outputs: ec.Config.Outputs, ProcessingVars: ec.Config.ProcessingVars}
+	// body regular expression and SSH command are used literally, since they may contain "[[" of their own,
+	// like POSIX character classes or shell tests
+	fields := []*string{&check.Name, &check.Target, &check.Address}
+	for _, field := range fields {
+		if !strings.Contains(*field, "[[") {
+			continue
+		}
+		tmpl, err := gotmpl.New("check").Delims("[[", "]]").Option("missingkey=error").Parse(*field)
+		if err != nil {
+			return check, fmt.Errorf("invalid template '%s': %w", *field, err)
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, data); err != nil {
+			return check, fmt.Errorf("failed to render '%s': %w", *field, err)
+		}
+		*field = buf.String()
+	}
+	return check, nil
+}
+
+func (ec *ExecutionConfig) attemptCheck(check config.Check) error {
+	ctx, cancel := context.WithTimeout(ec.context(), check.TimeoutDuration)
+	defer cancel()
+	switch check.Type {
+	case config.CheckTCP:
+		return checkTCP(ctx, check)
+	case config.CheckHTTP:
+		return checkHTTP(ctx, check)
+	case config.CheckDNS:
+		return checkDNS(ctx, check)
+	case config.CheckSSH:
+		return ec.checkSSH(ctx, check)
+	}
+	return fmt.Errorf("unknown check type '%s'", check.Type)
+}
+
+func checkTCP(ctx context.Context, check config.Check) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", check.Target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func checkHTTP(ctx context.Context, check config.Check) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.Target, http.NoBody)
+	if err != nil {
+		return err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if check.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+	}
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != check.Status {
+		return fmt.Errorf("expected status %d, got %d", check.Status, resp.StatusCode)
+	}
+	if check.Body == "" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCheckBodySize))
+	if err != nil {
+		return err
+	}
+	pattern, err := regexp.Compile(check.Body)
+	if err != nil {
+		return err
+	}
+	if !pattern.Match(body) {
+		return fmt.Errorf("response body does not match '%s'", check.Body)
+	}
+	return nil
+}
+
+func checkDNS(ctx context.Context, check config.Check) error {
+	addresses, err := net.DefaultResolver.LookupHost(ctx, check.Target)
+	if err != nil {
+		return err
+	}
+	if check.Address != "" && !slices.Contains(addresses, check.Address) {
+		return fmt.Errorf("%s resolves to %s, expected %s", check.Target, strings.Join(addresses, ", "), check.Address)
+	}
+	return nil
+}
+
+// runs command on target through generated SSH config, which is generated if Ansible was skipped
+func (ec *ExecutionConfig) checkSSH(ctx context.Context, check config.Check) error {
+	if ec.report().SSHConfigFile == "" {
+		if err := ec.generateSSHConfig(); err != nil {
+			return err
+		}
+	}
+	sshPath, err := ec.runner().LookPath(defaultSSHCmd)
+	if err != nil {
+		return err
+	}
+	var output bytes.Buffer
+	err = ec.runner().Run(ctx, &Command{
+		Path:   sshPath,
+		Args:   []string{"-F", ec.report().SSHConfigFile, "-o", "BatchMode=yes", check.Target, check.Command},
+		Env:    os.Environ(),
+		Stdout: &output,
+		Stderr: &output,
+	})
+	code := 0
+	if err != nil {
+		code = exitCode(err)
+		if code < 0 {
+			return err
+		}
+	}
+	if code != check.ExitCode {
+		return fmt.Errorf("expected exit code %d, got %d: %s", check.ExitCode, code, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
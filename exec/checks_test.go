@@ -0,0 +1,197 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type exitCodeError int
+
+func (e exitCodeError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitCodeError) ExitCode() int { return int(e) }
+
+// returns check with defaults and short intervals, so that failing checks finish quickly
+func newCheck(check config.Check) config.Check {
+	if check.Type == config.CheckHTTP && check.Status == 0 {
+		check.Status = http.StatusOK
+	}
+	check.RetryCount = 2
+	check.IntervalDuration = time.Millisecond
+	check.TimeoutDuration = 2 * time.Second
+	return check
+}
+
+func newChecksExecutionConfig(t *testing.T, runner Runner, checks ...config.Check) *ExecutionConfig {
+	ec := newHooksExecutionConfig(t, runner, nil)
+	for _, check := range checks {
+		ec.Config.Checks = append(ec.Config.Checks, newCheck(check))
+	}
+	return ec
+}
+
+func TestRunChecks_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	assert.NoError(t, closed.Close())
+
+	ec := newChecksExecutionConfig(t, newScriptedRunner(),
+		config.Check{Type: config.CheckTCP, Target: "[[ .Outputs.address ]]"},
+		config.Check{Name: "closed port", Type: config.CheckTCP, Target: closedAddr},
+	)
+	ec.Config.Outputs = map[string]interface{}{"address": listener.Addr().String()}
+	err = ec.runChecks()
+	assert.ErrorContains(t, err, "check closed port failed")
+	assert.Equal(t, []CheckResult{
+		{Name: "tcp " + listener.Addr().String(), Type: config.CheckTCP, Target: listener.Addr().String(), Passed: true, Attempts: 1},
+		{Name: "closed port", Type: config.CheckTCP, Target: closedAddr, Attempts: 3, Error: ec.Report.Checks[1].Error},
+	}, ec.Report.Checks)
+	assert.Contains(t, ec.Report.Checks[1].Error, "connection refused")
+	assert.True(t, ec.Report.Phases[0].Failed)
+	assert.Equal(t, PhaseChecks, ec.Report.Phases[0].Phase)
+}
+
+func TestRunChecks_HTTPRetriesUntilReady(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, `{"status": "healthy"}`)
+	}))
+	defer server.Close()
+
+	ec := newChecksExecutionConfig(t, newScriptedRunner(),
+		config.Check{Type: config.CheckHTTP, Target: server.URL + "/health", Body: `"status":\s*"healthy"`})
+	err := ec.runChecks()
+	assert.NoError(t, err)
+	assert.True(t, ec.Report.Checks[0].Passed)
+	assert.Equal(t, 3, ec.Report.Checks[0].Attempts)
+}
+
+func TestRunChecks_HTTPMismatch(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "maintenance")
+	}))
+	defer server.Close()
+
+	ec := newChecksExecutionConfig(t, newScriptedRunner(),
+		config.Check{Type: config.CheckHTTP, Target: server.URL, Status: http.StatusOK, Body: "healthy", Insecure: true},
+		config.Check{Type: config.CheckHTTP, Target: server.URL, Status: http.StatusNoContent, Insecure: true},
+		config.Check{Type: config.CheckHTTP, Target: server.URL},
+	)
+	err := ec.runChecks()
+	assert.Error(t, err)
+	assert.Equal(t, "response body does not match 'healthy'", ec.Report.Checks[0].Error)
+	assert.Equal(t, "expected status 204, got 200", ec.Report.Checks[1].Error)
+	assert.Contains(t, ec.Report.Checks[2].Error, "certificate")
+}
+
+func TestRunChecks_BodyAndCommandAreNotTemplates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "version 42")
+	}))
+	defer server.Close()
+
+	runner := newScriptedRunner()
+	ec := newChecksExecutionConfig(t, runner,
+		config.Check{Type: config.CheckHTTP, Target: "[[ .Outputs.url ]]", Body: `version [[:digit:]]+`},
+		config.Check{Type: config.CheckSSH, Target: "web", Command: "[[ -f /etc/app.conf ]]"},
+	)
+	ec.Config.Outputs = map[string]interface{}{"url": server.URL}
+	ec.Report = &Report{SSHConfigFile: filepath.Join(t.TempDir(), "config")}
+	err := ec.runChecks()
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/bin/ssh -F "+ec.Report.SSHConfigFile+" -o BatchMode=yes web [[ -f /etc/app.conf ]]",
+		runner.commandLines()[0])
+}
+
+func TestRunChecks_DNS(t *testing.T) {
+	ec := newChecksExecutionConfig(t, newScriptedRunner(),
+		config.Check{Type: config.CheckDNS, Target: "localhost"},
+		config.Check{Type: config.CheckDNS, Target: "localhost", Address: "192.0.2.1"},
+	)
+	err := ec.runChecks()
+	assert.Error(t, err)
+	assert.True(t, ec.Report.Checks[0].Passed)
+	assert.Contains(t, ec.Report.Checks[1].Error, "expected 192.0.2.1")
+}
+
+func TestRunChecks_SSH(t *testing.T) {
+	runner := newScriptedRunner().
+		withFailure("-F", exitCodeError(3))
+	ec := newChecksExecutionConfig(t, runner,
+		config.Check{Type: config.CheckSSH, Target: "web", Command: "systemctl is-active nginx", ExitCode: 3},
+		config.Check{Type: config.CheckSSH, Target: "web", Command: "systemctl is-active app"},
+	)
+	ec.Report = &Report{SSHConfigFile: filepath.Join(t.TempDir(), "config")}
+	err := ec.runChecks()
+	assert.ErrorContains(t, err, "expected exit code 0, got 3")
+	assert.True(t, ec.Report.Checks[0].Passed)
+	assert.False(t, ec.Report.Checks[1].Passed)
+	assert.Equal(t, "/usr/bin/ssh -F "+ec.Report.SSHConfigFile+" -o BatchMode=yes web systemctl is-active nginx",
+		runner.commandLines()[0])
+}
+
+func TestRunChecks_InvalidTemplate(t *testing.T) {
+	ec := newChecksExecutionConfig(t, newScriptedRunner(),
+		config.Check{Type: config.CheckTCP, Target: "[[ .Outputs.missing ]]:22"})
+	ec.Config.Outputs = map[string]interface{}{}
+	err := ec.runChecks()
+	assert.ErrorContains(t, err, "failed to render")
+	assert.Equal(t, 0, ec.Report.Checks[0].Attempts)
+}
+
+func TestExecuteSetup_FailedChecksRunFailureHooks(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, closed.Close())
+	runner := newScriptedRunner()
+	ec := newChecksExecutionConfig(t, runner, config.Check{Type: config.CheckTCP, Target: closed.Addr().String()})
+	ec.Config.Hooks = config.Hooks{config.HookOnFailure: {{Command: "./notify.sh"}}}
+	err = ec.ExecuteSetup()
+	assert.ErrorContains(t, err, "check tcp "+closed.Addr().String()+" failed")
+	lines := runner.commandLines()
+	assert.Equal(t, "/usr/bin/ansible-playbook -i inventory playbook.yaml", lines[len(lines)-2])
+	assert.Equal(t, "/usr/bin/sh -c ./notify.sh", lines[len(lines)-1])
+	assert.Contains(t, runner.commands[len(lines)-1].Env, "LIFTOFF_FAILED_PHASE=checks")
+
+	runner = newScriptedRunner()
+	ec = newChecksExecutionConfig(t, runner, config.Check{Type: config.CheckTCP, Target: closed.Addr().String()})
+	ec.SkipChecks = true
+	assert.NoError(t, ec.ExecuteSetup())
+	assert.Empty(t, ec.Report.Checks)
+}
+
+func TestExecuteSetup_FailedChecksRunAfterPostAnsibleHooks(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, closed.Close())
+	runner := newScriptedRunner()
+	ec := newChecksExecutionConfig(t, runner, config.Check{Type: config.CheckTCP, Target: closed.Addr().String()})
+	ec.Config.Hooks = config.Hooks{config.HookPostAnsible: {{Command: "./register.sh"}}}
+	err = ec.ExecuteSetup()
+	assert.ErrorContains(t, err, "check tcp "+closed.Addr().String()+" failed")
+	lines := runner.commandLines()
+	assert.Equal(t, []string{
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+		"/usr/bin/sh -c ./register.sh",
+	}, lines[len(lines)-2:])
+}
@@ -4,64 +4,254 @@
 package exec
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/bitshifted/liftoff/common"
 	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/event"
 	"github.com/bitshifted/liftoff/gitops"
 	"github.com/bitshifted/liftoff/log"
+	"github.com/bitshifted/liftoff/template"
+	"github.com/rs/zerolog"
 )
 
 const (
 	defaltTerraformCmd = "terraform"
 	defaultAnsibleCmd  = "ansible-playbook"
-	liftoffHomeDirName = ".liftoff"
+	defaultGalaxyCmd   = "ansible-galaxy"
+	liftoffHomeDirName = common.LiftoffHomeDirName
 )
 
 type ExecutionConfig struct {
-	Config              *config.Configuration
-	ConfigFilePath      string
-	SkipTerraform       bool
-	SkipAnsible         bool
+	Config         *config.Configuration
+	ConfigFilePath string
+	// Name of the stack in configuration with multiple stacks. Each stack has separate
+	// directories for generated files and Terraform data
+	StackName     string
+	SkipTerraform bool
+	SkipAnsible   bool
+	// Render Terraform templates before destroying infrastructure. Templates are always
+	// rendered if Terraform working directory does not exist
+	RenderBeforeDestroy bool
+	// Do not run template pre-destroy playbook on teardown
+	SkipPreDestroy bool
+	// Do not remove generated files and other local artifacts after teardown
+	KeepArtifacts bool
+	// Link snippet with SSH host entries into ~/.ssh/config.d
+	LinkSSHConfig bool
+	// Do not run health checks after setup
+	SkipChecks bool
+	// Skip setup phases completed by previous run, if configuration and template did not change
+	Resume bool
+	// Skip setup phases before given one
+	FromPhase string
+	// Run only given setup phase
+	OnlyPhase string
+	// Terraform resource addresses to which operations are limited
+	Targets []string
+	// Terraform resource addresses which are forced to be recreated
+	Replace []string
+	// Destroy targeted resources without asking for confirmation
+	AutoApprove bool
+	// Asks user to confirm destruction of targeted resources
+	Confirm             func(message string) (bool, error)
 	TerraformPath       string
 	AnsiblePlaybookPath string
 	TerraformWorkDir    string
 	AnsibleWorkDir      string
+	// Directory for generated files
+	OutputDir string
+	// Identifier of current run. Generated if not set
+	RunID string
+	// Per-run log to which output of external commands is copied
+	RunLog io.Writer
+	// Runner used to execute external commands. Defaults to OSRunner if not set
+	Runner Runner
+	// Context for cancelling execution. Defaults to background context
+	Context context.Context
+	// Logger for log messages. Logging is disabled if not set
+	Logger *zerolog.Logger
+	// Input of interactive commands. Defaults to standard input
+	Stdin io.Reader
+	// Destinations for output of external commands. Default to standard output and error
+	Stdout io.Writer
+	Stderr io.Writer
+	// Callback receiving progress events
+	OnEvent event.Handler
+	// If true, output of external commands is captured and attached to events, and Terraform and
+	// Ansible are run in machine readable mode, so their progress is reported as events
+	MachineReadable bool
+	// Results of the last execution
+	Report *Report
+	// output captured during current phase
+	capture *tailBuffer
+	// output of current attempt of retried step
+	attemptOutput *tailBuffer
+	currentPhase  string
+	// temporary directory with template repository clone
+	templateCloneDir string
+	// absolute path of template directory, set when templates are prepared
+	templateDir string
+	// commit of template repository checked out for this execution
+	templateRevision string
+	// setup phases completed so far, saved so that failed setup can be resumed
+	checkpoint *checkpoint
+	// setup phases which are not run
+	skippedPhases map[string]bool
+	// set when Terraform working directory was rendered and needs to be initialized
+	terraformInitRequired bool
+	// Ansible host pattern for targeted runs
+	hostLimit string
+	// set when availability of Ansible JSON callback was checked, so that check is done only once
+	jsonCallbackChecked   bool
+	jsonCallbackAvailable bool
+	// descriptions of configured Terraform providers
+	providers []config.Provider
+	// provider credentials set from aliases in configuration, as environment variables
+	credentialEnv []string
 }
 
-func (ec *ExecutionConfig) executeTerraformCommand(cmd ...string) error {
-	command := exec.Command(ec.TerraformPath, cmd...) //nolint:gosec
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-	command.Dir = ec.TerraformWorkDir
-	log.Logger.Debug().Msgf("Terraform work directory: %s", command.Dir)
-	command.Env = append(command.Env, os.Environ()...)
+func (ec *ExecutionConfig) runner() Runner {
+	if ec.Runner == nil {
+		ec.Runner = &OSRunner{}
+	}
+	return ec.Runner
+}
+
+func (ec *ExecutionConfig) context() context.Context {
+	if ec.Context == nil {
+		return context.Background()
+	}
+	return ec.Context
+}
+
+func (ec *ExecutionConfig) logger() *zerolog.Logger {
+	return log.OrNop(ec.Logger)
+}
+
+func (ec *ExecutionConfig) stdout() io.Writer {
+	if ec.capture != nil {
+		return ec.capture
+	}
+	if ec.Stdout == nil {
+		return os.Stdout
+	}
+	return ec.Stdout
+}
+
+func (ec *ExecutionConfig) stderr() io.Writer {
+	if ec.capture != nil {
+		return ec.capture
+	}
+	if ec.Stderr == nil {
+		return os.Stderr
+	}
+	return ec.Stderr
+}
+
+// looks up Terraform binary in PATH if path is not explicitly set
+func (ec *ExecutionConfig) resolveTerraformPath() error {
+	if ec.TerraformPath == "" {
+		tfCmdPath, err := ec.runner().LookPath(defaltTerraformCmd)
+		if err != nil {
+			ec.logger().Error().Err(err).Msg("Failed to lookup Terraform path")
+			return err
+		}
+		ec.TerraformPath = tfCmdPath
+	}
+	ec.logger().Debug().Msgf("Using Terraform command: %s", ec.TerraformPath)
+	return nil
+}
+
+func (ec *ExecutionConfig) terraformEnv() []string {
+	env := os.Environ()
 	tfDataDir := ec.calculateTerraformDataDir()
 	if tfDataDir != "" {
-		command.Env = append(command.Env, fmt.Sprintf("TF_DATA_DIR=%s", tfDataDir))
+		env = append(env, fmt.Sprintf("TF_DATA_DIR=%s", tfDataDir))
 	}
-	return command.Run()
+	return append(env, ec.credentialEnv...)
 }
 
-// calculates outpur directory name based on configuration file name
-func (ec *ExecutionConfig) calculateOutputDirectory() (string, error) {
-	configFileName := filepath.Base(ec.ConfigFilePath)
-	configFileExt := filepath.Ext(ec.ConfigFilePath)
-	configDir := filepath.Dir(ec.ConfigFilePath)
+func (ec *ExecutionConfig) executeTerraformCommand(cmd ...string) error {
+	return ec.runTerraform(ec.stdout(), cmd...)
+}
+
+// runs Terraform command with standard output saved only to run log, or captured for events
+func (ec *ExecutionConfig) executeTerraformQuiet(cmd ...string) error {
+	return ec.runTerraform(ec.quietStdout(), cmd...)
+}
+
+// returns destination for standard output which is saved only to run log, or captured for events
+func (ec *ExecutionConfig) quietStdout() io.Writer {
+	if ec.capture != nil {
+		return ec.capture
+	}
+	return nil
+}
+
+// runs Terraform command with JSON output, reporting resource changes as events
+func (ec *ExecutionConfig) executeTerraformJSON(cmd ...string) error {
+	lines := ec.machineOutputWriter(parseTerraformLine)
+	args := append(append([]string{}, cmd...), "-json")
+	err := ec.runTerraform(lines, args...)
+	lines.Flush()
+	return err
+}
+
+func (ec *ExecutionConfig) runTerraform(stdout io.Writer, cmd ...string) error {
+	ec.logger().Debug().Msgf("Terraform work directory: %s", ec.TerraformWorkDir)
+	return ec.runLogged("terraform-"+cmd[0], &Command{
+		Path:   ec.TerraformPath,
+		Args:   cmd,
+		Env:    ec.terraformEnv(),
+		Dir:    ec.TerraformWorkDir,
+		Stdout: stdout,
+		Stderr: ec.stderr(),
+	})
+}
+
+// OutputDirPath returns path of directory for generated files. It is located next to configuration
+// file and named after it
+func OutputDirPath(configFilePath string) string {
+	configFileName := filepath.Base(configFilePath)
+	configFileExt := filepath.Ext(configFilePath)
+	configDir := filepath.Dir(configFilePath)
 	// strip extension
 	genDirName := strings.Replace(configFileName, configFileExt, "", 1)
-	log.Logger.Debug().Msgf("Directory for generated files: %s", genDirName)
+	return path.Join(configDir, genDirName)
+}
+
+// StackOutputDirPath returns path of directory for generated files of a stack. For configuration
+// without stacks, stack name is empty and it is the same as OutputDirPath
+func StackOutputDirPath(configFilePath, stackName string) string {
+	if stackName != "" {
+		return path.Join(OutputDirPath(configFilePath), stackName)
+	}
+	return OutputDirPath(configFilePath)
+}
+
+// returns directory for generated files of this execution
+func (ec *ExecutionConfig) outputDirPath() string {
+	return StackOutputDirPath(ec.ConfigFilePath, ec.StackName)
+}
+
+// calculates outpur directory name based on configuration file name
+func (ec *ExecutionConfig) calculateOutputDirectory() (string, error) {
+	genDirPath := ec.outputDirPath()
+	ec.logger().Debug().Msgf("Directory for generated files: %s", genDirPath)
 	// create directory
-	genDirPath := path.Join(configDir, genDirName)
 	err := os.MkdirAll(genDirPath, os.ModePerm)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to create directory for generated files")
+		ec.logger().Error().Err(err).Msg("Failed to create directory for generated files")
 		return "", err
 	}
 	return genDirPath, nil
@@ -71,24 +261,28 @@ func (ec *ExecutionConfig) templateDirAbsPath() (string, error) {
 	repo := ec.Config.TemplateRepo
 	tmplDirAbsPath := ""
 	if repo == "" {
-		log.Logger.Info().Msg("Template repository not specified")
+		ec.logger().Info().Msg("Template repository not specified")
 	} else {
 		tmpDir, err := os.MkdirTemp("", "template_repo")
 		if err != nil {
-			log.Logger.Error().Err(err).Msg("Failed to create temprorary directory for clone")
+			ec.logger().Error().Err(err).Msg("Failed to create temprorary directory for clone")
 			return "", err
 		}
 		tmplDirAbsPath = tmpDir
-		log.Logger.Info().Msgf("Cloning template repository %s to %s", repo, tmplDirAbsPath)
+		ec.templateCloneDir = tmpDir
+		ec.logger().Info().Msgf("Cloning template repository %s to %s", repo, tmplDirAbsPath)
 		handler := gitops.GitHandler{
 			URL:         repo,
 			Version:     ec.Config.TempateVersion,
 			Destination: tmpDir,
+			Progress:    ec.stdout(),
+			Logger:      ec.Logger,
 		}
 		err = handler.Fetch()
 		if err != nil {
 			return "", err
 		}
+		ec.templateRevision = handler.Commit
 	}
 	if ec.Config.TemplateDir != "" {
 		tmplDirAbsPath = path.Join(tmplDirAbsPath, ec.Config.TemplateDir)
@@ -96,19 +290,113 @@ func (ec *ExecutionConfig) templateDirAbsPath() (string, error) {
 	return tmplDirAbsPath, nil
 }
 
+// fetches templates, loads template configuration and sets up working directories
+func (ec *ExecutionConfig) prepareTemplates() (*template.TemplateProcessor, error) {
+	var processor *template.TemplateProcessor
+	err := ec.runPhase(PhaseFetch, func() error {
+		tmplDir, err := ec.templateDirAbsPath()
+		if err != nil {
+			ec.logger().Error().Err(err).Msg("Failed to get template directory path")
+			return err
+		}
+		if tmplDir == "" {
+			return errors.New("either template repository or template directory must be specified")
+		}
+		ec.logger().Info().Msgf("Template directory: %s", tmplDir)
+		ec.templateDir = tmplDir
+		tmplConfig, err := config.LoadTemplateConfig(tmplDir, ec.logger())
+		if err != nil {
+			ec.logger().Error().Err(err).Msgf("Failed to load template configuration: %s", err.Error())
+			return err
+		}
+		ec.Config.TemplateConfig = tmplConfig
+		if err = ec.Config.ApplyTemplateIncludes(tmplDir); err != nil {
+			ec.logger().Error().Err(err).Msg("Failed to load files included from template")
+			return err
+		}
+		if err = ec.resolveProviders(tmplDir); err != nil {
+			ec.logger().Error().Err(err).Msg("Failed to resolve Terraform providers")
+			return err
+		}
+		output, err := ec.calculateOutputDirectory()
+		if err != nil {
+			return err
+		}
+		ec.OutputDir = output
+		ec.TerraformWorkDir = path.Join(output, common.DefaultTerraformDir)
+		ec.AnsibleWorkDir = path.Join(output, common.DefaultAnsibleDir)
+		processor = &template.TemplateProcessor{
+			BaseDir:   tmplDir,
+			OutputDir: output,
+			Logger:    ec.Logger,
+			OnFileRendered: func(templatePath, outputPath string, changed bool) {
+				ec.emit(event.Event{
+					Type: event.TemplateRendered,
+					Data: map[string]interface{}{
+						"template": templatePath,
+						"file":     outputPath,
+						"changed":  changed,
+					},
+				})
+			},
+		}
+		return nil
+	})
+	return processor, err
+}
+
+func (ec *ExecutionConfig) renderTerraformTemplates(processor *template.TemplateProcessor) error {
+	ec.logger().Info().Msg("Processing Terraform templates...")
+	err := processor.ProcessTerraformTemplates(ec.Config)
+	ec.report().ChangedFiles = append(ec.report().ChangedFiles, processor.ChangedFiles()...)
+	if err != nil {
+		return err
+	}
+	if err = ec.writeRequiredProviders(); err != nil {
+		return err
+	}
+	return ec.writeTerraformVariables()
+}
+
+func (ec *ExecutionConfig) renderAnsibleTemplates(processor *template.TemplateProcessor) error {
+	ec.logger().Info().Msg("Processing Ansible configuration...")
+	err := processor.ProcessAnsibleTemplates(ec.Config)
+	ec.report().ChangedFiles = append(ec.report().ChangedFiles, processor.ChangedFiles()...)
+	return err
+}
+
+// returns per-configuration data directory in ~/.liftoff, used as Terraform data directory and for SSH files.
+// Directory is named after configuration file and stack, with hash of absolute configuration file path
 func (ec *ExecutionConfig) calculateTerraformDataDir() string {
+	configPath, err := filepath.Abs(ec.ConfigFilePath)
+	if err != nil {
+		configPath = ec.ConfigFilePath
+	}
+	hash := sha256.Sum256([]byte(configPath))
+	tfDataDirPath := ec.dataDirPath(hex.EncodeToString(hash[:])[0:16])
+	ec.logger().Debug().Msgf("Terraform data directory: %s", tfDataDirPath)
+	return tfDataDirPath
+}
+
+// returns data directory used by previous versions. Its name was derived from first bytes of configuration file
+// path instead of its hash, so it may be shared by several configurations
+func (ec *ExecutionConfig) legacyTerraformDataDir() string {
+	hash := sha256.New().Sum([]byte(ec.ConfigFilePath))
+	return ec.dataDirPath(hex.EncodeToString(hash)[0:8])
+}
+
+func (ec *ExecutionConfig) dataDirPath(suffix string) string {
 	configFileName := filepath.Base(ec.ConfigFilePath)
 	configFileExt := filepath.Ext(ec.ConfigFilePath)
 	// strip extension
 	strippedFileName := strings.Replace(configFileName, configFileExt, "", 1)
-	hash := sha256.New().Sum([]byte(ec.ConfigFilePath))
-	resultFileName := fmt.Sprintf("%s-%s", strippedFileName, hex.EncodeToString(hash)[0:8])
+	if ec.StackName != "" {
+		strippedFileName = strippedFileName + "-" + ec.StackName
+	}
 	homeDirPath, err := os.UserHomeDir()
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to get user home directory")
+		ec.logger().Error().Err(err).Msg("Failed to get user home directory")
 		return ""
 	}
-	tfDataDirPath := path.Join(homeDirPath, liftoffHomeDirName, resultFileName)
-	log.Logger.Debug().Msgf("Terraform data directory: %s", tfDataDirPath)
-	return tfDataDirPath
+	return path.Join(homeDirPath, liftoffHomeDirName, fmt.Sprintf("%s-%s", strippedFileName, suffix))
 }
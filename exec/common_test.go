@@ -4,6 +4,8 @@
 package exec
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"strings"
@@ -74,3 +76,21 @@ func (ts *ExecutionConfigTestSuite) TestTemplateDirAbsPath_NoRepo() {
 	ts.NoError(err)
 	ts.Equal("", tmplDir)
 }
+
+func (ts *ExecutionConfigTestSuite) TestCalculateTerraformDataDir_UniquePerConfigPath() {
+	homeDir := ts.T().TempDir()
+	ts.T().Setenv("HOME", homeDir)
+	first := &ExecutionConfig{ConfigFilePath: "/home/alice/proj1/liftoff.yaml"}
+	second := &ExecutionConfig{ConfigFilePath: "/home/alice/proj2/liftoff.yaml"}
+	ts.Equal(filepath.Join(homeDir, ".liftoff", "liftoff-"+configPathHash("/home/alice/proj1/liftoff.yaml")),
+		first.calculateTerraformDataDir())
+	ts.NotEqual(first.calculateTerraformDataDir(), second.calculateTerraformDataDir())
+	// previous versions used the same directory for both configurations
+	ts.Equal(first.legacyTerraformDataDir(), second.legacyTerraformDataDir())
+}
+
+// returns first 16 hex characters of SHA-256 hash of configuration file path
+func configPathHash(configPath string) string {
+	hash := sha256.Sum256([]byte(configPath))
+	return hex.EncodeToString(hash[:])[0:16]
+}
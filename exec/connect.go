@@ -0,0 +1,201 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/bitshifted/liftoff/progress"
+)
+
+const (
+	// SSHHostsFileName is the name of file in directory for generated files, in which hosts from
+	// SSH config are stored
+	SSHHostsFileName = "ssh_hosts.json"
+
+	defaultSSHCmd = "ssh"
+)
+
+// RemoteResult is result of running command on single host
+type RemoteResult struct {
+	Host string
+	Err  error
+}
+
+// saves hosts in directory for generated files, so that they are available without Terraform
+func (ec *ExecutionConfig) saveSSHHosts(hosts []SSHHost) error {
+	if ec.OutputDir == "" {
+		return nil
+	}
+	if hosts == nil {
+		hosts = []SSHHost{}
+	}
+	data, err := json.MarshalIndent(hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path.Join(ec.OutputDir, SSHHostsFileName), data, 0o600)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to save SSH hosts")
+	}
+	return err
+}
+
+// loads stored hosts. Returns false if hosts were not stored
+func (ec *ExecutionConfig) loadSSHHosts() ([]SSHHost, bool, error) {
+	data, err := os.ReadFile(path.Join(ec.OutputDir, SSHHostsFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var hosts []SSHHost
+	if err = json.Unmarshal(data, &hosts); err != nil {
+		return nil, false, fmt.Errorf("invalid stored SSH hosts: %w", err)
+	}
+	return hosts, true, nil
+}
+
+// ExecuteSSHConfig generates SSH config for connecting to provisioned hosts. Hosts stored by the last
+// setup are used, or they are collected from Terraform outputs if they were not stored
+func (ec *ExecutionConfig) ExecuteSSHConfig() error {
+	ec.Report = &Report{}
+	ec.OutputDir = ec.outputDirPath()
+	hosts, found, err := ec.loadSSHHosts()
+	if err != nil {
+		return err
+	}
+	if found {
+		return ec.writeSSHConfig(hosts)
+	}
+	ec.logger().Debug().Msg("SSH hosts are not stored, collecting Terraform outputs")
+	err = ec.ExecuteOutputs()
+	if err != nil {
+		return err
+	}
+	return ec.generateSSHConfig()
+}
+
+// ExecuteSSH opens SSH session to the host, or runs command on it if one is given. Host is either alias
+// of host from SSH config, or any address reachable with default settings
+func (ec *ExecutionConfig) ExecuteSSH(host string, command []string) error {
+	err := ec.ExecuteSSHConfig()
+	if err != nil {
+		return err
+	}
+	sshPath, err := ec.runner().LookPath(defaultSSHCmd)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to lookup ssh path")
+		return err
+	}
+	return ec.runner().Run(ec.context(), &Command{
+		Path:   sshPath,
+		Args:   append([]string{"-F", ec.Report.SSHConfigFile, host}, command...),
+		Env:    os.Environ(),
+		Stdin:  ec.stdin(),
+		Stdout: ec.stdout(),
+		Stderr: ec.stderr(),
+	})
+}
+
+// ExecuteRemoteCommand runs command on all hosts matching the pattern, at most parallelism hosts at a time.
+// Output of each host is prefixed with its alias. Returns results for all matched hosts
+func (ec *ExecutionConfig) ExecuteRemoteCommand(pattern string, command []string, parallelism int) ([]RemoteResult, error) {
+	err := ec.ExecuteSSHConfig()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := MatchSSHHosts(ec.Report.SSHHosts, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts match pattern '%s'", pattern)
+	}
+	sshPath, err := ec.runner().LookPath(defaultSSHCmd)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to lookup ssh path")
+		return nil, err
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ec.logger().Info().Msgf("Running command on %d hosts", len(hosts))
+	results := make([]RemoteResult, len(hosts))
+	var stdoutMu, stderrMu sync.Mutex
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			stdout := progress.NewPrefixWriter(ec.stdout(), &stdoutMu, host.Alias, i, colorEnabled(ec.stdout()))
+			stderr := progress.NewPrefixWriter(ec.stderr(), &stderrMu, host.Alias, i, colorEnabled(ec.stderr()))
+			err := ec.runner().Run(ec.context(), &Command{
+				Path:   sshPath,
+				Args:   append([]string{"-F", ec.Report.SSHConfigFile, "-o", "BatchMode=yes", host.Alias}, command...),
+				Env:    os.Environ(),
+				Stdout: stdout,
+				Stderr: stderr,
+			})
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+			results[i] = RemoteResult{Host: host.Alias, Err: err}
+		}()
+	}
+	wg.Wait()
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			ec.logger().Error().Err(result.Err).Msgf("Command failed on host %s", result.Host)
+			errs = append(errs, fmt.Errorf("%s: %w", result.Host, result.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// MatchSSHHosts returns hosts whose alias or address matches any of comma separated glob patterns
+func MatchSSHHosts(hosts []SSHHost, pattern string) ([]SSHHost, error) {
+	patterns := strings.Split(pattern, ",")
+	var matched []SSHHost
+	for _, host := range hosts {
+		for _, p := range patterns {
+			p = strings.TrimSpace(p)
+			aliasMatch, err := path.Match(p, host.Alias)
+			if err != nil {
+				return nil, fmt.Errorf("invalid host pattern '%s': %w", p, err)
+			}
+			addressMatch, _ := path.Match(p, host.Address)
+			if aliasMatch || addressMatch {
+				matched = append(matched, host)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+func (ec *ExecutionConfig) stdin() io.Reader {
+	if ec.Stdin == nil {
+		return os.Stdin
+	}
+	return ec.Stdin
+}
+
+func colorEnabled(w io.Writer) bool {
+	if f, ok := w.(*os.File); ok {
+		return progress.ColorEnabled(f)
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitshifted/liftoff/common"
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const storedSSHHosts = `[
+  {"alias": "web-1", "address": "10.0.0.11", "port": 22},
+  {"alias": "web-2", "address": "10.0.0.12", "port": 22},
+  {"alias": "db", "address": "10.0.1.5", "port": 22}
+]`
+
+func newConnectExecutionConfig(t *testing.T, runner Runner) (*ExecutionConfig, *bytes.Buffer) {
+	t.Setenv("HOME", t.TempDir())
+	var stdout bytes.Buffer
+	ec := &ExecutionConfig{
+		Config: &config.Configuration{
+			ProcessingVars: map[string]interface{}{"ansible_user": "ansible"},
+		},
+		ConfigFilePath: filepath.Join(t.TempDir(), "liftoff.yaml"),
+		Runner:         runner,
+		Stdout:         &stdout,
+		Stderr:         &bytes.Buffer{},
+	}
+	assert.NoError(t, os.MkdirAll(ec.outputDirPath(), 0o755))
+	return ec, &stdout
+}
+
+func TestExecuteRemoteCommand_RunsOnMatchingHosts(t *testing.T) {
+	runner := newScriptedRunner()
+	ec, stdout := newConnectExecutionConfig(t, runner)
+	assert.NoError(t, os.WriteFile(filepath.Join(ec.outputDirPath(), SSHHostsFileName), []byte(storedSSHHosts), 0o600))
+	sshConfig := ec.sshConfigFilePath()
+	runner.withOutput("-F "+sshConfig+" -o BatchMode=yes web-1 ", "up 3 days\n").
+		withFailure("-F "+sshConfig+" -o BatchMode=yes web-2 ", errScripted)
+
+	results, err := ec.ExecuteRemoteCommand("web-*", []string{"uptime", "-p"}, 2)
+	assert.ErrorContains(t, err, "web-2: scripted failure")
+	assert.Equal(t, []RemoteResult{{Host: "web-1"}, {Host: "web-2", Err: errScripted}}, results)
+	assert.ElementsMatch(t, []string{
+		"/usr/bin/ssh -F " + sshConfig + " -o BatchMode=yes web-1 uptime -p",
+		"/usr/bin/ssh -F " + sshConfig + " -o BatchMode=yes web-2 uptime -p",
+	}, runner.commandLines())
+	assert.Equal(t, "[web-1] up 3 days\n", stdout.String())
+	assert.FileExists(t, sshConfig)
+}
+
+func TestExecuteRemoteCommand_NoMatchingHosts(t *testing.T) {
+	ec, _ := newConnectExecutionConfig(t, newScriptedRunner())
+	assert.NoError(t, os.WriteFile(filepath.Join(ec.outputDirPath(), SSHHostsFileName), []byte(storedSSHHosts), 0o600))
+	_, err := ec.ExecuteRemoteCommand("cache-*", []string{"uptime"}, 1)
+	assert.ErrorContains(t, err, "no hosts match pattern 'cache-*'")
+}
+
+func TestExecuteSSH_CollectsHostsFromOutputs(t *testing.T) {
+	runner := newScriptedRunner().withTerraformOutputs(
+		`{"ssh_hosts": {"value": {"db": {"address": "10.0.1.5", "user": "postgres"}}}}`)
+	ec, _ := newConnectExecutionConfig(t, runner)
+	ec.TerraformPath = "/usr/bin/terraform"
+	assert.NoError(t, os.MkdirAll(filepath.Join(ec.outputDirPath(), common.DefaultTerraformDir), 0o755))
+
+	err := ec.ExecuteSSH("db", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform output -json",
+		"/usr/bin/ssh -F " + ec.sshConfigFilePath() + " db",
+	}, runner.commandLines())
+	assert.Equal(t, "postgres", ec.Report.SSHHosts[0].User)
+	// hosts are stored for following commands
+	assert.FileExists(t, filepath.Join(ec.outputDirPath(), SSHHostsFileName))
+	content, err := os.ReadFile(ec.sshConfigFilePath())
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Host db\nHostName 10.0.1.5\nUser postgres\n")
+}
+
+func TestMatchSSHHosts(t *testing.T) {
+	hosts := []SSHHost{
+		{Alias: "web-1", Address: "10.0.0.11"},
+		{Alias: "web-2", Address: "10.0.0.12"},
+		{Alias: "db", Address: "10.0.1.5"},
+	}
+	matched, err := MatchSSHHosts(hosts, "db, web-2")
+	assert.NoError(t, err)
+	assert.Equal(t, []SSHHost{hosts[1], hosts[2]}, matched)
+	matched, err = MatchSSHHosts(hosts, "10.0.0.*")
+	assert.NoError(t, err)
+	assert.Equal(t, hosts[:2], matched)
+	matched, err = MatchSSHHosts(hosts, "*")
+	assert.NoError(t, err)
+	assert.Len(t, matched, 3)
+	_, err = MatchSSHHosts(hosts, "web-[")
+	assert.ErrorContains(t, err, "invalid host pattern")
+}
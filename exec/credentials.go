@@ -0,0 +1,50 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bitshifted/liftoff/config"
+)
+
+// ErrMissingCredentials is returned when credentials required by Terraform providers are not available
+var ErrMissingCredentials = errors.New("missing provider credentials")
+
+// checks that credentials of all configured providers are available, and resolves credentials
+// aliased in configuration, which are passed to Terraform as environment variables. All missing
+// credentials are reported together
+func (ec *ExecutionConfig) checkCredentials() error {
+	if ec.Config.Terraform == nil {
+		return nil
+	}
+	providers, err := ec.credentialProviders()
+	if err != nil {
+		return err
+	}
+	env, missing := ec.Config.Terraform.ResolveCredentials(providers)
+	ec.credentialEnv = env
+	if len(missing) > 0 {
+		for _, msg := range missing {
+			ec.logger().Error().Msgf("Missing credentials: %s", msg)
+		}
+		return fmt.Errorf("%w:\n  %s", ErrMissingCredentials, strings.Join(missing, "\n  "))
+	}
+	return nil
+}
+
+// returns configured providers. If template was not fetched, providers are looked up in built-in
+// providers, and unknown ones are skipped
+func (ec *ExecutionConfig) credentialProviders() ([]config.Provider, error) {
+	if ec.providers != nil {
+		return ec.providers, nil
+	}
+	registry, err := config.DefaultProviderRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return ec.Config.Terraform.KnownProviders(registry), nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCredentials_ReportsAllMissing(t *testing.T) {
+	t.Setenv("HCLOUD_TOKEN", "")
+	t.Setenv("CLOUDFLARE_API_TOKEN", "")
+	t.Setenv("CREDENTIALS_TEST_ALIAS", "")
+	ec := &ExecutionConfig{
+		Config: &config.Configuration{
+			Terraform: &config.Terraform{
+				Providers:   []string{"hcloud", "cloudflare"},
+				Credentials: map[string]string{"TF_VAR_extra": "fromenv:CREDENTIALS_TEST_ALIAS"},
+			},
+		},
+		providers: []config.Provider{
+			{Name: "hcloud", EnvVars: []string{"HCLOUD_TOKEN"}},
+			{Name: "cloudflare", EnvVars: []string{"CLOUDFLARE_API_TOKEN"}},
+			{Name: "custom", CredentialFiles: []string{filepath.Join(t.TempDir(), "credentials")}},
+		},
+	}
+	err := ec.checkCredentials()
+	assert.ErrorIs(t, err, ErrMissingCredentials)
+	assert.ErrorContains(t, err, "TF_VAR_extra is set from fromenv:CREDENTIALS_TEST_ALIAS")
+	assert.ErrorContains(t, err, "hcloud: environment variable HCLOUD_TOKEN is not set")
+	assert.ErrorContains(t, err, "cloudflare: environment variable CLOUDFLARE_API_TOKEN is not set")
+	assert.ErrorContains(t, err, "custom: credentials file")
+}
+
+func TestCheckCredentials_ResolvesAliases(t *testing.T) {
+	t.Setenv("HCLOUD_TOKEN", "")
+	t.Setenv("PROD_HCLOUD_TOKEN", "prod-token")
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(t, os.WriteFile(credentialsFile, []byte("secret"), 0o600))
+	ec := &ExecutionConfig{
+		Config: &config.Configuration{
+			Terraform: &config.Terraform{
+				Providers:   []string{"hcloud"},
+				Credentials: map[string]string{"HCLOUD_TOKEN": "fromenv:PROD_HCLOUD_TOKEN"},
+			},
+		},
+		providers: []config.Provider{
+			{Name: "hcloud", EnvVars: []string{"HCLOUD_TOKEN"}, CredentialFiles: []string{credentialsFile}},
+		},
+		ConfigFilePath: "/path/to/liftoff.yaml",
+	}
+	err := ec.checkCredentials()
+	assert.NoError(t, err)
+	assert.Contains(t, ec.terraformEnv(), "HCLOUD_TOKEN=prod-token")
+}
+
+func TestCheckCredentials_AcceptsAnyCredentialSource(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	provider := config.Provider{Name: "aws", CredentialSources: []config.CredentialSource{
+		{EnvVars: []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}},
+		{EnvVars: []string{"AWS_PROFILE"}},
+		{CredentialFiles: []string{credentialsFile}},
+	}}
+	ec := &ExecutionConfig{
+		Config: &config.Configuration{
+			Terraform: &config.Terraform{Providers: []string{"aws"}},
+		},
+		providers: []config.Provider{provider},
+	}
+	err := ec.checkCredentials()
+	assert.ErrorIs(t, err, ErrMissingCredentials)
+	assert.ErrorContains(t, err, "aws: no credentials found, provide one of: environment variables AWS_ACCESS_KEY_ID, "+
+		"AWS_SECRET_ACCESS_KEY; environment variable AWS_PROFILE; credentials file "+credentialsFile)
+
+	// one of access keys is not enough
+	t.Setenv("AWS_ACCESS_KEY_ID", "key-id")
+	assert.ErrorIs(t, ec.checkCredentials(), ErrMissingCredentials)
+	assert.NoError(t, os.WriteFile(credentialsFile, []byte("[default]"), 0o600))
+	assert.NoError(t, ec.checkCredentials())
+	assert.NoError(t, os.Remove(credentialsFile))
+	t.Setenv("AWS_PROFILE", "prod")
+	assert.NoError(t, ec.checkCredentials())
+}
+
+func TestCheckCredentials_UsesBuiltinProvidersWithoutTemplate(t *testing.T) {
+	t.Setenv("DIGITALOCEAN_TOKEN", "")
+	ec := &ExecutionConfig{
+		Config: &config.Configuration{
+			Terraform: &config.Terraform{Providers: []string{"digitalocean", "template-provider"}},
+		},
+	}
+	err := ec.checkCredentials()
+	assert.ErrorContains(t, err, "DIGITALOCEAN_TOKEN")
+	assert.NotContains(t, err.Error(), "template-provider")
+}
+
+func TestExecuteSetup_MissingCredentialsFailsBeforeRendering(t *testing.T) {
+	t.Setenv("HCLOUD_TOKEN", "")
+	ec := newProvidersExecutionConfig(t, "hcloud")
+	ec.SkipTerraform = false
+	err := ec.ExecuteSetup()
+	assert.ErrorIs(t, err, ErrMissingCredentials)
+	assert.NoFileExists(t, filepath.Join(ec.TerraformWorkDir, "main.tf"))
+	assert.Equal(t, PhasePreflight, ec.Report.Phases[len(ec.Report.Phases)-1].Phase)
+	assert.Empty(t, ec.Runner.(*scriptedRunner).commandLines())
+}
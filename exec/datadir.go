@@ -0,0 +1,67 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// prepares Terraform data directory before Terraform is run. Data directory of previous versions is copied, so
+// that existing deployments keep their providers, modules, workspace and backend selection. If there is no data
+// directory, Terraform init is required before other commands
+func (ec *ExecutionConfig) prepareTerraformDataDir() error {
+	dataDir := ec.calculateTerraformDataDir()
+	if dataDir == "" || dirExists(dataDir) {
+		return nil
+	}
+	legacyDir := ec.legacyTerraformDataDir()
+	if legacyDir == "" || !dirExists(legacyDir) {
+		ec.terraformInitRequired = true
+		return nil
+	}
+	// legacy directory may be shared with other configurations, so it is copied and not moved
+	ec.logger().Info().Msgf("Copying Terraform data directory %s of previous version to %s", legacyDir, dataDir)
+	err := copyDir(legacyDir, dataDir)
+	if err != nil {
+		ec.logger().Error().Err(err).Msgf("Failed to copy Terraform data directory %s", legacyDir)
+		_ = os.RemoveAll(dataDir)
+		return err
+	}
+	return nil
+}
+
+// copies directory recursively, keeping file modes and symbolic links
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(srcPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, relPath)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(dstPath, info.Mode().Perm())
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(srcPath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dstPath)
+		}
+		data, err := os.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dstPath, data, info.Mode().Perm())
+	})
+}
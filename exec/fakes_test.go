@@ -0,0 +1,130 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// recordingRunner records all executed commands without running them
+type recordingRunner struct {
+	mu       sync.Mutex
+	commands []Command
+}
+
+func (r *recordingRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (r *recordingRunner) Run(_ context.Context, cmd *Command) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, *cmd)
+	return nil
+}
+
+// returns command lines of recorded commands, in "path arg1 arg2..." format
+func (r *recordingRunner) commandLines() []string {
+	lines := make([]string, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("%s %s", cmd.Path, strings.Join(cmd.Args, " "))))
+	}
+	return lines
+}
+
+// scriptedResponse is canned response for commands starting with prefix
+type scriptedResponse struct {
+	prefix string
+	stdout string
+	stderr string
+	err    error
+	// if positive, response is returned only this many times
+	times int
+}
+
+// scriptedRunner returns canned responses for commands, matched by command line prefix (without binary path).
+// If several prefixes match, response with the longest one is used
+type scriptedRunner struct {
+	recordingRunner
+	responses []scriptedResponse
+}
+
+func newScriptedRunner() *scriptedRunner {
+	return &scriptedRunner{}
+}
+
+// sets response for commands starting with its prefix, replacing previous response with the same prefix
+func (r *scriptedRunner) respond(response scriptedResponse) *scriptedRunner {
+	for i := range r.responses {
+		if r.responses[i].prefix == response.prefix {
+			r.responses[i] = response
+			return r
+		}
+	}
+	r.responses = append(r.responses, response)
+	return r
+}
+
+// sets canned JSON returned by "terraform output -json"
+func (r *scriptedRunner) withTerraformOutputs(outputs string) *scriptedRunner {
+	return r.respond(scriptedResponse{prefix: "output -json", stdout: outputs})
+}
+
+// sets canned standard output for commands starting with args
+func (r *scriptedRunner) withOutput(args, stdout string) *scriptedRunner {
+	return r.respond(scriptedResponse{prefix: args, stdout: stdout})
+}
+
+func (r *scriptedRunner) withFailure(args string, err error) *scriptedRunner {
+	return r.respond(scriptedResponse{prefix: args, err: err})
+}
+
+// sets failure with standard error output returned only for first given number of commands starting with args
+func (r *scriptedRunner) withTransientFailure(args, stderr string, times int) *scriptedRunner {
+	return r.respond(scriptedResponse{prefix: args, stderr: stderr, err: errScripted, times: times})
+}
+
+// returns index of response with the longest prefix matching args, or -1 if none matches
+func (r *scriptedRunner) match(args string) int {
+	index := -1
+	for i, response := range r.responses {
+		if strings.HasPrefix(args, response.prefix) && (index < 0 || len(response.prefix) > len(r.responses[index].prefix)) {
+			index = i
+		}
+	}
+	return index
+}
+
+func (r *scriptedRunner) Run(ctx context.Context, cmd *Command) error {
+	_ = r.recordingRunner.Run(ctx, cmd)
+	index := r.match(strings.Join(cmd.Args, " "))
+	if index < 0 {
+		return nil
+	}
+	response := r.responses[index]
+	if response.times > 0 {
+		r.responses[index].times--
+		if r.responses[index].times == 0 {
+			r.responses = append(r.responses[:index], r.responses[index+1:]...)
+		}
+	}
+	if response.stderr != "" && cmd.Stderr != nil {
+		if _, err := io.WriteString(cmd.Stderr, response.stderr); err != nil {
+			return err
+		}
+	}
+	if response.stdout != "" && cmd.Stdout != nil {
+		if _, err := io.WriteString(cmd.Stdout, response.stdout); err != nil {
+			return err
+		}
+	}
+	return response.err
+}
+
+var errScripted = errors.New("scripted failure")
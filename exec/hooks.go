@@ -0,0 +1,209 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bitshifted/liftoff/config"
+)
+
+const (
+	// PhaseHooks is prefix of phases running hooks, like "hooks:pre-terraform"
+	PhaseHooks = "hooks"
+	// HookOutputEnvPrefix is prefix of environment variables holding values of non-sensitive outputs
+	HookOutputEnvPrefix = "LIFTOFF_OUTPUT_"
+	defaultShellCmd     = "sh"
+)
+
+// HookInput is written to standard input of hooks as JSON. Unlike environment variables, it includes values
+// of sensitive outputs
+type HookInput struct {
+	Hook             string                 `json:"hook"`
+	RunID            string                 `json:"run_id"`
+	ConfigFile       string                 `json:"config_file"`
+	Stack            string                 `json:"stack,omitempty"`
+	OutputDir        string                 `json:"output_dir,omitempty"`
+	Outputs          map[string]interface{} `json:"outputs"`
+	SensitiveOutputs []string               `json:"sensitive_outputs,omitempty"`
+	// Phase which failed and its error, for on-failure hooks
+	FailedPhase string `json:"failed_phase,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// hook together with directory in which it runs
+type hookCommand struct {
+	hook config.Hook
+	dir  string
+}
+
+// returns hooks for execution point. Hooks from template run before hooks from configuration
+func (ec *ExecutionConfig) hooks(point string) []hookCommand {
+	var result []hookCommand
+	if ec.Config.TemplateConfig != nil {
+		for _, hook := range ec.Config.TemplateConfig.Hooks[point] {
+			result = append(result, hookCommand{hook: hook, dir: ec.templateDir})
+		}
+	}
+	for _, hook := range ec.Config.Hooks[point] {
+		result = append(result, hookCommand{hook: hook, dir: filepath.Dir(ec.ConfigFilePath)})
+	}
+	return result
+}
+
+// runs hooks for execution point as separate phase. Hook failure stops execution, unless failure policy
+// of the hook is to continue
+func (ec *ExecutionConfig) runHooks(point string) error {
+	hooks := ec.hooks(point)
+	if len(hooks) == 0 {
+		return nil
+	}
+	return ec.runPhase(PhaseHooks+":"+point, func() error {
+		input := ec.hookInput(point)
+		for _, cmd := range hooks {
+			err := ec.runHook(ec.context(), cmd, input)
+			if err == nil {
+				continue
+			}
+			if cmd.hook.FailurePolicy == config.HookFailurePolicyContinue {
+				ec.logger().Warn().Err(err).Msgf("Hook %s failed, continuing", cmd.hook.DisplayName())
+				continue
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// runs on-failure hooks if execution failed, and returns original error. Hooks run even if execution was
+// cancelled, and their failures are only logged
+func (ec *ExecutionConfig) runFailureHooks(execErr error) error {
+	if execErr == nil {
+		return nil
+	}
+	hooks := ec.hooks(config.HookOnFailure)
+	if len(hooks) == 0 {
+		return execErr
+	}
+	input := ec.hookInput(config.HookOnFailure)
+	input.Error = execErr.Error()
+	input.FailedPhase = ec.failedPhase()
+	ctx := context.WithoutCancel(ec.context())
+	for _, cmd := range hooks {
+		if err := ec.runHook(ctx, cmd, input); err != nil {
+			ec.logger().Warn().Err(err).Msgf("Hook %s failed", cmd.hook.DisplayName())
+		}
+	}
+	return execErr
+}
+
+func (ec *ExecutionConfig) runHook(ctx context.Context, cmd hookCommand, input HookInput) error {
+	shell, err := ec.runner().LookPath(defaultShellCmd)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to lookup shell path")
+		return err
+	}
+	stdin, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	timeout := cmd.hook.TimeoutDuration
+	if timeout <= 0 {
+		timeout = config.DefaultHookTimeout
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	name := cmd.hook.DisplayName()
+	ec.logger().Info().Msgf("Running %s hook %s", input.Hook, name)
+	err = ec.runLoggedContext(hookCtx, "hook-"+input.Hook, &Command{
+		Path:   shell,
+		Args:   []string{"-c", cmd.hook.Command},
+		Env:    ec.hookEnv(input),
+		Dir:    cmd.dir,
+		Stdin:  bytes.NewReader(stdin),
+		Stdout: ec.stdout(),
+		Stderr: ec.stderr(),
+	})
+	if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("hook %s timed out after %s", name, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("hook %s failed: %w", name, err)
+	}
+	return nil
+}
+
+func (ec *ExecutionConfig) hookInput(point string) HookInput {
+	input := HookInput{
+		Hook:             point,
+		RunID:            ec.runID(),
+		ConfigFile:       ec.ConfigFilePath,
+		Stack:            ec.StackName,
+		OutputDir:        ec.OutputDir,
+		Outputs:          ec.Config.Outputs,
+		SensitiveOutputs: ec.Config.SensitiveOutputs,
+	}
+	if input.Outputs == nil {
+		input.Outputs = map[string]interface{}{}
+	}
+	return input
+}
+
+// returns environment of hook with run metadata and values of non-sensitive outputs
+func (ec *ExecutionConfig) hookEnv(input HookInput) []string {
+	env := append(os.Environ(),
+		"LIFTOFF_HOOK="+input.Hook,
+		"LIFTOFF_RUN_ID="+input.RunID,
+		"LIFTOFF_CONFIG_FILE="+input.ConfigFile,
+		"LIFTOFF_STACK="+input.Stack,
+		"LIFTOFF_OUTPUT_DIR="+input.OutputDir,
+	)
+	if input.Error != "" {
+		env = append(env, "LIFTOFF_FAILED_PHASE="+input.FailedPhase, "LIFTOFF_ERROR="+input.Error)
+	}
+	for name, value := range input.Outputs {
+		if slices.Contains(input.SensitiveOutputs, name) {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			data, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			text = string(data)
+		}
+		env = append(env, HookOutputEnvPrefix+hookEnvName(name)+"="+text)
+	}
+	return env
+}
+
+// returns name of the last failed phase
+func (ec *ExecutionConfig) failedPhase() string {
+	phases := ec.report().Phases
+	for i := len(phases) - 1; i >= 0; i-- {
+		if phases[i].Failed {
+			return phases[i].Phase
+		}
+	}
+	return ""
+}
+
+// converts output name to environment variable name, like "server-ip" to "SERVER_IP"
+func hookEnvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name))
+}
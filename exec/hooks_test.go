@@ -0,0 +1,153 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// runner which blocks hooks until they are cancelled
+type blockingHookRunner struct {
+	scriptedRunner
+}
+
+func (r *blockingHookRunner) Run(ctx context.Context, cmd *Command) error {
+	err := r.scriptedRunner.Run(ctx, cmd)
+	if len(cmd.Args) > 0 && cmd.Args[0] == "-c" {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func newHooksExecutionConfig(t *testing.T, runner Runner, hooks config.Hooks) *ExecutionConfig {
+	t.Setenv("HOME", t.TempDir())
+	tmplDir, err := filepath.Abs("test_files/template")
+	assert.NoError(t, err)
+	return &ExecutionConfig{
+		Config: &config.Configuration{
+			TemplateDir: tmplDir,
+			Ansible: &config.AnsibleConfig{
+				InventoryFile: "inventory",
+				PlaybookFile:  "playbook.yaml",
+			},
+			ProcessingVars: map[string]interface{}{},
+			Hooks:          hooks,
+		},
+		ConfigFilePath: filepath.Join(t.TempDir(), "liftoff.yaml"),
+		Runner:         runner,
+		RunID:          "run-1",
+		Stdout:         io.Discard,
+		Stderr:         io.Discard,
+	}
+}
+
+func TestExecuteSetup_RunsHooksAroundPhases(t *testing.T) {
+	runner := newScriptedRunner().withTerraformOutputs(`{
+		"server_ip": {"type": "string", "value": "10.0.0.5"},
+		"db_password": {"type": "string", "value": "secret", "sensitive": true}
+	}`)
+	ec := newHooksExecutionConfig(t, runner, config.Hooks{
+		config.HookPreTerraform:  {{Command: "./wait-for-dns.sh"}},
+		config.HookPostTerraform: {{Command: "./smoke-test.sh"}},
+		config.HookPostAnsible:   {{Name: "notify", Command: "curl -X POST https://hooks.example.com"}},
+	})
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/sh -c ./wait-for-dns.sh",
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform output -json",
+		"/usr/bin/sh -c ./smoke-test.sh",
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+		"/usr/bin/sh -c curl -X POST https://hooks.example.com",
+	}, runner.commandLines())
+
+	hook := runner.commands[4]
+	assert.Equal(t, filepath.Dir(ec.ConfigFilePath), hook.Dir)
+	assert.Contains(t, hook.Env, "LIFTOFF_HOOK=post-terraform")
+	assert.Contains(t, hook.Env, "LIFTOFF_RUN_ID=run-1")
+	assert.Contains(t, hook.Env, "LIFTOFF_OUTPUT_SERVER_IP=10.0.0.5")
+	assert.False(t, hasEnvVar(hook.Env, "LIFTOFF_OUTPUT_DB_PASSWORD"))
+	var input HookInput
+	assert.NoError(t, json.NewDecoder(hook.Stdin).Decode(&input))
+	assert.Equal(t, "post-terraform", input.Hook)
+	assert.Equal(t, "secret", input.Outputs["db_password"])
+	assert.Equal(t, []string{"db_password"}, input.SensitiveOutputs)
+
+	var phases []string
+	for _, phase := range ec.Report.Phases {
+		phases = append(phases, phase.Phase)
+	}
+	assert.Contains(t, phases, "hooks:pre-terraform")
+	assert.Contains(t, phases, "hooks:post-ansible")
+}
+
+func TestExecuteSetup_FailingHookStopsExecution(t *testing.T) {
+	runner := newScriptedRunner().withFailure("-c ./check.sh", errScripted)
+	ec := newHooksExecutionConfig(t, runner, config.Hooks{
+		config.HookPreTerraform: {{Command: "./check.sh"}},
+		config.HookOnFailure:    {{Command: "./notify-failure.sh"}, {Command: "./cleanup.sh"}},
+	})
+	err := ec.ExecuteSetup()
+	assert.ErrorIs(t, err, errScripted)
+	assert.ErrorContains(t, err, "hook ./check.sh failed")
+	assert.Equal(t, []string{
+		"/usr/bin/sh -c ./check.sh",
+		"/usr/bin/sh -c ./notify-failure.sh",
+		"/usr/bin/sh -c ./cleanup.sh",
+	}, runner.commandLines())
+	assert.Contains(t, runner.commands[1].Env, "LIFTOFF_FAILED_PHASE=hooks:pre-terraform")
+	assert.True(t, hasEnvVar(runner.commands[1].Env, "LIFTOFF_ERROR"))
+}
+
+func TestExecuteSetup_HookFailureCanBeIgnored(t *testing.T) {
+	runner := newScriptedRunner().withFailure("-c ./check.sh", errScripted)
+	ec := newHooksExecutionConfig(t, runner, config.Hooks{
+		config.HookPreTerraform: {{Command: "./check.sh", FailurePolicy: config.HookFailurePolicyContinue}},
+	})
+	ec.SkipAnsible = true
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Len(t, runner.commands, 4)
+}
+
+func TestExecuteSetup_HookTimeout(t *testing.T) {
+	runner := &blockingHookRunner{scriptedRunner: scriptedRunner{}}
+	ec := newHooksExecutionConfig(t, runner, config.Hooks{
+		config.HookPreRender: {{Command: "sleep 600", TimeoutDuration: 10 * time.Millisecond}},
+	})
+	start := time.Now()
+	err := ec.ExecuteSetup()
+	assert.ErrorContains(t, err, "hook sleep 600 timed out after 10ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecuteTeardown_RunsDestroyHooks(t *testing.T) {
+	runner := newScriptedRunner().withTerraformOutputs(`{"server_ip": {"type": "string", "value": "10.0.0.5"}}`)
+	ec := newHooksExecutionConfig(t, runner, config.Hooks{
+		config.HookPreDestroy:  {{Command: "./drain.sh"}},
+		config.HookPostDestroy: {{Command: "./remove-dns.sh"}},
+	})
+	ec.KeepArtifacts = true
+	err := ec.ExecuteTeardown()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform output -json",
+		"/usr/bin/sh -c ./drain.sh",
+		"/usr/bin/terraform apply -destroy -auto-approve -json",
+		"/usr/bin/sh -c ./remove-dns.sh",
+	}, runner.commandLines())
+	assert.Contains(t, runner.commands[2].Env, "LIFTOFF_OUTPUT_SERVER_IP=10.0.0.5")
+}
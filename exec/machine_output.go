@@ -0,0 +1,199 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/bitshifted/liftoff/event"
+)
+
+const (
+	// Ansible callback plugin which writes events as JSON lines
+	ansibleJSONCallback   = "ansible.posix.jsonl"
+	ansibleJSONCollection = "ansible.posix"
+	ansibleCallbackEnvVar = "ANSIBLE_STDOUT_CALLBACK"
+	// Terraform diagnostic severity for errors
+	tfSeverityError = "error"
+)
+
+// returns true if output of external commands is parsed into events, which is needed for machine readable
+// output and for progress reporting
+func (ec *ExecutionConfig) structuredOutput() bool {
+	return ec.MachineReadable || ec.OnEvent != nil
+}
+
+// checks if collection with Ansible JSON callback is installed. If it is not, playbooks are run with default
+// callback, so that missing collection does not break setup
+func (ec *ExecutionConfig) ansibleJSONCallbackAvailable() bool {
+	if ec.jsonCallbackChecked {
+		return ec.jsonCallbackAvailable
+	}
+	ec.jsonCallbackChecked = true
+	var out bytes.Buffer
+	cmd := &Command{
+		Path:   filepath.Join(filepath.Dir(ec.AnsiblePlaybookPath), defaultGalaxyCmd),
+		Args:   []string{"collection", "list", ansibleJSONCollection, "--format", "json"},
+		Stdout: &out,
+	}
+	err := ec.runner().Run(ec.context(), cmd)
+	if err != nil {
+		ec.logger().Debug().Err(err).Msgf("Failed to list %s collection", ansibleJSONCollection)
+	}
+	// output maps collection directories to collections installed in them
+	var dirs map[string]map[string]interface{}
+	if err == nil && json.Unmarshal(out.Bytes(), &dirs) == nil {
+		for _, collections := range dirs {
+			if _, ok := collections[ansibleJSONCollection]; ok {
+				ec.jsonCallbackAvailable = true
+			}
+		}
+	}
+	if !ec.jsonCallbackAvailable {
+		ec.logger().Warn().Msgf("Collection %s is not installed, Ansible task progress is not reported", ansibleJSONCollection)
+	}
+	return ec.jsonCallbackAvailable
+}
+
+// single message of Terraform machine readable UI
+type terraformMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"@message"`
+	Hook    struct {
+		Resource struct {
+			Addr string `json:"addr"`
+		} `json:"resource"`
+		Action         string  `json:"action"`
+		ElapsedSeconds float64 `json:"elapsed_seconds"`
+	} `json:"hook"`
+	Diagnostic *struct {
+		Severity string `json:"severity"`
+		Summary  string `json:"summary"`
+		Detail   string `json:"detail"`
+	} `json:"diagnostic"`
+}
+
+// parses single line of "terraform apply -json" output into events. Returns error if line is not valid JSON
+func parseTerraformLine(line []byte) ([]event.Event, error) {
+	var msg terraformMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, err
+	}
+	status := ""
+	switch msg.Type {
+	case "apply_start":
+		status = event.StatusStarted
+	case "apply_progress":
+		status = event.StatusInProgress
+	case "apply_complete":
+		status = event.StatusComplete
+	case "apply_errored":
+		status = event.StatusErrored
+	case "diagnostic":
+		if msg.Diagnostic == nil || msg.Diagnostic.Severity != tfSeverityError {
+			return nil, nil
+		}
+		return []event.Event{{
+			Type:    event.Error,
+			Message: msg.Diagnostic.Summary,
+			Error:   msg.Diagnostic.Detail,
+		}}, nil
+	default:
+		return nil, nil
+	}
+	return []event.Event{{
+		Type:    event.ResourceChanged,
+		Message: msg.Message,
+		Resource: &event.ResourceChange{
+			Address: msg.Hook.Resource.Addr,
+			Action:  msg.Hook.Action,
+			Status:  status,
+			Elapsed: time.Duration(msg.Hook.ElapsedSeconds * float64(time.Second)),
+		},
+	}}, nil
+}
+
+// single message written by Ansible JSON lines callback
+type ansibleMessage struct {
+	Event string `json:"_event"`
+	Play  struct {
+		Name string `json:"name"`
+	} `json:"play"`
+	Task struct {
+		Name     string `json:"name"`
+		Duration struct {
+			Start string `json:"start"`
+			End   string `json:"end"`
+		} `json:"duration"`
+	} `json:"task"`
+	Hosts map[string]struct {
+		Changed bool        `json:"changed"`
+		Msg     interface{} `json:"msg"`
+	} `json:"hosts"`
+}
+
+// ansibleParser converts Ansible JSON lines output into task result events
+type ansibleParser struct {
+	currentPlay string
+}
+
+// parses single line of Ansible output into events. Returns error if line is not valid JSON
+func (ap *ansibleParser) parseLine(line []byte) ([]event.Event, error) {
+	var msg ansibleMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, err
+	}
+	status := ""
+	switch msg.Event {
+	case "v2_playbook_on_play_start":
+		ap.currentPlay = msg.Play.Name
+		return nil, nil
+	case "v2_runner_on_ok":
+		status = event.StatusOK
+	case "v2_runner_on_failed":
+		status = event.StatusFailed
+	case "v2_runner_on_skipped":
+		status = event.StatusSkipped
+	case "v2_runner_on_unreachable":
+		status = event.StatusUnreachable
+	default:
+		return nil, nil
+	}
+	elapsed := taskDuration(msg.Task.Duration.Start, msg.Task.Duration.End)
+	events := make([]event.Event, 0, len(msg.Hosts))
+	for host, result := range msg.Hosts {
+		hostStatus := status
+		if status == event.StatusOK && result.Changed {
+			hostStatus = event.StatusChanged
+		}
+		taskResult := &event.TaskResult{
+			Play:    ap.currentPlay,
+			Task:    msg.Task.Name,
+			Host:    host,
+			Status:  hostStatus,
+			Elapsed: elapsed,
+		}
+		if result.Msg != nil {
+			taskResult.Message = fmt.Sprint(result.Msg)
+		}
+		events = append(events, event.Event{Type: event.TaskFinished, Task: taskResult})
+	}
+	return events, nil
+}
+
+func taskDuration(start, end string) time.Duration {
+	startTime, err := time.Parse(time.RFC3339Nano, start)
+	if err != nil {
+		return 0
+	}
+	endTime, err := time.Parse(time.RFC3339Nano, end)
+	if err != nil {
+		return 0
+	}
+	return endTime.Sub(startTime)
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitshifted/liftoff/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTerraformApplyComplete(t *testing.T) {
+	line := `{"@level":"info","@message":"hcloud_server.web: Creation complete after 12s [id=123]","type":"apply_complete",` +
+		`"hook":{"resource":{"addr":"hcloud_server.web","resource_type":"hcloud_server"},"action":"create","elapsed_seconds":12}}`
+	events, err := parseTerraformLine([]byte(line))
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	evt := events[0]
+	assert.Equal(t, event.ResourceChanged, evt.Type)
+	assert.Equal(t, "hcloud_server.web", evt.Resource.Address)
+	assert.Equal(t, "create", evt.Resource.Action)
+	assert.Equal(t, event.StatusComplete, evt.Resource.Status)
+	assert.Equal(t, 12*time.Second, evt.Resource.Elapsed)
+}
+
+func TestParseTerraformErrorDiagnostic(t *testing.T) {
+	line := `{"@level":"error","type":"diagnostic","diagnostic":{"severity":"error","summary":"Invalid token","detail":"token is empty"}}`
+	events, err := parseTerraformLine([]byte(line))
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, event.Error, events[0].Type)
+	assert.Equal(t, "Invalid token", events[0].Message)
+
+	events, err = parseTerraformLine([]byte(`{"type":"diagnostic","diagnostic":{"severity":"warning","summary":"Deprecated"}}`))
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	events, err = parseTerraformLine([]byte(`{"type":"version","terraform":"1.9.0"}`))
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	_, err = parseTerraformLine([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestParseAnsibleTaskResults(t *testing.T) {
+	parser := &ansibleParser{}
+	events, err := parser.parseLine([]byte(`{"_event":"v2_playbook_on_play_start","play":{"name":"Configure servers"}}`))
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	events, err = parser.parseLine([]byte(`{"_event":"v2_runner_on_ok","hosts":{"web1":{"changed":true}},` +
+		`"task":{"name":"Install nginx","duration":{"start":"2025-01-01T10:00:00.000000Z","end":"2025-01-01T10:00:03.500000Z"}}}`))
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	task := events[0].Task
+	assert.Equal(t, "Configure servers", task.Play)
+	assert.Equal(t, "Install nginx", task.Task)
+	assert.Equal(t, "web1", task.Host)
+	assert.Equal(t, event.StatusChanged, task.Status)
+	assert.Equal(t, 3500*time.Millisecond, task.Elapsed)
+
+	events, err = parser.parseLine([]byte(`{"_event":"v2_runner_on_failed","hosts":{"web2":{"msg":"package not found"}},"task":{"name":"Install nginx"}}`))
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, event.StatusFailed, events[0].Task.Status)
+	assert.Equal(t, "package not found", events[0].Task.Message)
+}
+
+func TestLineWriterSplitsLines(t *testing.T) {
+	var lines []string
+	lw := newLineWriter(func(line []byte) {
+		lines = append(lines, string(line))
+	})
+	_, _ = lw.Write([]byte("first\nsec"))
+	_, _ = lw.Write([]byte("ond\r\n\nthird"))
+	assert.Equal(t, []string{"first", "second"}, lines)
+	lw.Flush()
+	assert.Equal(t, []string{"first", "second", "third"}, lines)
+}
+
+func TestTailBufferKeepsLastBytes(t *testing.T) {
+	tb := newTailBuffer(5)
+	_, _ = tb.Write([]byte("abc"))
+	_, _ = tb.Write([]byte("defg"))
+	assert.Equal(t, "cdefg", tb.String())
+}
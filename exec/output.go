@@ -0,0 +1,78 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maximum size of command output attached to events
+const maxCapturedOutput = 64 * 1024
+
+// tailBuffer keeps last written bytes up to the limit. It is safe for concurrent use
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit}
+}
+
+func (tb *tailBuffer) Write(p []byte) (int, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.buf = append(tb.buf, p...)
+	if len(tb.buf) > tb.limit {
+		tb.buf = tb.buf[len(tb.buf)-tb.limit:]
+	}
+	return len(p), nil
+}
+
+func (tb *tailBuffer) String() string {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return string(tb.buf)
+}
+
+// lineWriter splits written data into lines and passes each complete line to callback
+type lineWriter struct {
+	mu      sync.Mutex
+	pending []byte
+	onLine  func(line []byte)
+}
+
+func newLineWriter(onLine func(line []byte)) *lineWriter {
+	return &lineWriter{onLine: onLine}
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.pending = append(lw.pending, p...)
+	for {
+		idx := bytes.IndexByte(lw.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimRight(lw.pending[:idx], "\r")
+		if len(line) > 0 {
+			lw.onLine(line)
+		}
+		lw.pending = lw.pending[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes remaining incomplete line to callback
+func (lw *lineWriter) Flush() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if len(lw.pending) > 0 {
+		lw.onLine(lw.pending)
+		lw.pending = nil
+	}
+}
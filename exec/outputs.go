@@ -0,0 +1,139 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/bitshifted/liftoff/common"
+)
+
+// replaces values of sensitive outputs in log messages
+const maskedOutputValue = "<sensitive>"
+
+// TerraformOutput is a single output reported by `terraform output -json`
+type TerraformOutput struct {
+	Value interface{} `json:"value"`
+	// Terraform type constraint, like "string" or ["list", "string"]
+	Type      interface{} `json:"type"`
+	Sensitive bool        `json:"sensitive"`
+}
+
+// TypeName returns type of output in Terraform syntax, like "list(string)"
+func (o TerraformOutput) TypeName() string {
+	return typeName(o.Type)
+}
+
+func typeName(t interface{}) string {
+	switch v := t.(type) {
+	case nil:
+		return "unknown"
+	case string:
+		return v
+	case []interface{}:
+		if len(v) == 2 {
+			if kind, ok := v[0].(string); ok {
+				switch kind {
+				case "list", "set", "map":
+					return fmt.Sprintf("%s(%s)", kind, typeName(v[1]))
+				case "object", "tuple":
+					return kind
+				}
+			}
+		}
+	}
+	data, _ := json.Marshal(t)
+	return string(data)
+}
+
+// ExecuteOutputs collects Terraform outputs of provisioned infrastructure, without rendering templates.
+// Terraform working directory must exist
+func (ec *ExecutionConfig) ExecuteOutputs() error {
+	ec.Report = &Report{}
+	ec.OutputDir = ec.outputDirPath()
+	ec.TerraformWorkDir = path.Join(ec.OutputDir, common.DefaultTerraformDir)
+	if !dirExists(ec.TerraformWorkDir) {
+		return fmt.Errorf("terraform working directory %s does not exist", ec.TerraformWorkDir)
+	}
+	err := ec.resolveTerraformPath()
+	if err != nil {
+		return err
+	}
+	return ec.collectTerraformOutputs()
+}
+
+// collects Terraform outputs and makes them available to templates, both as .Outputs and, for compatibility
+// with existing templates, as processing variables
+func (ec *ExecutionConfig) collectTerraformOutputs() error {
+	tfOutputs, err := ec.getTerraformOutputs()
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to get Terraform outputs")
+		return err
+	}
+	names := make([]string, 0, len(tfOutputs))
+	for name := range tfOutputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	outputs := make(map[string]interface{}, len(tfOutputs))
+	var sensitive []string
+	for _, name := range names {
+		output := tfOutputs[name]
+		outputs[name] = output.Value
+		ec.Config.ProcessingVars[name] = output.Value
+		logValue := output.Value
+		if output.Sensitive {
+			sensitive = append(sensitive, name)
+			logValue = maskedOutputValue
+		}
+		ec.logger().Debug().Msgf("Terraform output %s (%s): %v", name, output.TypeName(), logValue)
+	}
+	ec.Config.Outputs = outputs
+	ec.Config.SensitiveOutputs = sensitive
+	ec.report().Outputs = outputs
+	ec.report().SensitiveOutputs = sensitive
+	ec.report().TerraformOutputs = tfOutputs
+	return nil
+}
+
+// runs `terraform output -json` and parses its result
+func (ec *ExecutionConfig) getTerraformOutputs() (map[string]TerraformOutput, error) {
+	ec.logger().Info().Msg("Collecting Terraform outputs")
+	var buf bytes.Buffer
+	err := ec.runner().Run(ec.context(), &Command{
+		Path:   ec.TerraformPath,
+		Args:   []string{"output", "-json"},
+		Env:    ec.terraformEnv(),
+		Dir:    ec.TerraformWorkDir,
+		Stdout: &buf,
+		Stderr: ec.stderr(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Terraform output: %w", err)
+	}
+	return parseTerraformOutputs(buf.Bytes())
+}
+
+func parseTerraformOutputs(data []byte) (map[string]TerraformOutput, error) {
+	outputs := map[string]TerraformOutput{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return outputs, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid Terraform output: %w", err)
+	}
+	for name, value := range raw {
+		var output TerraformOutput
+		if err := json.Unmarshal(value, &output); err != nil {
+			return nil, fmt.Errorf("invalid Terraform output '%s': %w", name, err)
+		}
+		outputs[name] = output
+	}
+	return outputs, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"time"
+
+	"github.com/bitshifted/liftoff/event"
+)
+
+// names of execution phases
+const (
+	PhaseFetch         = "fetch"
+	PhasePreflight     = "preflight"
+	PhaseRender        = "render"
+	PhaseTerraform     = "terraform"
+	PhasePlan          = "plan"
+	PhaseSSHConfig     = "ssh-config"
+	PhaseAnsibleRender = "ansible-render"
+	PhaseWaitSSH       = "wait-ssh"
+	PhaseAnsible       = "ansible"
+	PhaseChecks        = "checks"
+	PhasePreDestroy    = "pre-destroy"
+	PhaseDestroy       = "destroy"
+	PhaseCleanup       = "cleanup"
+)
+
+// PhaseTiming records execution time of single phase
+type PhaseTiming struct {
+	Phase    string
+	Started  time.Time
+	Duration time.Duration
+	Failed   bool
+}
+
+// Report contains results of an execution
+type Report struct {
+	// Values of Terraform outputs
+	Outputs map[string]interface{}
+	// Names of Terraform outputs marked as sensitive
+	SensitiveOutputs []string
+	// Terraform outputs with their types and sensitivity
+	TerraformOutputs map[string]TerraformOutput
+	// Files created or modified during template processing
+	ChangedFiles []string
+	Phases       []PhaseTiming
+	// Set by plan if Terraform detected changes to infrastructure
+	HasChanges bool
+	// Set by setup if Terraform apply was run, even if it failed
+	TerraformApplied bool
+	// Generated SSH config file and hosts described in it
+	SSHConfigFile string
+	SSHHosts      []SSHHost
+	// Results of health checks
+	Checks []CheckResult
+}
+
+func (ec *ExecutionConfig) report() *Report {
+	if ec.Report == nil {
+		ec.Report = &Report{}
+	}
+	return ec.Report
+}
+
+func (ec *ExecutionConfig) emit(evt event.Event) {
+	if ec.OnEvent == nil {
+		return
+	}
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	if evt.Phase == "" {
+		evt.Phase = ec.currentPhase
+	}
+	if evt.Stack == "" {
+		evt.Stack = ec.StackName
+	}
+	ec.OnEvent(evt)
+}
+
+// runs single execution phase, recording its timing and emitting start and finish events
+func (ec *ExecutionConfig) runPhase(phase string, fn func() error) error {
+	if err := ec.context().Err(); err != nil {
+		return err
+	}
+	ec.logger().Debug().Msgf("Starting phase %s", phase)
+	start := time.Now()
+	ec.currentPhase = phase
+	if ec.MachineReadable {
+		ec.capture = newTailBuffer(maxCapturedOutput)
+	}
+	defer func() {
+		ec.currentPhase = ""
+		ec.capture = nil
+	}()
+	ec.emit(event.Event{Type: event.PhaseStarted, Time: start, Phase: phase})
+	err := fn()
+	timing := PhaseTiming{
+		Phase:    phase,
+		Started:  start,
+		Duration: time.Since(start),
+		Failed:   err != nil,
+	}
+	ec.report().Phases = append(ec.report().Phases, timing)
+	finished := event.Event{Type: event.PhaseFinished, Phase: phase, Duration: timing.Duration}
+	if ec.capture != nil {
+		finished.Output = ec.capture.String()
+	}
+	if err != nil {
+		finished.Error = err.Error()
+		ec.emit(event.Event{Type: event.Error, Phase: phase, Error: err.Error(), Output: finished.Output})
+	}
+	ec.emit(finished)
+	ec.logger().Debug().Msgf("Phase %s finished in %s", phase, timing.Duration)
+	return err
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import "errors"
+
+// exit code of "terraform plan -detailed-exitcode" when there are changes to apply
+const planChangesExitCode = 2
+
+// ExecutePlan renders Terraform templates and shows changes Terraform would make to infrastructure
+func (ec *ExecutionConfig) ExecutePlan() error {
+	ec.Report = &Report{}
+	processor, err := ec.prepareTemplates()
+	if err != nil {
+		return err
+	}
+	err = ec.runPhase(PhasePreflight, ec.checkCredentials)
+	if err != nil {
+		return err
+	}
+	err = ec.runPhase(PhaseRender, func() error {
+		return ec.renderTerraformTemplates(processor)
+	})
+	if err != nil {
+		return err
+	}
+	err = ec.resolveTerraformPath()
+	if err != nil {
+		return err
+	}
+	return ec.runPhase(PhasePlan, func() error {
+		if err := ec.prepareTerraformDataDir(); err != nil {
+			return err
+		}
+		ec.logger().Info().Msg("Running Terraform init...")
+		err := ec.executeTerraformQuiet("init")
+		if err != nil {
+			ec.logger().Error().Err(err).Msg("Failed to run Terraform init")
+			return err
+		}
+		ec.logger().Info().Msg("Running Terraform plan...")
+		args := append([]string{"plan", "-input=false", "-detailed-exitcode"}, ec.targetArgs()...)
+		err = ec.executeTerraformCommand(args...)
+		if exitCode(err) == planChangesExitCode {
+			ec.report().HasChanges = true
+			return nil
+		}
+		if err != nil {
+			ec.logger().Error().Err(err).Msg("Terraform plan failed")
+		}
+		return err
+	})
+}
+
+// ExecuteRender renders Terraform and Ansible templates without running any external commands
+func (ec *ExecutionConfig) ExecuteRender() error {
+	ec.Report = &Report{}
+	processor, err := ec.prepareTemplates()
+	if err != nil {
+		return err
+	}
+	err = ec.runPhase(PhaseRender, func() error {
+		return ec.renderTerraformTemplates(processor)
+	})
+	if err != nil {
+		return err
+	}
+	return ec.runPhase(PhaseAnsibleRender, func() error {
+		return ec.renderAnsibleTemplates(processor)
+	})
+}
+
+// returns exit code of failed command, or -1 if it is not available
+func exitCode(err error) int {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
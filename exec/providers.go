@@ -0,0 +1,82 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitshifted/liftoff/config"
+)
+
+const (
+	// file with required_providers block generated from provider registry
+	requiredProvidersFileName = "liftoff_providers.tf"
+	requiredProvidersHeader   = "# Generated by liftoff from provider registry. Do not edit.\n"
+)
+
+// resolves configured providers from built-in providers and providers declared in template
+func (ec *ExecutionConfig) resolveProviders(tmplDir string) error {
+	if ec.Config.Terraform == nil {
+		return nil
+	}
+	registry, err := config.LoadProviderRegistry(tmplDir)
+	if err != nil {
+		return err
+	}
+	ec.providers, err = ec.Config.Terraform.ResolveProviders(registry)
+	return err
+}
+
+// writes required_providers block for configured providers to Terraform working directory, unless
+// templates already declare required providers
+func (ec *ExecutionConfig) writeRequiredProviders() error {
+	if len(ec.providers) == 0 {
+		return nil
+	}
+	outPath := path.Join(ec.TerraformWorkDir, requiredProvidersFileName)
+	declared, err := declaresRequiredProviders(ec.TerraformWorkDir)
+	if err != nil {
+		return err
+	}
+	if declared {
+		ec.logger().Debug().Msg("Templates declare required providers, skipping generation")
+		return ec.removeArtifact(outPath)
+	}
+	content := []byte(requiredProvidersHeader + config.RequiredProvidersBlock(ec.providers))
+	existing, err := os.ReadFile(outPath)
+	if err == nil && bytes.Equal(existing, content) {
+		return nil
+	}
+	if err = os.WriteFile(outPath, content, 0o644); err != nil {
+		return err
+	}
+	ec.report().ChangedFiles = append(ec.report().ChangedFiles, outPath)
+	return nil
+}
+
+// returns true if Terraform files in directory, other than generated providers file, contain
+// required_providers block
+func declaresRequiredProviders(dir string) (bool, error) {
+	files, err := filepath.Glob(path.Join(dir, "*.tf"))
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		if filepath.Base(file) == requiredProvidersFileName {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		if strings.Contains(string(data), "required_providers") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProvidersExecutionConfig(t *testing.T, providers ...string) *ExecutionConfig {
+	tmplDir, err := filepath.Abs("test_files/template")
+	assert.NoError(t, err)
+	return &ExecutionConfig{
+		Config: &config.Configuration{
+			TemplateDir:    tmplDir,
+			Terraform:      &config.Terraform{Providers: providers},
+			ProcessingVars: map[string]interface{}{"server_name": "web"},
+		},
+		ConfigFilePath: filepath.Join(t.TempDir(), "liftoff.yaml"),
+		Runner:         newScriptedRunner(),
+		SkipTerraform:  true,
+		SkipAnsible:    true,
+	}
+}
+
+func TestExecuteSetup_GeneratesRequiredProviders(t *testing.T) {
+	ec := newProvidersExecutionConfig(t, "hcloud", "cloudflare")
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	generated, err := os.ReadFile(filepath.Join(ec.TerraformWorkDir, requiredProvidersFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(generated), `source  = "hetznercloud/hcloud"`)
+	assert.Contains(t, string(generated), `source  = "cloudflare/cloudflare"`)
+	assert.Contains(t, ec.Report.ChangedFiles, filepath.Join(ec.TerraformWorkDir, requiredProvidersFileName))
+}
+
+func TestExecuteSetup_UnknownProviderFailsBeforeRendering(t *testing.T) {
+	ec := newProvidersExecutionConfig(t, "hcloud", "vultr")
+	err := ec.ExecuteSetup()
+	assert.ErrorContains(t, err, "unsupported providers: vultr")
+	assert.NoFileExists(t, filepath.Join(OutputDirPath(ec.ConfigFilePath), "terraform", "main.tf"))
+}
+
+func TestWriteRequiredProviders_SkipsWhenTemplateDeclaresProviders(t *testing.T) {
+	workDir := t.TempDir()
+	generatedPath := filepath.Join(workDir, requiredProvidersFileName)
+	assert.NoError(t, os.WriteFile(generatedPath, []byte("stale"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "versions.tf"),
+		[]byte("terraform {\n  required_providers {\n  }\n}\n"), 0o644))
+	ec := &ExecutionConfig{
+		TerraformWorkDir: workDir,
+		providers:        []config.Provider{{Name: "hcloud", Source: "hetznercloud/hcloud"}},
+	}
+	err := ec.writeRequiredProviders()
+	assert.NoError(t, err)
+	assert.NoFileExists(t, generatedPath)
+}
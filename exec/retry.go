@@ -0,0 +1,143 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+)
+
+const (
+	// directory inside directory for generated files where Ansible saves lists of failed hosts
+	ansibleRetryDirName = "ansible-retry"
+	ansibleAdhocCmd     = "ansible"
+	// output of failed attempt kept for matching retryable errors
+	maxAttemptOutput = 64 * 1024
+)
+
+// runs fn according to retry policy of step. Output of commands run in each attempt is matched
+// against retryable error patterns of the policy
+func (ec *ExecutionConfig) retry(step string, fn func(attempt int) error) error {
+	policy := ec.Config.Retry.Policy(step)
+	backoff := policy.BackoffDuration
+	for attempt := 1; ; attempt++ {
+		ec.attemptOutput = newTailBuffer(maxAttemptOutput)
+		err := fn(attempt)
+		output := ec.attemptOutput.String()
+		ec.attemptOutput = nil
+		if err == nil || attempt >= policy.MaxAttempts || ec.context().Err() != nil {
+			return err
+		}
+		if !policy.Retryable(output) {
+			ec.logger().Debug().Msgf("Failure of %s does not match retryable errors", step)
+			return err
+		}
+		ec.logger().Warn().Err(err).Msgf("Step %s failed (attempt %d of %d), retrying in %s", step, attempt, policy.MaxAttempts, backoff)
+		select {
+		case <-ec.context().Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, policy.MaxBackoffDuration)
+	}
+}
+
+// returns directory where Ansible saves retry files
+func (ec *ExecutionConfig) ansibleRetryDir() string {
+	return path.Join(ec.OutputDir, ansibleRetryDirName)
+}
+
+// returns path of retry file which Ansible writes for playbook
+func (ec *ExecutionConfig) ansibleRetryFile(playbook string) string {
+	name := filepath.Base(playbook)
+	return path.Join(ec.ansibleRetryDir(), strings.TrimSuffix(name, filepath.Ext(name))+".retry")
+}
+
+// runs playbook with retries. Attempts after the first one are limited to hosts which failed
+func (ec *ExecutionConfig) runPlaybookWithRetry(playbook string) error {
+	if ec.Config.Retry.Policy(config.RetryAnsible).MaxAttempts <= 1 {
+		return ec.runPlaybook(playbook, "", nil)
+	}
+	retryFile := ec.ansibleRetryFile(playbook)
+	if err := os.Remove(retryFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	env := []string{
+		"ANSIBLE_RETRY_FILES_ENABLED=True",
+		"ANSIBLE_RETRY_FILES_SAVE_PATH=" + ec.ansibleRetryDir(),
+	}
+	return ec.retry(config.RetryAnsible, func(attempt int) error {
+		limit := ""
+		if attempt > 1 {
+			if _, err := os.Stat(retryFile); err == nil {
+				ec.logger().Info().Msgf("Limiting Ansible to hosts which failed, listed in %s", retryFile)
+				limit = "@" + retryFile
+			}
+		}
+		return ec.runPlaybook(playbook, limit, env)
+	})
+}
+
+// waits until all inventory hosts accept connections, using the same connection settings as playbook
+func (ec *ExecutionConfig) waitForSSH() error {
+	found, err := ec.resolveHostLimit()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+	ansiblePath, err := ec.ansiblePath()
+	if err != nil {
+		return err
+	}
+	timeout := ec.Config.Ansible.WaitForSSHDuration
+	pattern := "all"
+	if ec.hostLimit != "" {
+		pattern = ec.hostLimit
+	}
+	ec.logger().Info().Msgf("Waiting up to %s for hosts to accept SSH connections", timeout)
+	err = ec.runLogged("ansible-wait", &Command{
+		Path: ansiblePath,
+		Args: []string{
+			"-i", ec.Config.Ansible.InventoryFile, pattern,
+			"-m", "ansible.builtin.wait_for_connection",
+			"-a", "timeout=" + strconv.Itoa(int(timeout.Seconds())),
+		},
+		Env:    os.Environ(),
+		Dir:    ec.AnsibleWorkDir,
+		Stdout: ec.quietStdout(),
+		Stderr: ec.stderr(),
+	})
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Hosts did not become reachable over SSH")
+		return fmt.Errorf("hosts did not become reachable within %s: %w", timeout, err)
+	}
+	return nil
+}
+
+// returns path of ansible binary, next to ansible-playbook if its path is set explicitly
+func (ec *ExecutionConfig) ansiblePath() (string, error) {
+	if ec.AnsiblePlaybookPath != "" {
+		return path.Join(filepath.Dir(ec.AnsiblePlaybookPath), ansibleAdhocCmd), nil
+	}
+	ansiblePath, err := ec.runner().LookPath(ansibleAdhocCmd)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to lookup ansible path")
+	}
+	return ansiblePath, err
+}
+
+func (ec *ExecutionConfig) waitForSSHEnabled() bool {
+	return ec.Config.Ansible != nil && ec.Config.Ansible.WaitForSSHDuration > 0 &&
+		ec.Config.Ansible.InventoryFile != "" && ec.Config.Ansible.PlaybookFile != ""
+}
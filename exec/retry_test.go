@@ -0,0 +1,143 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// loads retry policies from configuration file with given retry section
+func loadRetryPolicies(t *testing.T, retry string) config.RetryPolicies {
+	configPath := filepath.Join(t.TempDir(), "liftoff.yaml")
+	content := "template-dir: template\nterraform:\n  providers: [hcloud]\nretry:\n" + retry
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0o600))
+	conf, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	return conf.Retry
+}
+
+// runner which fails ansible-playbook once, saving retry file with failed host
+type failingPlaybookRunner struct {
+	scriptedRunner
+	failed bool
+}
+
+func (r *failingPlaybookRunner) Run(ctx context.Context, cmd *Command) error {
+	err := r.scriptedRunner.Run(ctx, cmd)
+	if !strings.HasSuffix(cmd.Path, "ansible-playbook") || r.failed {
+		return err
+	}
+	r.failed = true
+	for _, env := range cmd.Env {
+		if dir, ok := strings.CutPrefix(env, "ANSIBLE_RETRY_FILES_SAVE_PATH="); ok {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, "playbook.retry"), []byte("web-2\n"), 0o600); err != nil {
+				return err
+			}
+		}
+	}
+	return errScripted
+}
+
+func TestExecuteSetup_RetriesTerraformOnRetryableError(t *testing.T) {
+	runner := newScriptedRunner().
+		withTerraformOutputs(`{}`).
+		withTransientFailure("apply -auto-approve", "Error: rate limit exceeded", 1)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.Config.Retry = loadRetryPolicies(t, "  terraform:\n    max-attempts: 3\n    backoff: 1ms\n    retryable-errors: ['rate limit']\n")
+	ec.SkipAnsible = true
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform output -json",
+	}, runner.commandLines())
+}
+
+func TestExecuteSetup_DoesNotRetryUnmatchedError(t *testing.T) {
+	runner := newScriptedRunner().
+		withTransientFailure("apply -auto-approve", "Error: invalid provider configuration", 1)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.Config.Retry = loadRetryPolicies(t, "  terraform:\n    max-attempts: 3\n    backoff: 1ms\n    retryable-errors: ['rate limit', 'timeout']\n")
+	ec.SkipAnsible = true
+	err := ec.ExecuteSetup()
+	assert.ErrorIs(t, err, errScripted)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+	}, runner.commandLines())
+}
+
+func TestExecuteSetup_StopsAfterMaxAttempts(t *testing.T) {
+	runner := newScriptedRunner().withFailure("apply -auto-approve", errScripted)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.Config.Retry = loadRetryPolicies(t, "  terraform:\n    max-attempts: 2\n    backoff: 1ms\n")
+	ec.SkipAnsible = true
+	err := ec.ExecuteSetup()
+	assert.ErrorIs(t, err, errScripted)
+	assert.Len(t, runner.commandLines(), 4)
+}
+
+func TestExecuteSetup_RetriesAnsibleOnFailedHosts(t *testing.T) {
+	runner := &failingPlaybookRunner{scriptedRunner: scriptedRunner{}}
+	runner.withTerraformOutputs(`{}`)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.Config.Retry = loadRetryPolicies(t, "  ansible:\n    max-attempts: 2\n    backoff: 1ms\n")
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	retryDir := filepath.Join(ec.OutputDir, ansibleRetryDirName)
+	lines := runner.commandLines()
+	assert.Equal(t, []string{
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+		"/usr/bin/ansible-playbook -i inventory --limit @" + filepath.Join(retryDir, "playbook.retry") + " playbook.yaml",
+	}, lines[len(lines)-2:])
+	playbook := runner.commands[len(runner.commands)-1]
+	assert.Contains(t, playbook.Env, "ANSIBLE_RETRY_FILES_ENABLED=True")
+	assert.Contains(t, playbook.Env, "ANSIBLE_RETRY_FILES_SAVE_PATH="+retryDir)
+}
+
+func TestExecuteSetup_WaitsForSSHBeforeAnsible(t *testing.T) {
+	runner := newScriptedRunner().withTerraformOutputs(`{}`)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.Config.Ansible.WaitForSSHDuration = 5 * time.Minute
+	err := ec.ExecuteSetup()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform output -json",
+		"/usr/bin/ansible -i inventory all -m ansible.builtin.wait_for_connection -a timeout=300",
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+	}, runner.commandLines())
+	assert.Equal(t, ec.AnsibleWorkDir, runner.commands[3].Dir)
+	phases := make([]string, 0, len(ec.Report.Phases))
+	for _, phase := range ec.Report.Phases {
+		phases = append(phases, phase.Phase)
+	}
+	assert.Contains(t, phases, PhaseWaitSSH)
+}
+
+func TestExecuteSetup_FailsIfHostsAreNotReachable(t *testing.T) {
+	runner := newScriptedRunner().
+		withTerraformOutputs(`{}`).
+		withFailure("-i inventory all -m ansible.builtin.wait_for_connection", errScripted)
+	ec := newHooksExecutionConfig(t, runner, nil)
+	ec.Config.Ansible.WaitForSSHDuration = time.Minute
+	err := ec.ExecuteSetup()
+	assert.ErrorIs(t, err, errScripted)
+	assert.NotContains(t, runner.commandLines(), "/usr/bin/ansible-playbook -i inventory playbook.yaml")
+}
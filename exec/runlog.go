@@ -0,0 +1,106 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/bitshifted/liftoff/common"
+	"github.com/bitshifted/liftoff/event"
+	"github.com/bitshifted/liftoff/log"
+)
+
+const (
+	// RunLogsDirName is name of directory for run logs inside directory for generated files
+	RunLogsDirName = common.LogsDirName
+	logFileMode    = 0o600
+)
+
+// returns ID of current run, generating it on first use
+func (ec *ExecutionConfig) runID() string {
+	if ec.RunID == "" {
+		ec.RunID = log.NewRunID()
+	}
+	return ec.RunID
+}
+
+// returns directory where raw output of external commands is saved for current run
+func (ec *ExecutionConfig) runLogDir() string {
+	if ec.OutputDir == "" {
+		return ""
+	}
+	return path.Join(ec.OutputDir, RunLogsDirName, ec.runID())
+}
+
+// opens per-run log file for raw command output. Returns nil if log file can not be created
+func (ec *ExecutionConfig) openRunLog(name string) io.WriteCloser {
+	logDir := ec.runLogDir()
+	if logDir == "" {
+		return nil
+	}
+	err := os.MkdirAll(logDir, os.ModePerm)
+	if err != nil {
+		ec.logger().Warn().Err(err).Msgf("Failed to create log directory %s", logDir)
+		return nil
+	}
+	logPath := path.Join(logDir, name+".log")
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFileMode)
+	if err != nil {
+		ec.logger().Warn().Err(err).Msgf("Failed to open log file %s", logPath)
+		return nil
+	}
+	ec.logger().Debug().Msgf("Saving command output to %s", logPath)
+	return file
+}
+
+// runs command, saving its raw output to per-command log file and run log
+func (ec *ExecutionConfig) runLogged(logName string, cmd *Command) error {
+	return ec.runLoggedContext(ec.context(), logName, cmd)
+}
+
+// same as runLogged, but command is interrupted when given context is done
+func (ec *ExecutionConfig) runLoggedContext(ctx context.Context, logName string, cmd *Command) error {
+	logFile := ec.openRunLog(logName)
+	if logFile != nil {
+		defer logFile.Close()
+		cmd.Stdout = teeWriter(cmd.Stdout, logFile)
+		cmd.Stderr = teeWriter(cmd.Stderr, logFile)
+	}
+	if ec.RunLog != nil {
+		cmd.Stdout = teeWriter(cmd.Stdout, ec.RunLog)
+		cmd.Stderr = teeWriter(cmd.Stderr, ec.RunLog)
+	}
+	if ec.attemptOutput != nil {
+		cmd.Stdout = teeWriter(cmd.Stdout, ec.attemptOutput)
+		cmd.Stderr = teeWriter(cmd.Stderr, ec.attemptOutput)
+	}
+	return ec.runner().Run(ctx, cmd)
+}
+
+func teeWriter(w, log io.Writer) io.Writer {
+	if w == nil {
+		return log
+	}
+	return io.MultiWriter(w, log)
+}
+
+// returns writer which passes lines of machine readable output to parser and emits resulting
+// events. Lines which can not be parsed are written to standard output as they are
+func (ec *ExecutionConfig) machineOutputWriter(parse func(line []byte) ([]event.Event, error)) *lineWriter {
+	out := ec.stdout()
+	return newLineWriter(func(line []byte) {
+		events, err := parse(line)
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "%s\n", line)
+			return
+		}
+		for _, evt := range events {
+			ec.emit(evt)
+		}
+	})
+}
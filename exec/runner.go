@@ -0,0 +1,62 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"context"
+	"io"
+	"os"
+	osExec "os/exec"
+	"time"
+)
+
+// time given to a process to exit gracefully after interrupt signal is sent on cancellation
+const cancelWaitDelay = time.Minute
+
+// Command describes single invocation of external program, like Terraform or ansible-playbook
+type Command struct {
+	// Path to the executable
+	Path string
+	// Command line arguments, not including executable itself
+	Args []string
+	// Complete environment for the process, in "key=value" format
+	Env []string
+	// Working directory
+	Dir    string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner abstracts execution of external commands, so that execution flow can be tested
+// or embedded without real binaries
+type Runner interface {
+	// LookPath searches for executable in directories named by PATH environment variable
+	LookPath(file string) (string, error)
+	// Run starts the command and waits for it to complete. Command should be interrupted
+	// when context is cancelled
+	Run(ctx context.Context, cmd *Command) error
+}
+
+// OSRunner is the default Runner which executes commands using os/exec package
+type OSRunner struct{}
+
+func (r *OSRunner) LookPath(file string) (string, error) {
+	return osExec.LookPath(file)
+}
+
+func (r *OSRunner) Run(ctx context.Context, cmd *Command) error {
+	command := osExec.CommandContext(ctx, cmd.Path, cmd.Args...) //nolint:gosec
+	// let Terraform and Ansible shut down gracefully instead of killing them
+	command.Cancel = func() error {
+		return command.Process.Signal(os.Interrupt)
+	}
+	command.WaitDelay = cancelWaitDelay
+	command.Env = cmd.Env
+	command.Dir = cmd.Dir
+	command.Stdin = cmd.Stdin
+	command.Stdout = cmd.Stdout
+	command.Stderr = cmd.Stderr
+	return command.Run()
+}
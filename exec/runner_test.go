@@ -0,0 +1,58 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOSRunnerCapturesOutput(t *testing.T) {
+	runner := &OSRunner{}
+	echoPath, err := runner.LookPath("echo")
+	assert.NoError(t, err)
+	var stdout bytes.Buffer
+	err = runner.Run(context.Background(), &Command{
+		Path:   echoPath,
+		Args:   []string{"hello"},
+		Dir:    t.TempDir(),
+		Stdout: &stdout,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", stdout.String())
+}
+
+func TestOSRunnerReturnsErrorForMissingBinary(t *testing.T) {
+	runner := &OSRunner{}
+	_, err := runner.LookPath("liftoff-nonexistent-binary")
+	assert.Error(t, err)
+	err = runner.Run(context.Background(), &Command{Path: "/nonexistent/liftoff-binary"})
+	assert.Error(t, err)
+}
+
+func TestOSRunnerStopsOnCancelledContext(t *testing.T) {
+	runner := &OSRunner{}
+	sleepPath, err := runner.LookPath("sleep")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = runner.Run(ctx, &Command{
+		Path: sleepPath,
+		Args: []string{"10"},
+	})
+	assert.Error(t, err)
+}
+
+func TestScriptedRunnerUsesLongestMatchingPrefix(t *testing.T) {
+	errDestroy := errors.New("destroy failed")
+	runner := newScriptedRunner().withFailure("apply -destroy", errDestroy).withFailure("apply", errScripted)
+	for i := 0; i < 10; i++ {
+		assert.ErrorIs(t, runner.Run(context.Background(), &Command{Args: []string{"apply", "-destroy"}}), errDestroy)
+		assert.ErrorIs(t, runner.Run(context.Background(), &Command{Args: []string{"apply", "-auto-approve"}}), errScripted)
+	}
+}
@@ -4,224 +4,233 @@
 package exec
 
 import (
-	"bytes"
-	"crypto/sha256"
 	"embed"
-	"encoding/hex"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
 	"os"
-	osExec "os/exec"
-	"path"
-	gotmpl "text/template"
 
-	"github.com/bitshifted/liftoff/common"
 	"github.com/bitshifted/liftoff/config"
-	"github.com/bitshifted/liftoff/log"
-	"github.com/bitshifted/liftoff/template"
 )
 
 //go:embed resources/*
 var resources embed.FS
 
 func (ec *ExecutionConfig) ExecuteSetup() error {
-	tmplDir, err := ec.templateDirAbsPath()
+	ec.Report = &Report{}
+	return ec.runFailureHooks(ec.executeSetup())
+}
+
+func (ec *ExecutionConfig) executeSetup() error {
+	err := ec.validatePhaseSelection()
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to get template directory path")
 		return err
 	}
-	if tmplDir == "" {
-		return errors.New("either template repository or template directory must be specified")
-	}
-	log.Logger.Info().Msgf("Template directory: %s", tmplDir)
-	tmplConfig, err := config.LoadTemplateConfig(tmplDir)
+	// hashed before templates add their includes and Terraform adds outputs
+	configHash, err := ec.configHash()
 	if err != nil {
-		log.Logger.Error().Err(err).Msgf("Failed to load template configuration: %s", err.Error())
 		return err
 	}
-	ec.Config.TemplateConfig = tmplConfig
-	output, err := ec.calculateOutputDirectory()
+	processor, err := ec.prepareTemplates()
 	if err != nil {
 		return err
 	}
-	ec.TerraformWorkDir = path.Join(output, common.DefaultTerraformDir)
-	ec.AnsibleWorkDir = path.Join(output, common.DefaultAnsibleDir)
-	processor := template.TemplateProcessor{
-		BaseDir:   tmplDir,
-		OutputDir: output,
-	}
-	log.Logger.Info().Msg("Processing Terraform templates...")
-	err = processor.ProcessTerraformTemplates(ec.Config)
+	err = ec.startCheckpoint(configHash)
 	if err != nil {
 		return err
 	}
-	var tfOutputs map[string]interface{}
-	if ec.TerraformPath == "" {
-		tfCmdPath, e := osExec.LookPath(defaltTerraformCmd)
-		if e != nil {
-			log.Logger.Error().Err(e).Msg("Failed to lookup Terraform path")
-			return e
+	if !ec.SkipTerraform {
+		err = ec.runPhase(PhasePreflight, ec.checkCredentials)
+		if err != nil {
+			return err
 		}
-		ec.TerraformPath = tfCmdPath
 	}
-	log.Logger.Debug().Msgf("Using Terraform command: %s", ec.TerraformPath)
-	if !ec.SkipTerraform {
-		err = ec.executeTerraform()
+	if ec.runsPhase(PhaseRender) {
+		err = ec.runHooks(config.HookPreRender)
+		if err != nil {
+			return err
+		}
+		err = ec.runSetupPhase(PhaseRender, func() error {
+			return ec.renderTerraformTemplates(processor)
+		})
+		if err != nil {
+			return err
+		}
+		err = ec.runHooks(config.HookPostRender)
 		if err != nil {
 			return err
 		}
-	} else {
-		log.Logger.Info().Msg("Skipping Terraform configuration")
 	}
-	tfOutputs, err = ec.getTerraformOutputs()
+	err = ec.resolveTerraformPath()
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to get Terraform outputs")
 		return err
 	}
-	// add TF  outputs to variables
-	for k, v := range tfOutputs {
-		// extract values of TF output variables
-		ec.Config.ProcessingVars[k] = v.(map[string]interface{})["value"]
+	if ec.runsPhase(PhaseTerraform) {
+		err = ec.executeTerraformPhase()
+	} else {
+		// outputs of previous run are needed by later phases
+		err = ec.collectTerraformOutputs()
+	}
+	if err != nil {
+		return err
 	}
-	log.Logger.Debug().Msgf("Terraform output: %v", tfOutputs)
 
-	if !ec.SkipAnsible {
-		err = ec.generateSSHConfig()
+	if ec.SkipAnsible {
+		ec.logger().Info().Msg("Skipping Ansible configuration")
+		return ec.runChecks()
+	}
+	if ec.runsPhase(PhaseSSHConfig) {
+		err = ec.runSetupPhase(PhaseSSHConfig, ec.generateSSHConfig)
+	} else {
+		err = ec.useGeneratedSSHConfig()
+	}
+	if err != nil {
+		return err
+	}
+	if ec.runsPhase(PhaseAnsibleRender) {
+		err = ec.runSetupPhase(PhaseAnsibleRender, func() error {
+			return ec.renderAnsibleTemplates(processor)
+		})
 		if err != nil {
 			return err
 		}
-		log.Logger.Info().Msg("Processing Ansible configuration...")
-		err = processor.ProcessAnsibleTemplates(ec.Config)
+	}
+	if ec.runsPhase(PhaseAnsible) {
+		err = ec.executeAnsiblePhase()
 		if err != nil {
 			return err
 		}
-		return ec.executeAnsiblePlaybook()
-	} else {
-		log.Logger.Info().Msg("Skipping Ansible configuration")
 	}
-
-	return nil
+	return ec.runChecks()
 }
 
-func (ec *ExecutionConfig) executeTerraform() error {
-	log.Logger.Info().Msg("Running Terraform init...")
-	err := ec.executeTerraformCommand("init")
+// runs Terraform phase with its hooks. Terraform is not applied if it is skipped, but outputs are collected
+func (ec *ExecutionConfig) executeTerraformPhase() error {
+	if ec.SkipTerraform {
+		return ec.runPhase(PhaseTerraform, func() error {
+			ec.logger().Info().Msg("Skipping Terraform configuration")
+			return ec.collectTerraformOutputs()
+		})
+	}
+	err := ec.runHooks(config.HookPreTerraform)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to run Terraform init")
 		return err
 	}
-	log.Logger.Info().Msg("Running Terraform apply")
-	err = ec.executeTerraformCommand("apply", "-auto-approve")
+	err = ec.runSetupPhase(PhaseTerraform, func() error {
+		if e := ec.retry(config.RetryTerraform, func(int) error { return ec.executeTerraform() }); e != nil {
+			return e
+		}
+		return ec.collectTerraformOutputs()
+	})
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to run Terraform apply")
+		return err
 	}
-	return err
+	return ec.runHooks(config.HookPostTerraform)
 }
 
-func (ec *ExecutionConfig) getTerraformOutputs() (map[string]interface{}, error) {
-	// // run terraform output
-	log.Logger.Info().Msg("Collecting Terraform outputs")
-	cmdOut := osExec.Command(ec.TerraformPath, "output", "-json") //nolint:gosec
-	cmdOut.Dir = ec.TerraformWorkDir
-	cmdOut.Stderr = os.Stderr
-	cmdOut.Env = append(cmdOut.Env, os.Environ()...)
-	tfDataDir := ec.calculateTerraformDataDir()
-	if tfDataDir != "" {
-		cmdOut.Env = append(cmdOut.Env, fmt.Sprintf("TF_DATA_DIR=%s", tfDataDir))
-	}
-	r, w, err := os.Pipe()
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to create pipe")
-		return nil, err
-	}
-	cmdOut.Stdout = w
-	err = cmdOut.Run()
-	// r.Close()
-	w.Close()
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to run Terraform output")
-		return nil, nil
-	}
-	var buf bytes.Buffer
-	numBytes, err := io.Copy(&buf, r)
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to read TF output")
-		return nil, err
-	}
-	var outputs map[string]interface{}
-	if numBytes == 0 {
-		log.Logger.Debug().Msg("output is empty")
-		outputs = make(map[string]interface{})
-	} else {
-		err = json.Unmarshal(buf.Bytes(), &outputs)
+// waits for hosts and runs Ansible phase with its hooks. Post-ansible hooks run before health checks, so they run
+// even if checks fail
+func (ec *ExecutionConfig) executeAnsiblePhase() error {
+	if ec.waitForSSHEnabled() {
+		err := ec.runPhase(PhaseWaitSSH, ec.waitForSSH)
 		if err != nil {
-			log.Logger.Error().Err(err).Msg("Failed to unmarshal Terraform output")
-			return nil, err
+			return err
 		}
 	}
-	return outputs, nil
+	err := ec.runHooks(config.HookPreAnsible)
+	if err != nil {
+		return err
+	}
+	err = ec.runSetupPhase(PhaseAnsible, ec.executeAnsiblePlaybook)
+	if err != nil {
+		return err
+	}
+	return ec.runHooks(config.HookPostAnsible)
+}
+
+func (ec *ExecutionConfig) executeTerraform() error {
+	err := ec.prepareTerraformDataDir()
+	if err != nil {
+		return err
+	}
+	ec.logger().Info().Msg("Running Terraform init...")
+	err = ec.executeTerraformQuiet("init")
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to run Terraform init")
+		return err
+	}
+	ec.logger().Info().Msg("Running Terraform apply")
+	ec.report().TerraformApplied = true
+	err = ec.executeTerraformJSON(append([]string{"apply", "-auto-approve"}, ec.targetArgs()...)...)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to run Terraform apply")
+	}
+	return err
 }
 
 func (ec *ExecutionConfig) executeAnsiblePlaybook() error {
+	if ec.Config.Ansible == nil || ec.Config.Ansible.InventoryFile == "" || ec.Config.Ansible.PlaybookFile == "" {
+		ec.logger().Warn().Msg("Either Ansible inventory file or playbook were not specified. Aborting.")
+		return nil
+	}
+	found, err := ec.resolveHostLimit()
+	if err != nil {
+		return err
+	}
+	if !found {
+		ec.logger().Warn().Msg("Targeted resources have no hosts. Skipping Ansible playbook")
+		return nil
+	}
+	return ec.runPlaybookWithRetry(ec.Config.Ansible.PlaybookFile)
+}
+
+// runs Ansible playbook with configured inventory. Hosts are limited to given pattern if it is set,
+// instead of targeted hosts
+func (ec *ExecutionConfig) runPlaybook(playbook, limit string, env []string) error {
 	if ec.AnsiblePlaybookPath == "" {
-		ansibleCmdPath, err := osExec.LookPath(defaultAnsibleCmd)
+		ansibleCmdPath, err := ec.runner().LookPath(defaultAnsibleCmd)
 		if err != nil {
-			log.Logger.Error().Err(err).Msg("Failed to lookup ansible-playbook path")
+			ec.logger().Error().Err(err).Msg("Failed to lookup ansible-playbook path")
 			return err
 		}
 		ec.AnsiblePlaybookPath = ansibleCmdPath
 	}
-	if ec.Config.Ansible == nil || ec.Config.Ansible.InventoryFile == "" || ec.Config.Ansible.PlaybookFile == "" {
-		log.Logger.Warn().Msg("Either Ansible inventory file or playbook were not specified. Aborting.")
-		return nil
+	ec.logger().Debug().Msgf("Using ansible-playbook command: %s", ec.AnsiblePlaybookPath)
+	ec.logger().Info().Msgf("Running ansible-playbook %s", playbook)
+	cmdPlaybook := &Command{
+		Path:   ec.AnsiblePlaybookPath,
+		Args:   []string{"-i", ec.Config.Ansible.InventoryFile},
+		Env:    append(os.Environ(), env...),
+		Dir:    ec.AnsibleWorkDir,
+		Stderr: ec.stderr(),
 	}
-	log.Logger.Debug().Msgf("Using ansible-playbook command: %s", ec.AnsiblePlaybookPath)
-	log.Logger.Info().Msgf("Running ansible-playbook %s", ec.Config.Ansible.PlaybookFile)
-	cmdPlaybook := osExec.Command(ec.AnsiblePlaybookPath, "-i", ec.Config.Ansible.InventoryFile, ec.Config.Ansible.PlaybookFile) //nolint:gosec
-	cmdPlaybook.Stdout = os.Stdout
-	cmdPlaybook.Stderr = os.Stderr
-	cmdPlaybook.Dir = ec.AnsibleWorkDir
-	cmdPlaybook.Env = append(cmdPlaybook.Env, os.Environ()...)
+	if limit == "" {
+		limit = ec.hostLimit
+	}
+	if limit != "" {
+		cmdPlaybook.Args = append(cmdPlaybook.Args, "--limit", limit)
+	}
+	cmdPlaybook.Args = append(cmdPlaybook.Args, playbook)
 	// append custom roles dir if needed
 	if ec.Config.TemplateConfig != nil && ec.Config.TemplateConfig.AnsibleRolesDir != "" {
-		log.Logger.Debug().Msgf("Ansible roles directory: %s", ec.Config.TemplateConfig.AnsibleRolesDir)
+		ec.logger().Debug().Msgf("Ansible roles directory: %s", ec.Config.TemplateConfig.AnsibleRolesDir)
 		cmdPlaybook.Env = append(cmdPlaybook.Env, "ANSIBLE_ROLES_PATH="+ec.Config.TemplateConfig.AnsibleRolesDir)
 	} else {
-		log.Logger.Info().Msg("No custom Ansible roles directory specified")
-	}
-	err := cmdPlaybook.Run()
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to run ansible-playbook")
-	}
-	return err
-}
-
-func (ec *ExecutionConfig) generateSSHConfig() error {
-	tmpl, err := gotmpl.New("ssh_config.tmpl").Delims("[[", "]]").ParseFS(resources, "resources/ssh_config.tmpl")
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to parse SSH config template")
-		return err
+		ec.logger().Info().Msg("No custom Ansible roles directory specified")
+	}
+	// use JSON callback to report task results as events, unless user explicitly selected another one
+	var lines *lineWriter
+	if ec.structuredOutput() && os.Getenv(ansibleCallbackEnvVar) == "" && ec.ansibleJSONCallbackAvailable() {
+		cmdPlaybook.Env = append(cmdPlaybook.Env, ansibleCallbackEnvVar+"="+ansibleJSONCallback)
+		parser := &ansibleParser{}
+		lines = ec.machineOutputWriter(parser.parseLine)
+		cmdPlaybook.Stdout = lines
+	} else {
+		cmdPlaybook.Stdout = ec.stdout()
 	}
-	sha := sha256.New()
-	sha.Write([]byte(ec.ConfigFilePath))
-	configHash := sha.Sum(nil)
-	sshConfigFileName := fmt.Sprintf("ssh_config_%s", hex.EncodeToString(configHash)[0:8])
-	tmpDir := os.TempDir()
-	outFilePath := path.Join(tmpDir, sshConfigFileName)
-	outFile, err := os.Create(outFilePath)
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to create SSH config file")
-		return err
+	err := ec.runLogged("ansible-playbook", cmdPlaybook)
+	if lines != nil {
+		lines.Flush()
 	}
-	defer outFile.Close()
-	err = tmpl.Execute(outFile, ec.Config)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to execute SSH config template")
-		return err
+		ec.logger().Error().Err(err).Msg("Failed to run ansible-playbook")
 	}
-	ec.Config.ProcessingVars["ssh_config_file"] = outFilePath
-	log.Logger.Debug().Msgf("Generated SSH config file: %s", outFilePath)
-	return nil
+	return err
 }
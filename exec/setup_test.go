@@ -4,10 +4,16 @@
 package exec
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/event"
 	"github.com/bitshifted/liftoff/log"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -26,6 +32,8 @@ func TestExecutionSetuptestSuite(t *testing.T) {
 }
 
 func (ts *ExecutionSetupTestSuite) TestSshConfigFile_NoBastion() {
+	homeDir := ts.T().TempDir()
+	ts.T().Setenv("HOME", homeDir)
 	ec := &ExecutionConfig{
 		Config: &config.Configuration{
 			ProcessingVars: map[string]interface{}{
@@ -37,10 +45,18 @@ func (ts *ExecutionSetupTestSuite) TestSshConfigFile_NoBastion() {
 	}
 	err := ec.generateSSHConfig()
 	ts.NoError(err)
-	ts.Equal("/tmp/ssh_config_67fc95d4", ec.Config.ProcessingVars["ssh_config_file"])
+	configPath := filepath.Join(homeDir, ".liftoff", "config-"+configPathHash("/path/to/config.yaml"), "ssh", "config")
+	ts.Equal(configPath, ec.Config.ProcessingVars["ssh_config_file"])
+	info, err := os.Stat(configPath)
+	ts.NoError(err)
+	ts.Equal(os.FileMode(0o600), info.Mode().Perm())
+	// snippet is not linked unless requested
+	ts.NoFileExists(ec.sshLinkPath())
 }
 
 func (ts *ExecutionSetupTestSuite) TestSshConfigFile_WithBastion() {
+	homeDir := ts.T().TempDir()
+	ts.T().Setenv("HOME", homeDir)
 	ec := &ExecutionConfig{
 		Config: &config.Configuration{
 			ProcessingVars: map[string]interface{}{
@@ -53,5 +69,307 @@ func (ts *ExecutionSetupTestSuite) TestSshConfigFile_WithBastion() {
 	}
 	err := ec.generateSSHConfig()
 	ts.NoError(err)
-	ts.Equal("/tmp/ssh_config_361b7624", ec.Config.ProcessingVars["ssh_config_file"])
+	ts.Equal(filepath.Join(homeDir, ".liftoff", "config-"+configPathHash("/bastion/config.yaml"), "ssh", "config"),
+		ec.Config.ProcessingVars["ssh_config_file"])
+}
+
+func (ts *ExecutionSetupTestSuite) TestSshConfigFile_LinksIncludeSnippet() {
+	homeDir := ts.T().TempDir()
+	ts.T().Setenv("HOME", homeDir)
+	ec := &ExecutionConfig{
+		Config: &config.Configuration{
+			ProcessingVars: map[string]interface{}{
+				"ansible_user":         "testuser",
+				"ansible_bastion_host": "bastion.example.com",
+				SSHHostsOutput: map[string]interface{}{
+					"web": map[string]interface{}{"address": "10.0.0.5", "host_keys": "ssh-ed25519 AAAAweb"},
+				},
+			},
+		},
+		ConfigFilePath: "/bastion/config.yaml",
+		LinkSSHConfig:  true,
+	}
+	err := ec.generateSSHConfig()
+	ts.NoError(err)
+	linkPath := filepath.Join(homeDir, ".ssh", "config.d", "liftoff-config-"+configPathHash("/bastion/config.yaml")+".conf")
+	target, err := os.Readlink(linkPath)
+	ts.NoError(err)
+	ts.Equal(ec.sshIncludeFilePath(), target)
+	content, err := os.ReadFile(linkPath)
+	ts.NoError(err)
+	// snippet has no catch-all entry, and each host has complete settings
+	ts.NotContains(string(content), "Host *")
+	ts.Contains(string(content), "Host bastion.example.com\nHostName bastion.example.com\nUser testuser\n")
+	ts.Contains(string(content), "Host web\nHostName 10.0.0.5\nUser testuser\nIdentityFile ~/.ssh/id_rsa\nForwardAgent yes\n"+
+		"ProxyJump bastion.example.com\nStrictHostKeyChecking yes\nUserKnownHostsFile "+ec.sshKnownHostsFilePath()+"\n")
+
+	ts.NoError(ec.unlinkSSHInclude())
+	ts.NoFileExists(linkPath)
+	ts.FileExists(ec.sshIncludeFilePath())
+}
+
+func (ts *ExecutionSetupTestSuite) TestSshConfigFile_SeparatePerConfigPath() {
+	homeDir := ts.T().TempDir()
+	ts.T().Setenv("HOME", homeDir)
+	newConfig := func(configPath string) *ExecutionConfig {
+		return &ExecutionConfig{
+			Config: &config.Configuration{
+				ProcessingVars: map[string]interface{}{
+					"ansible_user":         "testuser",
+					"ansible_bastion_host": "bastion.example.com",
+				},
+			},
+			ConfigFilePath: configPath,
+			LinkSSHConfig:  true,
+		}
+	}
+	// paths share first bytes, which named data directory in previous versions
+	first := newConfig("/home/alice/proj1/liftoff.yaml")
+	second := newConfig("/home/alice/proj2/liftoff.yaml")
+	ts.NoError(first.generateSSHConfig())
+	ts.NoError(second.generateSSHConfig())
+	ts.Equal(filepath.Join(homeDir, ".liftoff", "liftoff-"+configPathHash("/home/alice/proj1/liftoff.yaml"), "ssh", "config"),
+		first.sshConfigFilePath())
+	ts.NotEqual(first.sshConfigFilePath(), second.sshConfigFilePath())
+	ts.NotEqual(first.sshKnownHostsFilePath(), second.sshKnownHostsFilePath())
+	ts.NotEqual(first.sshLinkPath(), second.sshLinkPath())
+
+	ts.NoError(first.unlinkSSHInclude())
+	ts.NoFileExists(first.sshLinkPath())
+	ts.FileExists(second.sshLinkPath())
+}
+
+func (ts *ExecutionSetupTestSuite) newSetupExecutionConfig(runner Runner) *ExecutionConfig {
+	tmplDir, err := filepath.Abs("test_files/template")
+	ts.NoError(err)
+	return &ExecutionConfig{
+		Config: &config.Configuration{
+			TemplateDir: tmplDir,
+			Ansible: &config.AnsibleConfig{
+				InventoryFile: "inventory",
+				PlaybookFile:  "playbook.yaml",
+			},
+			ProcessingVars: map[string]interface{}{
+				"server_name": "web",
+			},
+		},
+		ConfigFilePath: filepath.Join(ts.T().TempDir(), "liftoff.yaml"),
+		Runner:         runner,
+	}
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_RunsAllCommands() {
+	runner := newScriptedRunner().withTerraformOutputs(`{"server_ip": {"sensitive": false, "type": "string", "value": "10.0.0.5"}}`)
+	ec := ts.newSetupExecutionConfig(runner)
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform output -json",
+		"/usr/bin/ansible-playbook -i inventory playbook.yaml",
+	}, runner.commandLines())
+	// verify working directories and environment
+	outputDir := strings.TrimSuffix(ec.ConfigFilePath, ".yaml")
+	ts.Equal(filepath.Join(outputDir, "terraform"), runner.commands[0].Dir)
+	ts.Equal(filepath.Join(outputDir, "ansible"), runner.commands[3].Dir)
+	ts.True(hasEnvVar(runner.commands[0].Env, "TF_DATA_DIR"))
+	// verify Terraform output is available in Ansible templates
+	ts.Equal("10.0.0.5", ec.Config.ProcessingVars["server_ip"])
+	inventory, err := os.ReadFile(filepath.Join(outputDir, "ansible", "inventory"))
+	ts.NoError(err)
+	ts.Contains(string(inventory), "10.0.0.5")
+	tfFile, err := os.ReadFile(filepath.Join(outputDir, "terraform", "main.tf"))
+	ts.NoError(err)
+	ts.Contains(string(tfFile), `resource "null_resource" "web"`)
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_KeepsOutputTypesAndMasksSensitiveValues() {
+	runner := newScriptedRunner().withTerraformOutputs(`{
+		"server_ip": {"sensitive": false, "type": "string", "value": "10.0.0.5"},
+		"db_password": {"sensitive": true, "type": "string", "value": "secret"},
+		"ports": {"sensitive": false, "type": ["list", "number"], "value": [22, 443]}
+	}`)
+	ec := ts.newSetupExecutionConfig(runner)
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs).Level(zerolog.DebugLevel)
+	ec.Logger = &logger
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Equal([]string{"db_password"}, ec.Report.SensitiveOutputs)
+	ts.Equal("list(number)", ec.Report.TerraformOutputs["ports"].TypeName())
+	ts.True(ec.Report.TerraformOutputs["db_password"].Sensitive)
+	ts.Equal("secret", ec.Config.Outputs["db_password"])
+	ts.Equal("secret", ec.Config.ProcessingVars["db_password"])
+	ts.Contains(logs.String(), "Terraform output db_password (string): <sensitive>")
+	ts.Contains(logs.String(), "Terraform output server_ip (string): 10.0.0.5")
+	ts.NotContains(logs.String(), "secret")
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_StopsOnOutputFailure() {
+	runner := newScriptedRunner().withFailure("output", errScripted)
+	ec := ts.newSetupExecutionConfig(runner)
+	err := ec.ExecuteSetup()
+	ts.ErrorIs(err, errScripted)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+		"/usr/bin/terraform output -json",
+	}, runner.commandLines())
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_RejectsInvalidOutputs() {
+	runner := newScriptedRunner().withTerraformOutputs(`{"server_ip": "10.0.0.5"}`)
+	ec := ts.newSetupExecutionConfig(runner)
+	err := ec.ExecuteSetup()
+	ts.ErrorContains(err, "invalid Terraform output 'server_ip'")
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_SkipTerraformAndAnsible() {
+	runner := newScriptedRunner()
+	ec := ts.newSetupExecutionConfig(runner)
+	ec.SkipTerraform = true
+	ec.SkipAnsible = true
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Equal([]string{"/usr/bin/terraform output -json"}, runner.commandLines())
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_StopsOnTerraformFailure() {
+	runner := newScriptedRunner().withFailure("apply", errScripted)
+	ec := ts.newSetupExecutionConfig(runner)
+	err := ec.ExecuteSetup()
+	ts.ErrorIs(err, errScripted)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -json",
+	}, runner.commandLines())
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_UsesPlaybookPathAndRolesDir() {
+	runner := newScriptedRunner()
+	ec := ts.newSetupExecutionConfig(runner)
+	ec.SkipTerraform = true
+	ec.AnsiblePlaybookPath = "/opt/ansible/bin/ansible-playbook"
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Len(runner.commands, 2)
+	ts.Equal("/opt/ansible/bin/ansible-playbook", runner.commands[1].Path)
+	ts.Contains(runner.commands[1].Env, "ANSIBLE_ROLES_PATH="+filepath.Join(ec.Config.TemplateDir, "ansible/roles"))
+}
+
+func hasEnvVar(env []string, name string) bool {
+	for _, e := range env {
+		if strings.HasPrefix(e, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_MachineReadableEmitsEvents() {
+	runner := newScriptedRunner().withTerraformOutputs(`{"server_ip": {"value": "10.0.0.5"}}`)
+	runner.withOutput("apply", `{"type":"apply_complete","hook":{"resource":{"addr":"null_resource.web"},"action":"create","elapsed_seconds":1}}`+
+		"\nplain text line\n")
+	runner.withOutput("collection list", `{"/usr/share/ansible/collections": {"ansible.posix": {"version": "1.6.2"}}}`)
+	ec := ts.newSetupExecutionConfig(runner)
+	ec.MachineReadable = true
+	var events []event.Event
+	ec.OnEvent = func(e event.Event) { events = append(events, e) }
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Equal("/usr/bin/ansible-galaxy", runner.commands[3].Path)
+	ts.Contains(runner.commands[4].Env, "ANSIBLE_STDOUT_CALLBACK=ansible.posix.jsonl")
+	// raw output is saved to per-run log file
+	logData, err := os.ReadFile(filepath.Join(ec.OutputDir, "logs", ec.RunID, "terraform-apply.log"))
+	ts.NoError(err)
+	ts.Contains(string(logData), "apply_complete")
+
+	counts := map[event.Type]int{}
+	for _, e := range events {
+		counts[e.Type]++
+		if e.Type == event.ResourceChanged {
+			ts.Equal(PhaseTerraform, e.Phase)
+			ts.Equal("null_resource.web", e.Resource.Address)
+		}
+		if e.Type == event.PhaseFinished && e.Phase == PhaseTerraform {
+			ts.Equal("plain text line\n", e.Output)
+		}
+	}
+	ts.Equal(1, counts[event.ResourceChanged])
+	ts.Equal(3, counts[event.TemplateRendered])
+	ts.Equal(0, counts[event.Error])
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_DefaultAnsibleCallback() {
+	// without event handler, output is not parsed
+	runner := newScriptedRunner()
+	ec := ts.newSetupExecutionConfig(runner)
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	playbookCmd := runner.commands[len(runner.commands)-1]
+	ts.Equal("/usr/bin/ansible-playbook", playbookCmd.Path)
+	ts.False(hasEnvVar(playbookCmd.Env, "ANSIBLE_STDOUT_CALLBACK"))
+
+	// with event handler, but without collection providing JSON callback
+	runner = newScriptedRunner().withOutput("collection list", "{}")
+	ec = ts.newSetupExecutionConfig(runner)
+	ec.OnEvent = func(e event.Event) {}
+	err = ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Equal("/usr/bin/ansible-galaxy collection list ansible.posix --format json", runner.commandLines()[3])
+	playbookCmd = runner.commands[4]
+	ts.Equal("/usr/bin/ansible-playbook", playbookCmd.Path)
+	ts.False(hasEnvVar(playbookCmd.Env, "ANSIBLE_STDOUT_CALLBACK"))
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_EmitsErrorEvent() {
+	runner := newScriptedRunner().withFailure("init", errScripted)
+	ec := ts.newSetupExecutionConfig(runner)
+	var errorEvents []event.Event
+	ec.OnEvent = func(e event.Event) {
+		if e.Type == event.Error {
+			errorEvents = append(errorEvents, e)
+		}
+	}
+	err := ec.ExecuteSetup()
+	ts.Error(err)
+	ts.Len(errorEvents, 1)
+	ts.Equal(PhaseTerraform, errorEvents[0].Phase)
+	ts.Equal(errScripted.Error(), errorEvents[0].Error)
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_WithTargets() {
+	runner := newScriptedRunner().
+		withTerraformOutputs(`{"server_ip": {"sensitive": false, "type": "string", "value": "10.0.0.5"}}`).
+		withOutput("show -json", testTerraformState)
+	ec := ts.newSetupExecutionConfig(runner)
+	ec.Targets = []string{"hcloud_server.db"}
+	ec.Replace = []string{"hcloud_server.db"}
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -auto-approve -target=hcloud_server.db -replace=hcloud_server.db -json",
+		"/usr/bin/terraform output -json",
+		"/usr/bin/terraform show -json",
+		"/usr/bin/ansible-playbook -i inventory --limit db,10.0.0.6 playbook.yaml",
+	}, runner.commandLines())
+}
+
+func (ts *ExecutionSetupTestSuite) TestExecuteSetup_StackUsesSeparateDirectories() {
+	runner := newScriptedRunner()
+	ec := ts.newSetupExecutionConfig(runner)
+	ec.StackName = "network"
+	ec.SkipAnsible = true
+	var stacks []string
+	ec.OnEvent = func(e event.Event) { stacks = append(stacks, e.Stack) }
+	err := ec.ExecuteSetup()
+	ts.NoError(err)
+	ts.Equal(filepath.Join(OutputDirPath(ec.ConfigFilePath), "network", "terraform"), ec.TerraformWorkDir)
+	ts.Contains(ec.calculateTerraformDataDir(), "liftoff-network-")
+	ts.NotEmpty(stacks)
+	for _, stack := range stacks {
+		ts.Equal("network", stack)
+	}
 }
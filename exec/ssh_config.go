@@ -0,0 +1,272 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	gotmpl "text/template"
+)
+
+const (
+	// SSHConfigFileVar is the name of processing variable holding path of generated SSH config
+	SSHConfigFileVar = "ssh_config_file"
+	// SSHIncludeFileVar is the name of processing variable holding path of SSH config snippet, which can be
+	// included from user's SSH config
+	SSHIncludeFileVar = "ssh_include_file"
+
+	sshDirName         = "ssh"
+	sshConfigFileName  = "config"
+	sshIncludeFileName = "hosts.conf"
+	sshKnownHostsName  = "known_hosts"
+	// directory in user's SSH directory from which snippets are linked
+	sshConfigLinkDir = ".ssh/config.d"
+)
+
+// data passed to SSH config templates
+type sshConfigData struct {
+	ConfigFilePath string
+	ProcessingVars map[string]interface{}
+	Hosts          []SSHHost
+	KnownHostsFile string
+}
+
+// generates SSH config from hosts in processing variables
+func (ec *ExecutionConfig) generateSSHConfig() error {
+	hosts, err := parseSSHHosts(ec.Config.ProcessingVars[SSHHostsOutput])
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Invalid SSH hosts")
+		return err
+	}
+	err = resolveJumpChains(hosts)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Invalid SSH hosts")
+		return err
+	}
+	err = ec.saveSSHHosts(hosts)
+	if err != nil {
+		return err
+	}
+	return ec.writeSSHConfig(hosts)
+}
+
+// uses SSH config generated by previous run, or generates it if it does not exist
+func (ec *ExecutionConfig) useGeneratedSSHConfig() error {
+	outFilePath := ec.sshConfigFilePath()
+	hosts, found, err := ec.loadSSHHosts()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(outFilePath); err != nil || !found {
+		return ec.generateSSHConfig()
+	}
+	ec.Config.ProcessingVars[SSHConfigFileVar] = outFilePath
+	ec.Config.ProcessingVars[SSHIncludeFileVar] = ec.sshIncludeFilePath()
+	ec.report().SSHConfigFile = outFilePath
+	ec.report().SSHHosts = hosts
+	if _, err = os.Stat(ec.sshKnownHostsFilePath()); err == nil {
+		ec.Config.ProcessingVars[SSHKnownHostsVar] = ec.sshKnownHostsFilePath()
+	}
+	return nil
+}
+
+// writes SSH config used by Ansible, known hosts and snippet with host entries only, which can be included
+// from user's SSH config. Snippet is linked into ~/.ssh/config.d if requested
+func (ec *ExecutionConfig) writeSSHConfig(hosts []SSHHost) error {
+	err := os.MkdirAll(ec.sshDirPath(), 0o700)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to create SSH config directory")
+		return err
+	}
+	knownHostsPath, err := ec.writeKnownHosts(hosts)
+	if err != nil {
+		return err
+	}
+	data := sshConfigData{
+		ConfigFilePath: ec.ConfigFilePath,
+		ProcessingVars: ec.Config.ProcessingVars,
+		Hosts:          hosts,
+		KnownHostsFile: knownHostsPath,
+	}
+	outFilePath := ec.sshConfigFilePath()
+	err = ec.renderSSHFile("ssh_config.tmpl", outFilePath, data)
+	if err != nil {
+		return err
+	}
+	data.Hosts = includeHosts(hosts, ec.Config.ProcessingVars)
+	err = ec.renderSSHFile("ssh_include.tmpl", ec.sshIncludeFilePath(), data)
+	if err != nil {
+		return err
+	}
+	if ec.LinkSSHConfig {
+		if err = ec.linkSSHInclude(); err != nil {
+			return err
+		}
+	}
+	ec.Config.ProcessingVars[SSHConfigFileVar] = outFilePath
+	ec.Config.ProcessingVars[SSHIncludeFileVar] = ec.sshIncludeFilePath()
+	ec.report().SSHConfigFile = outFilePath
+	ec.report().SSHHosts = hosts
+	if knownHostsPath != "" {
+		ec.Config.ProcessingVars[SSHKnownHostsVar] = knownHostsPath
+	}
+	ec.logger().Debug().Msgf("Generated SSH config file: %s", outFilePath)
+	return nil
+}
+
+func (ec *ExecutionConfig) renderSSHFile(templateName, outFilePath string, data sshConfigData) error {
+	tmpl, err := gotmpl.New(templateName).Delims("[[", "]]").ParseFS(resources, "resources/"+templateName)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to parse SSH config template")
+		return err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to execute SSH config template")
+		return err
+	}
+	err = writePrivateFile(outFilePath, buf.Bytes())
+	if err != nil {
+		ec.logger().Error().Err(err).Msgf("Failed to write SSH config file %s", outFilePath)
+	}
+	return err
+}
+
+// returns hosts for include snippet. Hosts without jump host are reached through bastion, like in generated
+// config, and bastion gets its own entry if it is not one of the hosts
+func includeHosts(hosts []SSHHost, vars map[string]interface{}) []SSHHost {
+	bastion, _ := vars["ansible_bastion_host"].(string)
+	result := make([]SSHHost, 0, len(hosts)+1)
+	bastionFound := false
+	for _, host := range hosts {
+		if host.Alias == bastion {
+			bastionFound = true
+		} else if host.ProxyJump == "" {
+			host.ProxyJump = bastion
+		}
+		result = append(result, host)
+	}
+	if bastion != "" && !bastionFound {
+		result = append([]SSHHost{{Alias: bastion, Address: bastion, Port: defaultSSHPort}}, result...)
+	}
+	return result
+}
+
+// links include snippet into ~/.ssh/config.d, replacing existing link
+func (ec *ExecutionConfig) linkSSHInclude() error {
+	linkPath := ec.sshLinkPath()
+	if linkPath == "" {
+		return errors.New("home directory is not available")
+	}
+	err := os.MkdirAll(filepath.Dir(linkPath), 0o700)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Lstat(linkPath); err == nil {
+		if err = os.Remove(linkPath); err != nil {
+			return err
+		}
+	}
+	err = os.Symlink(ec.sshIncludeFilePath(), linkPath)
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to link SSH config")
+		return err
+	}
+	ec.logger().Info().Msgf("Linked SSH config to %s", linkPath)
+	ec.warnLegacySSHLink()
+	return nil
+}
+
+// reports link created by previous versions, which is named after data directory that may be shared by several
+// configurations. It is not removed, since it may belong to another configuration
+func (ec *ExecutionConfig) warnLegacySSHLink() {
+	legacyLink := sshLinkPathFor(ec.legacyTerraformDataDir())
+	if legacyLink == "" {
+		return
+	}
+	if _, err := os.Lstat(legacyLink); err == nil {
+		ec.logger().Warn().Msgf("SSH config link %s created by previous version may duplicate host entries. "+
+			"Remove it manually if no other configuration uses it", legacyLink)
+	}
+}
+
+// removes link to include snippet, if it points to snippet of this configuration
+func (ec *ExecutionConfig) unlinkSSHInclude() error {
+	linkPath := ec.sshLinkPath()
+	if linkPath == "" {
+		return nil
+	}
+	target, err := os.Readlink(linkPath)
+	if err != nil || target != ec.sshIncludeFilePath() {
+		return nil
+	}
+	ec.logger().Info().Msgf("Removing %s", linkPath)
+	return os.Remove(linkPath)
+}
+
+// returns directory for generated SSH files, which is located in per-configuration data directory
+func (ec *ExecutionConfig) sshDirPath() string {
+	if dataDir := ec.calculateTerraformDataDir(); dataDir != "" {
+		return path.Join(dataDir, sshDirName)
+	}
+	return path.Join(ec.outputDirPath(), sshDirName)
+}
+
+// SSHConfigFilePath returns path of generated SSH config
+func (ec *ExecutionConfig) SSHConfigFilePath() string {
+	return ec.sshConfigFilePath()
+}
+
+func (ec *ExecutionConfig) sshConfigFilePath() string {
+	return path.Join(ec.sshDirPath(), sshConfigFileName)
+}
+
+func (ec *ExecutionConfig) sshKnownHostsFilePath() string {
+	return path.Join(ec.sshDirPath(), sshKnownHostsName)
+}
+
+func (ec *ExecutionConfig) sshIncludeFilePath() string {
+	return path.Join(ec.sshDirPath(), sshIncludeFileName)
+}
+
+// returns path of link to include snippet in ~/.ssh/config.d, named after per-configuration data directory
+func (ec *ExecutionConfig) sshLinkPath() string {
+	return sshLinkPathFor(ec.calculateTerraformDataDir())
+}
+
+func sshLinkPathFor(dataDir string) string {
+	homeDir, err := os.UserHomeDir()
+	if dataDir == "" || err != nil {
+		return ""
+	}
+	return path.Join(homeDir, sshConfigLinkDir, "liftoff-"+filepath.Base(dataDir)+".conf")
+}
+
+// returns path of SSH config written to temporary directory by previous versions
+func (ec *ExecutionConfig) legacySSHConfigFilePath() string {
+	sha := sha256.New()
+	sha.Write([]byte(ec.ConfigFilePath))
+	if ec.StackName != "" {
+		sha.Write([]byte("#" + ec.StackName))
+	}
+	configHash := sha.Sum(nil)
+	return path.Join(os.TempDir(), fmt.Sprintf("ssh_config_%s", hex.EncodeToString(configHash)[0:8]))
+}
+
+// writes file readable only by the owner
+func writePrivateFile(filePath string, data []byte) error {
+	err := os.WriteFile(filePath, data, 0o600)
+	if err != nil {
+		return err
+	}
+	// permissions of existing file are not changed by WriteFile
+	return os.Chmod(filePath, 0o600)
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SSHHostsOutput is the name of Terraform output (or variable) describing hosts added to SSH config
+	SSHHostsOutput = "ssh_hosts"
+	// SSHKnownHostsVar is the name of processing variable holding path of managed known_hosts file
+	SSHKnownHostsVar = "ssh_known_hosts_file"
+
+	defaultSSHPort = 22
+)
+
+// SSHHost is a single host entry in generated SSH config
+type SSHHost struct {
+	Alias        string   `json:"alias"`
+	Address      string   `json:"address"`
+	User         string   `json:"user,omitempty"`
+	Port         int      `json:"port"`
+	IdentityFile string   `json:"identity_file,omitempty"`
+	JumpHost     string   `json:"jump_host,omitempty"`
+	HostKeys     []string `json:"host_keys,omitempty"`
+	// ProxyJump is complete chain of jump hosts, resolved from JumpHost
+	ProxyJump string `json:"proxy_jump,omitempty"`
+}
+
+// parses hosts from value of ssh_hosts output. Value is either a list of host objects, or a map of
+// host objects keyed by alias
+func parseSSHHosts(value interface{}) ([]SSHHost, error) {
+	var hosts []SSHHost
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		for i, item := range v {
+			attrs, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s[%d]: expected object, got %T", SSHHostsOutput, i, item)
+			}
+			host, err := parseSSHHost("", attrs)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", SSHHostsOutput, i, err)
+			}
+			hosts = append(hosts, host)
+		}
+	case map[string]interface{}:
+		aliases := make([]string, 0, len(v))
+		for alias := range v {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			attrs, ok := v[alias].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s.%s: expected object, got %T", SSHHostsOutput, alias, v[alias])
+			}
+			host, err := parseSSHHost(alias, attrs)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", SSHHostsOutput, alias, err)
+			}
+			hosts = append(hosts, host)
+		}
+	default:
+		return nil, fmt.Errorf("%s: expected list or map of hosts, got %T", SSHHostsOutput, value)
+	}
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if seen[host.Alias] {
+			return nil, fmt.Errorf("%s: duplicate host alias '%s'", SSHHostsOutput, host.Alias)
+		}
+		seen[host.Alias] = true
+	}
+	return hosts, nil
+}
+
+func parseSSHHost(alias string, attrs map[string]interface{}) (SSHHost, error) {
+	host := SSHHost{
+		Alias:        stringAttr(attrs, "alias"),
+		Address:      stringAttr(attrs, "address"),
+		User:         stringAttr(attrs, "user"),
+		IdentityFile: stringAttr(attrs, "identity_file"),
+		JumpHost:     stringAttr(attrs, "jump_host"),
+		Port:         defaultSSHPort,
+	}
+	if host.Alias == "" {
+		host.Alias = alias
+	}
+	if host.Alias == "" {
+		host.Alias = host.Address
+	}
+	if host.Address == "" {
+		host.Address = host.Alias
+	}
+	if host.Alias == "" {
+		return host, fmt.Errorf("host alias or address is required")
+	}
+	if strings.ContainsAny(host.Alias, " \t*?!") {
+		return host, fmt.Errorf("invalid host alias '%s'", host.Alias)
+	}
+	if port, ok := attrs["port"]; ok && port != nil {
+		p, err := portValue(port)
+		if err != nil {
+			return host, err
+		}
+		host.Port = p
+	}
+	keys, err := hostKeys(attrs["host_keys"])
+	if err != nil {
+		return host, err
+	}
+	host.HostKeys = keys
+	return host, nil
+}
+
+func stringAttr(attrs map[string]interface{}, name string) string {
+	if v, ok := attrs[name]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Terraform outputs decode numbers as float64, while variables decode them as int
+func portValue(value interface{}) (int, error) {
+	var port int
+	switch v := value.(type) {
+	case int:
+		port = v
+	case float64:
+		port = int(v)
+	case string:
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid port '%s'", v)
+		}
+		port = p
+	default:
+		return 0, fmt.Errorf("invalid port %v", value)
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %d", port)
+	}
+	return port, nil
+}
+
+// host keys are either a single key, a list of keys or a map of keys by type, as exported by cloud-init
+func hostKeys(value interface{}) ([]string, error) {
+	var keys []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		keys = []string{v}
+	case []interface{}:
+		for _, key := range v {
+			keys = append(keys, fmt.Sprint(key))
+		}
+	case map[string]interface{}:
+		types := make([]string, 0, len(v))
+		for keyType := range v {
+			types = append(types, keyType)
+		}
+		sort.Strings(types)
+		for _, keyType := range types {
+			keys = append(keys, fmt.Sprint(v[keyType]))
+		}
+	default:
+		return nil, fmt.Errorf("invalid host keys %v", value)
+	}
+	for i, key := range keys {
+		key = strings.TrimSpace(key)
+		if len(strings.Fields(key)) < 2 {
+			return nil, fmt.Errorf("invalid host key '%s', expected '<type> <key>'", key)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// resolves complete chain of jump hosts for each host. Jump host may be alias of another host, in
+// which case its own jump hosts come first, or an address of host which is not managed
+func resolveJumpChains(hosts []SSHHost) error {
+	byAlias := make(map[string]*SSHHost, len(hosts))
+	for i := range hosts {
+		byAlias[hosts[i].Alias] = &hosts[i]
+	}
+	for i := range hosts {
+		var chain []string
+		visited := map[string]bool{hosts[i].Alias: true}
+		current := &hosts[i]
+		for current != nil && current.JumpHost != "" {
+			jump := current.JumpHost
+			if visited[jump] {
+				return fmt.Errorf("jump host cycle for host '%s' through '%s'", hosts[i].Alias, jump)
+			}
+			visited[jump] = true
+			chain = append([]string{jump}, chain...)
+			current = byAlias[jump]
+		}
+		hosts[i].ProxyJump = strings.Join(chain, ",")
+	}
+	return nil
+}
+
+// returns content of known_hosts file for hosts which have host keys
+func knownHostsContent(hosts []SSHHost) string {
+	var sb strings.Builder
+	for _, host := range hosts {
+		if len(host.HostKeys) == 0 {
+			continue
+		}
+		names := []string{host.Alias}
+		if host.Address != host.Alias {
+			names = append(names, host.Address)
+		}
+		if host.Port != defaultSSHPort {
+			for i, name := range names {
+				names[i] = fmt.Sprintf("[%s]:%d", name, host.Port)
+			}
+		}
+		for _, key := range host.HostKeys {
+			sb.WriteString(strings.Join(names, ",") + " " + key + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// writes known_hosts file if any host has host keys, or removes stale file otherwise. Returns
+// path of written file, or empty string
+func (ec *ExecutionConfig) writeKnownHosts(hosts []SSHHost) (string, error) {
+	knownHostsPath := ec.sshKnownHostsFilePath()
+	content := knownHostsContent(hosts)
+	if content == "" {
+		if err := os.Remove(knownHostsPath); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		return "", nil
+	}
+	if err := writePrivateFile(knownHostsPath, []byte(content)); err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to write known hosts file")
+		return "", err
+	}
+	ec.logger().Debug().Msgf("Generated known hosts file: %s", knownHostsPath)
+	return knownHostsPath, nil
+}
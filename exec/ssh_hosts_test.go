@@ -0,0 +1,109 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const sshHostsOutputJSON = `{
+  "bastion": {"address": "203.0.113.10", "user": "admin", "host_keys": {"ed25519": "ssh-ed25519 AAAAbastion root@bastion"}},
+  "gateway": {"address": "10.0.0.2", "port": 2222, "jump_host": "bastion", "host_keys": ["ssh-ed25519 AAAAgateway"]},
+  "db": {"address": "10.1.0.5", "identity_file": "~/.ssh/db", "jump_host": "gateway"},
+  "legacy": {"address": "10.2.0.7", "jump_host": "jump.example.com"}
+}`
+
+func newSSHHostsExecutionConfig(t *testing.T, hosts interface{}) *ExecutionConfig {
+	t.Setenv("HOME", t.TempDir())
+	return &ExecutionConfig{
+		Config: &config.Configuration{
+			ProcessingVars: map[string]interface{}{
+				"ansible_user": "ansible",
+				SSHHostsOutput: hosts,
+			},
+		},
+		ConfigFilePath: filepath.Join(t.TempDir(), "liftoff.yaml"),
+	}
+}
+
+func TestGenerateSSHConfig_PerHostEntries(t *testing.T) {
+	var hosts interface{}
+	assert.NoError(t, json.Unmarshal([]byte(sshHostsOutputJSON), &hosts))
+	ec := newSSHHostsExecutionConfig(t, hosts)
+	assert.NoError(t, ec.generateSSHConfig())
+
+	content, err := os.ReadFile(ec.sshConfigFilePath())
+	assert.NoError(t, err)
+	sshConfig := string(content)
+	knownHostsPath := ec.sshKnownHostsFilePath()
+	assert.Contains(t, sshConfig, "Host bastion\nHostName 203.0.113.10\nUser admin\nStrictHostKeyChecking yes\nUserKnownHostsFile "+knownHostsPath+"\n")
+	assert.Contains(t, sshConfig, "Host gateway\nHostName 10.0.0.2\nPort 2222\nProxyJump bastion\nStrictHostKeyChecking yes\n")
+	assert.Contains(t, sshConfig, "Host db\nHostName 10.1.0.5\nIdentityFile ~/.ssh/db\nProxyJump bastion,gateway\n\n")
+	assert.Contains(t, sshConfig, "Host legacy\nHostName 10.2.0.7\nProxyJump jump.example.com\n")
+	// hosts without keys keep default settings
+	assert.Contains(t, sshConfig, "Host * \nUser ansible\n")
+	assert.Equal(t, knownHostsPath, ec.Config.ProcessingVars[SSHKnownHostsVar])
+
+	knownHosts, err := os.ReadFile(knownHostsPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "bastion,203.0.113.10 ssh-ed25519 AAAAbastion root@bastion\n"+
+		"[gateway]:2222,[10.0.0.2]:2222 ssh-ed25519 AAAAgateway\n", string(knownHosts))
+	info, err := os.Stat(knownHostsPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestGenerateSSHConfig_RemovesStaleKnownHosts(t *testing.T) {
+	ec := newSSHHostsExecutionConfig(t, []interface{}{
+		map[string]interface{}{"alias": "web", "address": "10.0.0.3"},
+	})
+	assert.NoError(t, os.MkdirAll(ec.sshDirPath(), 0o700))
+	assert.NoError(t, os.WriteFile(ec.sshKnownHostsFilePath(), []byte("stale"), 0o600))
+	assert.NoError(t, ec.generateSSHConfig())
+	assert.NoFileExists(t, ec.sshKnownHostsFilePath())
+	assert.NotContains(t, ec.Config.ProcessingVars, SSHKnownHostsVar)
+}
+
+func TestParseSSHHosts(t *testing.T) {
+	hosts, err := parseSSHHosts([]interface{}{
+		map[string]interface{}{"address": "10.0.0.3", "port": "2200", "host_keys": "ecdsa-sha2-nistp256 AAAAweb"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []SSHHost{{
+		Alias:    "10.0.0.3",
+		Address:  "10.0.0.3",
+		Port:     2200,
+		HostKeys: []string{"ecdsa-sha2-nistp256 AAAAweb"},
+	}}, hosts)
+
+	_, err = parseSSHHosts("web")
+	assert.ErrorContains(t, err, "expected list or map of hosts")
+	_, err = parseSSHHosts([]interface{}{map[string]interface{}{"user": "root"}})
+	assert.ErrorContains(t, err, "host alias or address is required")
+	_, err = parseSSHHosts(map[string]interface{}{"web": map[string]interface{}{"port": 70000}})
+	assert.ErrorContains(t, err, "invalid port 70000")
+	_, err = parseSSHHosts(map[string]interface{}{"web": map[string]interface{}{"host_keys": []interface{}{"AAAA"}}})
+	assert.ErrorContains(t, err, "invalid host key")
+	_, err = parseSSHHosts([]interface{}{
+		map[string]interface{}{"alias": "web"},
+		map[string]interface{}{"alias": "web", "address": "10.0.0.4"},
+	})
+	assert.ErrorContains(t, err, "duplicate host alias 'web'")
+}
+
+func TestResolveJumpChains_Cycle(t *testing.T) {
+	hosts := []SSHHost{
+		{Alias: "a", JumpHost: "b"},
+		{Alias: "b", JumpHost: "c"},
+		{Alias: "c", JumpHost: "a"},
+	}
+	err := resolveJumpChains(hosts)
+	assert.ErrorContains(t, err, "jump host cycle for host 'a' through 'a'")
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotConfirmed is returned when user does not confirm destruction of targeted resources
+var ErrNotConfirmed = errors.New("teardown was not confirmed")
+
+// attributes of Terraform resources which identify hosts in Ansible inventory
+var hostAttributes = []string{"name", "ipv4_address"}
+
+// module in "terraform show -json" output
+type terraformStateModule struct {
+	Resources []struct {
+		Address string                 `json:"address"`
+		Values  map[string]interface{} `json:"values"`
+	} `json:"resources"`
+	ChildModules []terraformStateModule `json:"child_modules"`
+}
+
+type terraformState struct {
+	Values *struct {
+		RootModule terraformStateModule `json:"root_module"`
+	} `json:"values"`
+}
+
+// returns Terraform arguments for resource targeting and replacement
+func (ec *ExecutionConfig) targetArgs() []string {
+	args := make([]string, 0, len(ec.Targets)+len(ec.Replace))
+	for _, target := range ec.Targets {
+		args = append(args, "-target="+target)
+	}
+	for _, replace := range ec.Replace {
+		args = append(args, "-replace="+replace)
+	}
+	return args
+}
+
+// calculates Ansible host limit from names and addresses of targeted resources. Returns false if
+// there are targets, but none of them is associated with a host
+func (ec *ExecutionConfig) resolveHostLimit() (bool, error) {
+	ec.hostLimit = ""
+	if len(ec.Targets) == 0 {
+		return true, nil
+	}
+	hosts, err := ec.targetHosts()
+	if err != nil {
+		return false, err
+	}
+	if len(hosts) == 0 {
+		ec.logger().Warn().Msgf("No hosts found for targets %v", ec.Targets)
+		return false, nil
+	}
+	ec.hostLimit = strings.Join(hosts, ",")
+	ec.logger().Info().Msgf("Limiting Ansible to hosts: %s", ec.hostLimit)
+	return true, nil
+}
+
+// returns host names and addresses of resources matching targets, based on Terraform state
+func (ec *ExecutionConfig) targetHosts() ([]string, error) {
+	var buf bytes.Buffer
+	err := ec.runTerraform(&buf, "show", "-json")
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to run Terraform show")
+		return nil, err
+	}
+	var state terraformState
+	if buf.Len() > 0 {
+		if err = json.Unmarshal(buf.Bytes(), &state); err != nil {
+			return nil, fmt.Errorf("failed to parse Terraform state: %w", err)
+		}
+	}
+	if state.Values == nil {
+		return nil, nil
+	}
+	var hosts []string
+	seen := map[string]bool{}
+	collectTargetHosts(&state.Values.RootModule, ec.Targets, func(host string) {
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	})
+	return hosts, nil
+}
+
+func collectTargetHosts(module *terraformStateModule, targets []string, add func(host string)) {
+	for _, resource := range module.Resources {
+		if !matchesAnyTarget(resource.Address, targets) {
+			continue
+		}
+		for _, attr := range hostAttributes {
+			if value, ok := resource.Values[attr].(string); ok && value != "" {
+				add(value)
+			}
+		}
+	}
+	for i := range module.ChildModules {
+		collectTargetHosts(&module.ChildModules[i], targets, add)
+	}
+}
+
+// checks if resource address is selected by any of the targets. Target selects resource with the same
+// address, all instances of resource and all resources in a module
+func matchesAnyTarget(address string, targets []string) bool {
+	for _, target := range targets {
+		if address == target || strings.HasPrefix(address, target+".") || strings.HasPrefix(address, target+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// shows plan for destroying targeted resources and asks user to confirm it
+func (ec *ExecutionConfig) confirmTargetedDestroy() error {
+	if err := ec.ensureTerraformInit(); err != nil {
+		return err
+	}
+	ec.logger().Info().Msg("Running Terraform plan for targeted resources...")
+	args := append([]string{"plan", "-destroy", "-input=false"}, ec.targetArgs()...)
+	if err := ec.executeTerraformCommand(args...); err != nil {
+		ec.logger().Error().Err(err).Msg("Terraform plan failed")
+		return err
+	}
+	if ec.AutoApprove {
+		return nil
+	}
+	if ec.Confirm == nil {
+		return fmt.Errorf("%w: confirmation is required to destroy targeted resources", ErrNotConfirmed)
+	}
+	ok, err := ec.Confirm(fmt.Sprintf("Destroy resources %s?", strings.Join(ec.Targets, ", ")))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotConfirmed
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTerraformState = `{
+  "values": {
+    "root_module": {
+      "resources": [
+        {"address": "hcloud_server.web[0]", "values": {"name": "web-1", "ipv4_address": "10.0.0.5"}},
+        {"address": "hcloud_server.db", "values": {"name": "db", "ipv4_address": "10.0.0.6"}}
+      ],
+      "child_modules": [
+        {
+          "address": "module.app",
+          "resources": [
+            {"address": "module.app.hcloud_server.app", "values": {"name": "app"}}
+          ]
+        }
+      ]
+    }
+  }
+}`
+
+func TestMatchesAnyTarget(t *testing.T) {
+	assert.True(t, matchesAnyTarget("hcloud_server.web", []string{"hcloud_server.web"}))
+	assert.True(t, matchesAnyTarget("hcloud_server.web[0]", []string{"hcloud_server.web"}))
+	assert.True(t, matchesAnyTarget("module.app.hcloud_server.app", []string{"module.app"}))
+	assert.False(t, matchesAnyTarget("hcloud_server.web2", []string{"hcloud_server.web"}))
+	assert.False(t, matchesAnyTarget("hcloud_server.web", nil))
+}
+
+func TestTargetArgs(t *testing.T) {
+	ec := &ExecutionConfig{
+		Targets: []string{"hcloud_server.web", "module.app"},
+		Replace: []string{"hcloud_server.db"},
+	}
+	assert.Equal(t, []string{"-target=hcloud_server.web", "-target=module.app", "-replace=hcloud_server.db"}, ec.targetArgs())
+}
+
+func TestTargetHosts(t *testing.T) {
+	runner := newScriptedRunner().withOutput("show -json", testTerraformState)
+	ec := &ExecutionConfig{
+		Config:         &config.Configuration{},
+		ConfigFilePath: filepath.Join(t.TempDir(), "liftoff.yaml"),
+		TerraformPath:  "/usr/bin/terraform",
+		Runner:         runner,
+		Targets:        []string{"hcloud_server.web", "module.app"},
+	}
+	hosts, err := ec.targetHosts()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web-1", "10.0.0.5", "app"}, hosts)
+}
+
+func TestResolveHostLimit_NoMatchingHosts(t *testing.T) {
+	runner := newScriptedRunner().withOutput("show -json", testTerraformState)
+	ec := &ExecutionConfig{
+		Config:         &config.Configuration{},
+		ConfigFilePath: filepath.Join(t.TempDir(), "liftoff.yaml"),
+		TerraformPath:  "/usr/bin/terraform",
+		Runner:         runner,
+		Targets:        []string{"hcloud_firewall.main"},
+	}
+	found, err := ec.resolveHostLimit()
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, ec.hostLimit)
+}
@@ -4,30 +4,238 @@
 package exec
 
 import (
-	osExec "os/exec"
+	"errors"
+	"os"
 	"path"
 
 	"github.com/bitshifted/liftoff/common"
-	"github.com/bitshifted/liftoff/log"
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/template"
 )
 
 func (ec *ExecutionConfig) ExecuteTeardown() error {
+	ec.Report = &Report{}
+	return ec.runFailureHooks(ec.executeTeardown())
+}
+
+func (ec *ExecutionConfig) executeTeardown() error {
 	output, err := ec.calculateOutputDirectory()
 	if err != nil {
 		return err
 	}
+	ec.OutputDir = output
 	ec.TerraformWorkDir = path.Join(output, common.DefaultTerraformDir)
-	if ec.TerraformPath == "" {
-		tfCmdPath, e := osExec.LookPath(defaltTerraformCmd)
-		if e != nil {
-			log.Logger.Error().Err(e).Msg("Failed to lookup Terraform path")
-			return e
+	ec.AnsibleWorkDir = path.Join(output, common.DefaultAnsibleDir)
+	err = ec.resolveTerraformPath()
+	if err != nil {
+		return err
+	}
+	var processor *template.TemplateProcessor
+	if ec.hasTemplate() {
+		processor, err = ec.prepareTemplates()
+		if err != nil {
+			return err
+		}
+	}
+	err = ec.runPhase(PhasePreflight, ec.checkCredentials)
+	if err != nil {
+		return err
+	}
+	if processor != nil && (ec.RenderBeforeDestroy || !dirExists(ec.TerraformWorkDir)) {
+		err = ec.runPhase(PhaseRender, func() error {
+			return ec.renderTerraformTemplates(processor)
+		})
+		if err != nil {
+			return err
+		}
+		ec.terraformInitRequired = true
+	}
+	err = ec.prepareTerraformDataDir()
+	if err != nil {
+		return err
+	}
+	if len(ec.Targets) > 0 {
+		err = ec.runPhase(PhasePlan, ec.confirmTargetedDestroy)
+		if err != nil {
+			return err
+		}
+	}
+	if processor != nil && ec.preDestroyPlaybook() != "" && !ec.SkipPreDestroy {
+		err = ec.runPhase(PhasePreDestroy, func() error {
+			return ec.executePreDestroy(processor)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = ec.runPreDestroyHooks()
+	if err != nil {
+		return err
+	}
+	err = ec.runPhase(PhaseDestroy, func() error {
+		if err := ec.ensureTerraformInit(); err != nil {
+			return err
+		}
+		err := ec.retry(config.RetryDestroy, func(int) error {
+			return ec.executeTerraformJSON(append([]string{"apply", "-destroy", "-auto-approve"}, ec.targetArgs()...)...)
+		})
+		if err != nil {
+			ec.logger().Error().Err(err).Msg("Failed to run Terraform destroy")
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// infrastructure is changed, so setup can not be resumed
+	if err = ec.removeCheckpoint(); err != nil {
+		ec.logger().Warn().Err(err).Msg("Failed to remove setup checkpoint")
+	}
+	err = ec.runHooks(config.HookPostDestroy)
+	if err != nil {
+		return err
+	}
+	if len(ec.Targets) == 0 {
+		// hosts are gone, so link is removed even if artifacts are kept
+		if err = ec.unlinkSSHInclude(); err != nil {
+			ec.logger().Warn().Err(err).Msg("Failed to remove SSH config link")
+		}
+	}
+	if ec.KeepArtifacts || len(ec.Targets) > 0 {
+		ec.logger().Info().Msg("Keeping local artifacts")
+		return nil
+	}
+	return ec.runPhase(PhaseCleanup, ec.cleanupArtifacts)
+}
+
+// runs pre-destroy hooks, collecting Terraform outputs for them if pre-destroy playbook did not
+func (ec *ExecutionConfig) runPreDestroyHooks() error {
+	if len(ec.hooks(config.HookPreDestroy)) == 0 {
+		return nil
+	}
+	if ec.Config.Outputs == nil {
+		err := ec.ensureTerraformInit()
+		if err == nil {
+			err = ec.collectTerraformOutputs()
+		}
+		if err != nil {
+			ec.logger().Warn().Err(err).Msg("Terraform outputs are not available to pre-destroy hooks")
+		}
+	}
+	return ec.runHooks(config.HookPreDestroy)
+}
+
+func (ec *ExecutionConfig) hasTemplate() bool {
+	return ec.Config.TemplateRepo != "" || ec.Config.TemplateDir != ""
+}
+
+func (ec *ExecutionConfig) preDestroyPlaybook() string {
+	if ec.Config.TemplateConfig == nil {
+		return ""
+	}
+	return ec.Config.TemplateConfig.PreDestroyPlaybook
+}
+
+// runs Terraform init if working directory was not initialized yet
+func (ec *ExecutionConfig) ensureTerraformInit() error {
+	if !ec.terraformInitRequired {
+		return nil
+	}
+	ec.logger().Info().Msg("Running Terraform init...")
+	err := ec.executeTerraformQuiet("init")
+	if err != nil {
+		ec.logger().Error().Err(err).Msg("Failed to run Terraform init")
+		return err
+	}
+	ec.terraformInitRequired = false
+	return nil
+}
+
+// runs template playbook for decommissioning hosts before they are destroyed
+func (ec *ExecutionConfig) executePreDestroy(processor *template.TemplateProcessor) error {
+	if ec.Config.Ansible == nil || ec.Config.Ansible.InventoryFile == "" {
+		ec.logger().Warn().Msg("Ansible inventory file is not specified. Skipping pre-destroy playbook")
+		return nil
+	}
+	err := ec.ensureTerraformInit()
+	if err != nil {
+		return err
+	}
+	err = ec.collectTerraformOutputs()
+	if err != nil {
+		return err
+	}
+	err = ec.generateSSHConfig()
+	if err != nil {
+		return err
+	}
+	err = ec.renderAnsibleTemplates(processor)
+	if err != nil {
+		return err
+	}
+	found, err := ec.resolveHostLimit()
+	if err != nil {
+		return err
+	}
+	if !found {
+		ec.logger().Warn().Msg("Targeted resources have no hosts. Skipping pre-destroy playbook")
+		return nil
+	}
+	ec.logger().Info().Msgf("Running pre-destroy playbook %s", ec.preDestroyPlaybook())
+	return ec.runPlaybook(ec.preDestroyPlaybook(), "", nil)
+}
+
+// removes generated files, Terraform data directory, template repository clone and SSH config.
+// Run logs are kept, since current run is still writing to them
+func (ec *ExecutionConfig) cleanupArtifacts() error {
+	var errs []error
+	entries, err := os.ReadDir(ec.OutputDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		errs = append(errs, err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == RunLogsDirName {
+			continue
 		}
-		ec.TerraformPath = tfCmdPath
+		errs = append(errs, ec.removeArtifact(path.Join(ec.OutputDir, entry.Name())))
 	}
-	err = ec.executeTerraformCommand("apply", "-destroy", "-auto-approve")
+	if tfDataDir := ec.calculateTerraformDataDir(); tfDataDir != "" {
+		errs = append(errs, ec.removeArtifact(tfDataDir))
+	}
+	ec.warnLegacyDataDir()
+	if ec.templateCloneDir != "" {
+		errs = append(errs, ec.removeArtifact(ec.templateCloneDir))
+	}
+	// SSH config is in Terraform data directory, unless home directory is not available
+	errs = append(errs, ec.removeArtifact(ec.sshDirPath()))
+	errs = append(errs, ec.removeArtifact(ec.legacySSHConfigFilePath()))
+	return errors.Join(errs...)
+}
+
+// reports data directory of previous versions without removing it, since other configurations may use it too.
+// Its content was copied to new data directory when this configuration was first run by current version
+func (ec *ExecutionConfig) warnLegacyDataDir() {
+	legacyDir := ec.legacyTerraformDataDir()
+	if legacyDir == "" || !dirExists(legacyDir) {
+		return
+	}
+	ec.logger().Warn().Msgf("Data directory %s created by previous version may be shared with other configurations "+
+		"and is not removed. Remove it manually if no other configuration uses it", legacyDir)
+}
+
+func (ec *ExecutionConfig) removeArtifact(artifactPath string) error {
+	if _, err := os.Stat(artifactPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	ec.logger().Info().Msgf("Removing %s", artifactPath)
+	err := os.RemoveAll(artifactPath)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to run Terraform destroy")
+		ec.logger().Error().Err(err).Msgf("Failed to remove %s", artifactPath)
 	}
 	return err
 }
+
+func dirExists(dirPath string) bool {
+	info, err := os.Stat(dirPath)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/log"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExecutionTeardownTestSuite struct {
+	suite.Suite
+}
+
+func (ts *ExecutionTeardownTestSuite) SetupSuite() {
+	// Initialize logger
+	log.Init(true)
+	log.Logger.Info().Msg("Running ExecutionTeardownTestSuite")
+}
+
+func TestExecutionTeardownTestSuite(t *testing.T) {
+	suite.Run(t, new(ExecutionTeardownTestSuite))
+}
+
+// creates Terraform data directory, as left by previous setup
+func (ts *ExecutionTeardownTestSuite) createDataDir(ec *ExecutionConfig) {
+	ts.T().Setenv("HOME", ts.T().TempDir())
+	ts.NoError(os.MkdirAll(ec.calculateTerraformDataDir(), 0o700))
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_RunsDestroy() {
+	runner := &recordingRunner{}
+	ec := &ExecutionConfig{
+		Config:         &config.Configuration{},
+		ConfigFilePath: filepath.Join(ts.T().TempDir(), "liftoff.yaml"),
+		Runner:         runner,
+	}
+	ts.createDataDir(ec)
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.Equal([]string{"/usr/bin/terraform apply -destroy -auto-approve -json"}, runner.commandLines())
+	ts.Equal(filepath.Join(filepath.Dir(ec.ConfigFilePath), "liftoff", "terraform"), runner.commands[0].Dir)
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_ReturnsDestroyError() {
+	runner := newScriptedRunner().withFailure("apply -destroy", errScripted)
+	ec := &ExecutionConfig{
+		Config:         &config.Configuration{},
+		ConfigFilePath: filepath.Join(ts.T().TempDir(), "liftoff.yaml"),
+		TerraformPath:  "/opt/terraform",
+		Runner:         runner,
+	}
+	ts.createDataDir(ec)
+	err := ec.ExecuteTeardown()
+	ts.ErrorIs(err, errScripted)
+	ts.Equal([]string{"/opt/terraform apply -destroy -auto-approve -json"}, runner.commandLines())
+}
+
+func (ts *ExecutionTeardownTestSuite) newTeardownExecutionConfig(runner Runner, preDestroyPlaybook string) *ExecutionConfig {
+	tmplDir := filepath.Join(ts.T().TempDir(), "template")
+	ts.NoError(os.CopyFS(tmplDir, os.DirFS("test_files/template")))
+	if preDestroyPlaybook != "" {
+		tmplCfg := "---\nansible-roles-dir: ansible/roles\npre-destroy-playbook: " + preDestroyPlaybook + "\n"
+		ts.NoError(os.WriteFile(filepath.Join(tmplDir, "template-cfg.yaml"), []byte(tmplCfg), 0o600))
+		ts.NoError(os.WriteFile(filepath.Join(tmplDir, "ansible", preDestroyPlaybook), []byte("---\n"), 0o600))
+	}
+	return &ExecutionConfig{
+		Config: &config.Configuration{
+			TemplateDir: tmplDir,
+			Ansible: &config.AnsibleConfig{
+				InventoryFile: "inventory",
+				PlaybookFile:  "playbook.yaml",
+			},
+			ProcessingVars: map[string]interface{}{
+				"server_name": "web",
+			},
+		},
+		ConfigFilePath: filepath.Join(ts.T().TempDir(), "liftoff.yaml"),
+		Runner:         runner,
+	}
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_RendersMissingOutputAndCleansArtifacts() {
+	runner := &recordingRunner{}
+	ec := ts.newTeardownExecutionConfig(runner, "")
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -destroy -auto-approve -json",
+	}, runner.commandLines())
+	ts.NoDirExists(ec.TerraformWorkDir)
+	ts.NoDirExists(ec.AnsibleWorkDir)
+	ts.NoFileExists(ec.sshConfigFilePath())
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_RemovesSSHConfigLink() {
+	ts.T().Setenv("HOME", ts.T().TempDir())
+	ec := ts.newTeardownExecutionConfig(&recordingRunner{}, "")
+	ec.LinkSSHConfig = true
+	ts.NoError(ec.generateSSHConfig())
+	ts.FileExists(ec.sshLinkPath())
+	ec.KeepArtifacts = true
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	// link is removed even if artifacts are kept
+	ts.NoFileExists(ec.sshLinkPath())
+	ts.FileExists(ec.sshConfigFilePath())
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_KeepArtifacts() {
+	runner := &recordingRunner{}
+	ec := ts.newTeardownExecutionConfig(runner, "")
+	ec.KeepArtifacts = true
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.FileExists(filepath.Join(ec.TerraformWorkDir, "main.tf"))
+	for _, phase := range ec.Report.Phases {
+		ts.NotEqual(PhaseCleanup, phase.Phase)
+	}
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_RunsPreDestroyPlaybook() {
+	runner := newScriptedRunner().withTerraformOutputs(`{"server_ip": {"sensitive": false, "type": "string", "value": "10.0.0.5"}}`)
+	ec := ts.newTeardownExecutionConfig(runner, "decommission.yaml")
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform output -json",
+		"/usr/bin/ansible-playbook -i inventory decommission.yaml",
+		"/usr/bin/terraform apply -destroy -auto-approve -json",
+	}, runner.commandLines())
+	ts.Equal(ec.AnsibleWorkDir, runner.commands[2].Dir)
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_SkipPreDestroy() {
+	runner := &recordingRunner{}
+	ec := ts.newTeardownExecutionConfig(runner, "decommission.yaml")
+	ec.SkipPreDestroy = true
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -destroy -auto-approve -json",
+	}, runner.commandLines())
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_TargetsRequireConfirmation() {
+	runner := &recordingRunner{}
+	ec := ts.newTeardownExecutionConfig(runner, "")
+	ec.Targets = []string{"hcloud_server.web"}
+	err := ec.ExecuteTeardown()
+	ts.ErrorIs(err, ErrNotConfirmed)
+
+	runner = &recordingRunner{}
+	ec = ts.newTeardownExecutionConfig(runner, "")
+	ec.Targets = []string{"hcloud_server.web"}
+	ec.Confirm = func(_ string) (bool, error) { return false, nil }
+	err = ec.ExecuteTeardown()
+	ts.ErrorIs(err, ErrNotConfirmed)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform plan -destroy -input=false -target=hcloud_server.web",
+	}, runner.commandLines())
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_DestroysConfirmedTargets() {
+	runner := &recordingRunner{}
+	ec := ts.newTeardownExecutionConfig(runner, "")
+	ec.Targets = []string{"hcloud_server.web"}
+	message := ""
+	ec.Confirm = func(msg string) (bool, error) {
+		message = msg
+		return true, nil
+	}
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.Contains(message, "hcloud_server.web")
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform plan -destroy -input=false -target=hcloud_server.web",
+		"/usr/bin/terraform apply -destroy -auto-approve -target=hcloud_server.web -json",
+	}, runner.commandLines())
+	// artifacts are needed for remaining resources
+	ts.FileExists(filepath.Join(ec.TerraformWorkDir, "main.tf"))
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_KeepsLegacyDataDir() {
+	ts.T().Setenv("HOME", ts.T().TempDir())
+	ec := ts.newTeardownExecutionConfig(&recordingRunner{}, "")
+	legacyDir := ec.legacyTerraformDataDir()
+	ts.NoError(os.MkdirAll(legacyDir, 0o700))
+	ts.NoError(os.MkdirAll(ec.calculateTerraformDataDir(), 0o700))
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.NoDirExists(ec.calculateTerraformDataDir())
+	// legacy directory may belong to another configuration
+	ts.DirExists(legacyDir)
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_InitializesMissingDataDir() {
+	ts.T().Setenv("HOME", ts.T().TempDir())
+	runner := &recordingRunner{}
+	ec := &ExecutionConfig{
+		Config:         &config.Configuration{},
+		ConfigFilePath: filepath.Join(ts.T().TempDir(), "liftoff.yaml"),
+		Runner:         runner,
+	}
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.Equal([]string{
+		"/usr/bin/terraform init",
+		"/usr/bin/terraform apply -destroy -auto-approve -json",
+	}, runner.commandLines())
+}
+
+func (ts *ExecutionTeardownTestSuite) TestExecuteTeardown_CopiesLegacyDataDir() {
+	ts.T().Setenv("HOME", ts.T().TempDir())
+	runner := &recordingRunner{}
+	ec := &ExecutionConfig{
+		Config:         &config.Configuration{},
+		ConfigFilePath: filepath.Join(ts.T().TempDir(), "liftoff.yaml"),
+		Runner:         runner,
+		KeepArtifacts:  true,
+	}
+	// deployment created by previous version, with selected workspace and provider link
+	legacyDir := ec.legacyTerraformDataDir()
+	ts.NoError(os.MkdirAll(filepath.Join(legacyDir, "providers"), 0o700))
+	ts.NoError(os.WriteFile(filepath.Join(legacyDir, "environment"), []byte("staging"), 0o600))
+	ts.NoError(os.Symlink("/opt/plugins/hcloud", filepath.Join(legacyDir, "providers", "hcloud")))
+
+	err := ec.ExecuteTeardown()
+	ts.NoError(err)
+	ts.Equal([]string{"/usr/bin/terraform apply -destroy -auto-approve -json"}, runner.commandLines())
+	dataDir := ec.calculateTerraformDataDir()
+	ts.Contains(runner.commands[0].Env, "TF_DATA_DIR="+dataDir)
+	workspace, err := os.ReadFile(filepath.Join(dataDir, "environment"))
+	ts.NoError(err)
+	ts.Equal("staging", string(workspace))
+	target, err := os.Readlink(filepath.Join(dataDir, "providers", "hcloud"))
+	ts.NoError(err)
+	ts.Equal("/opt/plugins/hcloud", target)
+	ts.DirExists(legacyDir)
+}
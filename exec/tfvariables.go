@@ -0,0 +1,108 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/bitshifted/liftoff/config"
+)
+
+const (
+	// file with values of variables, loaded automatically by Terraform
+	tfvarsFileName = "liftoff.auto.tfvars.json"
+	// file with declarations of variables which templates do not declare
+	variablesFileName = "liftoff_variables.tf"
+	variablesHeader   = "# Generated by liftoff from configuration variables. Do not edit.\n"
+)
+
+var variableDeclarationPattern = regexp.MustCompile(`(?m)^\s*variable\s+"([^"]+)"`)
+
+// writes variables to tfvars file in Terraform working directory and declares variables which templates do
+// not declare themselves. Generated files are removed if template does not use Terraform variables
+func (ec *ExecutionConfig) writeTerraformVariables() error {
+	tfvarsPath := path.Join(ec.TerraformWorkDir, tfvarsFileName)
+	variablesPath := path.Join(ec.TerraformWorkDir, variablesFileName)
+	if ec.Config.TemplateConfig == nil || !ec.Config.TemplateConfig.TerraformVariables {
+		if err := ec.removeArtifact(tfvarsPath); err != nil {
+			return err
+		}
+		return ec.removeArtifact(variablesPath)
+	}
+	declared, err := declaredVariables(ec.TerraformWorkDir)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	undeclared := map[string]interface{}{}
+	for name, value := range ec.Config.ProcessingVars {
+		if !config.ValidTerraformVariableName(name) {
+			ec.logger().Debug().Msgf("Variable %s is not valid Terraform variable name, skipping", name)
+			continue
+		}
+		values[name] = value
+		if !declared[name] {
+			undeclared[name] = value
+		}
+	}
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	// values of secrets are written, so file is readable only by owner
+	if err = ec.writeGeneratedFile(tfvarsPath, append(data, '\n'), true); err != nil {
+		return err
+	}
+	if len(undeclared) == 0 {
+		return ec.removeArtifact(variablesPath)
+	}
+	content := variablesHeader + config.TerraformVariablesBlock(undeclared, ec.Config.SensitiveVariables())
+	return ec.writeGeneratedFile(variablesPath, []byte(content), false)
+}
+
+// writes generated file if its content changed, recording it as changed
+func (ec *ExecutionConfig) writeGeneratedFile(filePath string, content []byte, private bool) error {
+	existing, err := os.ReadFile(filePath)
+	if err == nil && bytes.Equal(existing, content) {
+		return nil
+	}
+	if private {
+		err = writePrivateFile(filePath, content)
+	} else {
+		err = os.WriteFile(filePath, content, 0o644)
+	}
+	if err != nil {
+		ec.logger().Error().Err(err).Msgf("Failed to write %s", filePath)
+		return err
+	}
+	ec.report().ChangedFiles = append(ec.report().ChangedFiles, filePath)
+	return nil
+}
+
+// returns names of variables declared in Terraform files in directory, other than generated declarations
+func declaredVariables(dir string) (map[string]bool, error) {
+	files, err := filepath.Glob(path.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	declared := map[string]bool{}
+	for _, file := range files {
+		if filepath.Base(file) == variablesFileName {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range variableDeclarationPattern.FindAllSubmatch(data, -1) {
+			declared[string(match[1])] = true
+		}
+	}
+	return declared, nil
+}
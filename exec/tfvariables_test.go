@@ -0,0 +1,71 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package exec
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTerraformVariablesExecutionConfig(t *testing.T, enabled bool) *ExecutionConfig {
+	return &ExecutionConfig{
+		Config: &config.Configuration{
+			TemplateConfig: &config.TemplateConfig{TerraformVariables: enabled},
+			ProcessingVars: map[string]interface{}{
+				"server_name":  "web",
+				"server_count": 2,
+				"labels":       map[string]interface{}{"env": "dev"},
+				"invalid.name": "skipped",
+			},
+		},
+		TerraformWorkDir: t.TempDir(),
+		Report:           &Report{},
+	}
+}
+
+func TestWriteTerraformVariables_WritesValuesAndDeclarations(t *testing.T) {
+	ec := newTerraformVariablesExecutionConfig(t, true)
+	assert.NoError(t, os.WriteFile(filepath.Join(ec.TerraformWorkDir, "variables.tf"),
+		[]byte("variable \"server_name\" {\n  type = string\n}\n"), 0o644))
+
+	err := ec.writeTerraformVariables()
+	assert.NoError(t, err)
+
+	tfvarsPath := filepath.Join(ec.TerraformWorkDir, tfvarsFileName)
+	info, err := os.Stat(tfvarsPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(tfvarsPath)
+	assert.NoError(t, err)
+	var values map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &values))
+	assert.Equal(t, "web", values["server_name"])
+	assert.Equal(t, float64(2), values["server_count"])
+	assert.NotContains(t, values, "invalid.name")
+
+	declarations, err := os.ReadFile(filepath.Join(ec.TerraformWorkDir, variablesFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(declarations), "variable \"server_count\" {\n  type = number\n}")
+	assert.Contains(t, string(declarations), "variable \"labels\" {\n  type = object({env = string})\n}")
+	assert.NotContains(t, string(declarations), "server_name")
+	assert.Contains(t, ec.Report.ChangedFiles, tfvarsPath)
+}
+
+func TestWriteTerraformVariables_RemovesGeneratedFilesWhenDisabled(t *testing.T) {
+	ec := newTerraformVariablesExecutionConfig(t, false)
+	tfvarsPath := filepath.Join(ec.TerraformWorkDir, tfvarsFileName)
+	variablesPath := filepath.Join(ec.TerraformWorkDir, variablesFileName)
+	assert.NoError(t, os.WriteFile(tfvarsPath, []byte("{}"), 0o600))
+	assert.NoError(t, os.WriteFile(variablesPath, []byte("stale"), 0o644))
+
+	err := ec.writeTerraformVariables()
+	assert.NoError(t, err)
+	assert.NoFileExists(t, tfvarsPath)
+	assert.NoFileExists(t, variablesPath)
+}
@@ -4,34 +4,49 @@
 package gitops
 
 import (
-	"os"
+	"context"
+	"io"
 
 	"github.com/bitshifted/liftoff/log"
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/rs/zerolog"
 )
 
 type GitHandler struct {
 	URL         string
 	Version     string
 	Destination string
+	// Writer for clone progress messages. Progress is not reported if nil
+	Progress io.Writer
+	// Logger for log messages. Logging is disabled if not set
+	Logger *zerolog.Logger
+	// Hash of commit checked out by Fetch
+	Commit string
+}
+
+func (gh *GitHandler) logger() *zerolog.Logger {
+	return log.OrNop(gh.Logger)
 }
 
 func (gh *GitHandler) Fetch() error {
-	log.Logger.Info().Msgf("Cloning Git repository %s", gh.URL)
+	gh.logger().Info().Msgf("Cloning Git repository %s", gh.URL)
 	repo, err := git.PlainClone(gh.Destination, false, &git.CloneOptions{
 		URL:      gh.URL,
-		Progress: os.Stdout,
+		Progress: gh.Progress,
 	})
 	if err != nil {
-		log.Logger.Error().Err(err).Msgf("Failed to clone git repository %s", gh.URL)
+		gh.logger().Error().Err(err).Msgf("Failed to clone git repository %s", gh.URL)
 		return nil
 	}
 	if gh.Version == "" {
-		log.Logger.Info().Msg("Version is not specified, defaulting to main branch")
+		gh.logger().Info().Msg("Version is not specified, defaulting to main branch")
+		gh.recordHead(repo)
 		return nil
 	}
-	log.Logger.Debug().Msgf("Looking up tag %s", gh.Version)
+	gh.logger().Debug().Msgf("Looking up tag %s", gh.Version)
 	commitHash, err := gh.getCommitHashForTagName(repo)
 	if err != nil {
 		return err
@@ -41,34 +56,45 @@ func (gh *GitHandler) Fetch() error {
 	}
 	wt, err := repo.Worktree()
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to get repository work tree")
+		gh.logger().Error().Err(err).Msg("Failed to get repository work tree")
 		return err
 	}
 	err = wt.Checkout(&git.CheckoutOptions{
 		Hash: plumbing.NewHash(commitHash),
 	})
 	if err != nil {
-		log.Logger.Error().Err(err).Msgf("Failed to checkout commit hash %s", commitHash)
+		gh.logger().Error().Err(err).Msgf("Failed to checkout commit hash %s", commitHash)
 	} else {
-		log.Logger.Info().Msgf("Checked out repository version %s", commitHash)
+		gh.logger().Info().Msgf("Checked out repository version %s", commitHash)
+		gh.recordHead(repo)
 	}
 	return err
 }
 
+// records hash of checked out commit
+func (gh *GitHandler) recordHead(repo *git.Repository) {
+	head, err := repo.Head()
+	if err != nil {
+		gh.logger().Warn().Err(err).Msg("Failed to get repository head")
+		return
+	}
+	gh.Commit = head.Hash().String()
+}
+
 func (gh *GitHandler) getCommitHashForTagName(repo *git.Repository) (string, error) {
 	iter, err := repo.Tags()
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to get tags")
+		gh.logger().Error().Err(err).Msg("Failed to get tags")
 		return "", err
 	}
 	commitHash := ""
 	ierr := iter.ForEach(func(ref *plumbing.Reference) error {
 		to, err := repo.TagObject(ref.Hash())
 		if err != nil {
-			log.Logger.Error().Err(err).Msgf("Failed to get tag object for hash %s", ref.Hash().String())
+			gh.logger().Error().Err(err).Msgf("Failed to get tag object for hash %s", ref.Hash().String())
 		}
 		if gh.Version == to.Name {
-			log.Logger.Debug().Msgf("Found tag with name %s. Commit hash: %s", gh.Version, to.Hash.String())
+			gh.logger().Debug().Msgf("Found tag with name %s. Commit hash: %s", gh.Version, to.Hash.String())
 			commitHash = to.Hash.String()
 		}
 		return nil
@@ -79,3 +105,13 @@ func (gh *GitHandler) getCommitHashForTagName(repo *git.Repository) (string, err
 
 	return commitHash, nil
 }
+
+// CheckReachable verifies that repository can be reached, by listing its references without cloning it
+func (gh *GitHandler) CheckReachable(ctx context.Context) error {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{gh.URL},
+	})
+	_, err := remote.ListContext(ctx, &git.ListOptions{})
+	return err
+}
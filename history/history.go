@@ -0,0 +1,237 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+// Package history records runs of liftoff for each configuration, so that provisioned stacks can be
+// found and managed later.
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitshifted/liftoff/common"
+)
+
+const (
+	// DirName is name of history directory in liftoff home directory
+	DirName       = "history"
+	stackFileExt  = ".json"
+	stackFileMode = 0o600
+	// number of runs kept for each stack
+	maxRuns = 50
+)
+
+// Run statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Run is a single execution of liftoff command for a stack
+type Run struct {
+	ID       string    `json:"id"`
+	Command  string    `json:"command"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Stack is infrastructure managed by single configuration file
+type Stack struct {
+	ID string `json:"id"`
+	// Absolute path of configuration file
+	ConfigFile string `json:"config_file"`
+	// True if infrastructure was provisioned and not destroyed afterwards
+	Active bool `json:"active"`
+	// Time to live configured at last setup
+	TTL string `json:"ttl,omitempty"`
+	// Variables files and assignments used at last setup, so that stack can be torn down with the same configuration
+	VarFiles []string `json:"var_files,omitempty"`
+	Vars     []string `json:"vars,omitempty"`
+	// Names of stacks in configuration at last setup
+	Stacks []string `json:"stacks,omitempty"`
+	// Time after which stack should be destroyed. Not set if stack does not expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Recent runs, oldest first
+	Runs []Run `json:"runs"`
+	// Terraform outputs recorded at last successful setup. For configurations with multiple stacks,
+	// outputs are recorded for each stack
+	Outputs      map[string]Output            `json:"outputs,omitempty"`
+	StackOutputs map[string]map[string]Output `json:"stack_outputs,omitempty"`
+	// Time when outputs were recorded
+	OutputsRecorded *time.Time `json:"outputs_recorded,omitempty"`
+}
+
+// Output is recorded value of Terraform output. Values of sensitive outputs are not recorded
+type Output struct {
+	Value     interface{} `json:"value,omitempty"`
+	Sensitive bool        `json:"sensitive,omitempty"`
+}
+
+// NewOutputs returns outputs for recording, omitting values of sensitive outputs
+func NewOutputs(values map[string]interface{}, sensitive []string) map[string]Output {
+	outputs := make(map[string]Output, len(values))
+	for name, value := range values {
+		outputs[name] = Output{Value: value}
+	}
+	for _, name := range sensitive {
+		outputs[name] = Output{Sensitive: true}
+	}
+	return outputs
+}
+
+// SetOutputs records outputs of configuration or its stacks, replacing previously recorded ones
+func (s *Stack) SetOutputs(outputs map[string]Output, stackOutputs map[string]map[string]Output, recorded time.Time) {
+	s.Outputs = outputs
+	s.StackOutputs = stackOutputs
+	s.OutputsRecorded = &recorded
+}
+
+// ClearOutputs removes recorded outputs
+func (s *Stack) ClearOutputs() {
+	s.Outputs = nil
+	s.StackOutputs = nil
+	s.OutputsRecorded = nil
+}
+
+// Expired returns true if stack is active and its TTL has passed
+func (s *Stack) Expired(now time.Time) bool {
+	return s.Active && s.ExpiresAt != nil && now.After(*s.ExpiresAt)
+}
+
+// LastRun returns the most recent run, or nil if there are no runs
+func (s *Stack) LastRun() *Run {
+	if len(s.Runs) == 0 {
+		return nil
+	}
+	return &s.Runs[len(s.Runs)-1]
+}
+
+// AddRun appends run to the stack, dropping the oldest runs if limit is exceeded
+func (s *Stack) AddRun(run Run) {
+	s.Runs = append(s.Runs, run)
+	if len(s.Runs) > maxRuns {
+		s.Runs = s.Runs[len(s.Runs)-maxRuns:]
+	}
+}
+
+// Store keeps stack history as JSON files in a directory
+type Store struct {
+	Dir string
+}
+
+// DefaultStore returns store located in liftoff home directory
+func DefaultStore() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Dir: filepath.Join(homeDir, common.LiftoffHomeDirName, DirName)}, nil
+}
+
+// StackID returns identifier of the stack managed by configuration file. It is derived from file name
+// and absolute path, so configurations with the same name in different directories do not collide
+func StackID(configFile string) string {
+	name := strings.TrimSuffix(filepath.Base(configFile), filepath.Ext(configFile))
+	hash := sha256.Sum256([]byte(configFile))
+	return name + "-" + hex.EncodeToString(hash[:])[0:8]
+}
+
+// Load returns stack for configuration file. Empty stack is returned if there is no history for it
+func (s *Store) Load(configFile string) (*Stack, error) {
+	id := StackID(configFile)
+	stack, err := s.read(filepath.Join(s.Dir, id+stackFileExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Stack{ID: id, ConfigFile: configFile}, nil
+	}
+	return stack, err
+}
+
+// Save writes stack to the store
+func (s *Store) Save(stack *Stack) error {
+	err := os.MkdirAll(s.Dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stack, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to temporary file first, so concurrent readers never see partial content
+	target := filepath.Join(s.Dir, stack.ID+stackFileExt)
+	tmp, err := os.CreateTemp(s.Dir, stack.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), stackFileMode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Update loads stack for configuration file, applies changes to it and saves it
+func (s *Store) Update(configFile string, update func(stack *Stack)) error {
+	stack, err := s.Load(configFile)
+	if err != nil {
+		return err
+	}
+	update(stack)
+	return s.Save(stack)
+}
+
+// List returns all stacks in the store, sorted by ID
+func (s *Store) List() ([]*Stack, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stacks []*Stack
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != stackFileExt {
+			continue
+		}
+		stack, err := s.read(filepath.Join(s.Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		stacks = append(stacks, stack)
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		return stacks[i].ID < stacks[j].ID
+	})
+	return stacks, nil
+}
+
+func (s *Store) read(path string) (*Stack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stack Stack
+	err = json.Unmarshal(data, &stack)
+	if err != nil {
+		return nil, err
+	}
+	return &stack, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackID(t *testing.T) {
+	id := StackID("/projects/app/liftoff.yaml")
+	assert.Regexp(t, `^liftoff-[0-9a-f]{8}$`, id)
+	assert.Equal(t, id, StackID("/projects/app/liftoff.yaml"))
+	assert.NotEqual(t, id, StackID("/projects/other/liftoff.yaml"))
+}
+
+func TestLoadReturnsEmptyStack(t *testing.T) {
+	store := &Store{Dir: filepath.Join(t.TempDir(), DirName)}
+	stack, err := store.Load("/projects/app/liftoff.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, StackID("/projects/app/liftoff.yaml"), stack.ID)
+	assert.Equal(t, "/projects/app/liftoff.yaml", stack.ConfigFile)
+	assert.False(t, stack.Active)
+	assert.Nil(t, stack.LastRun())
+}
+
+func TestUpdateAndList(t *testing.T) {
+	store := &Store{Dir: filepath.Join(t.TempDir(), DirName)}
+	expiresAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := store.Update("/projects/b/liftoff.yaml", func(stack *Stack) {
+		stack.Active = true
+		stack.ExpiresAt = &expiresAt
+		stack.AddRun(Run{ID: "run-1", Command: "setup", Status: StatusSucceeded})
+	})
+	assert.NoError(t, err)
+	err = store.Update("/projects/a/liftoff.yaml", func(stack *Stack) {
+		stack.AddRun(Run{ID: "run-2", Command: "setup", Status: StatusFailed})
+	})
+	assert.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(store.Dir, StackID("/projects/b/liftoff.yaml")+stackFileExt))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(stackFileMode), info.Mode().Perm())
+
+	stacks, err := store.List()
+	assert.NoError(t, err)
+	assert.Len(t, stacks, 2)
+	for _, stack := range stacks {
+		if stack.ConfigFile == "/projects/b/liftoff.yaml" {
+			assert.True(t, stack.Active)
+			assert.True(t, expiresAt.Equal(*stack.ExpiresAt))
+			assert.Equal(t, "run-1", stack.LastRun().ID)
+		} else {
+			assert.Equal(t, StatusFailed, stack.LastRun().Status)
+		}
+	}
+}
+
+func TestListMissingDirectory(t *testing.T) {
+	store := &Store{Dir: filepath.Join(t.TempDir(), "missing")}
+	stacks, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, stacks)
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+	assert.True(t, (&Stack{Active: true, ExpiresAt: &past}).Expired(now))
+	assert.False(t, (&Stack{Active: true, ExpiresAt: &future}).Expired(now))
+	assert.False(t, (&Stack{Active: false, ExpiresAt: &past}).Expired(now))
+	assert.False(t, (&Stack{Active: true}).Expired(now))
+}
+
+func TestAddRunKeepsLimit(t *testing.T) {
+	stack := &Stack{}
+	for i := 0; i < maxRuns+5; i++ {
+		stack.AddRun(Run{ID: strconv.Itoa(i)})
+	}
+	assert.Len(t, stack.Runs, maxRuns)
+	assert.Equal(t, "5", stack.Runs[0].ID)
+}
+
+func TestNewOutputsOmitsSensitiveValues(t *testing.T) {
+	outputs := NewOutputs(map[string]interface{}{"ip": "10.0.0.5", "password": "secret"}, []string{"password"})
+	assert.Equal(t, map[string]Output{
+		"ip":       {Value: "10.0.0.5"},
+		"password": {Sensitive: true},
+	}, outputs)
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bitshifted/liftoff/exec"
+)
+
+// SSHOptions select host to connect to
+type SSHOptions struct {
+	// Stack of configuration with multiple stacks
+	Stack string
+	// Alias of host from generated SSH config, or any address
+	Host string
+	// Command to run on the host. Interactive session is opened if not set
+	Command []string
+}
+
+// ExecOptions select hosts on which command is run
+type ExecOptions struct {
+	// Stack of configuration with multiple stacks
+	Stack string
+	// Comma separated host aliases or glob patterns
+	Pattern string
+	Command []string
+	// Maximum number of hosts on which command runs at the same time
+	Parallelism int
+}
+
+// HostResult is result of running command on single host
+type HostResult struct {
+	Host string
+	Err  error
+}
+
+// SSHHosts returns hosts described in generated SSH config. Hosts stored by the last setup are returned,
+// or they are collected from Terraform outputs
+func (p *Project) SSHHosts(ctx context.Context, stack string) ([]exec.SSHHost, error) {
+	ec, err := p.newConnectExecution(ctx, stack)
+	if err != nil {
+		return nil, err
+	}
+	err = ec.ExecuteSSHConfig()
+	if err != nil {
+		return nil, err
+	}
+	return ec.Report.SSHHosts, nil
+}
+
+// SSH connects to provisioned host using generated SSH config
+func (p *Project) SSH(ctx context.Context, opts SSHOptions) error {
+	ec, err := p.newConnectExecution(ctx, opts.Stack)
+	if err != nil {
+		return err
+	}
+	return ec.ExecuteSSH(opts.Host, opts.Command)
+}
+
+// Exec runs command on all hosts matching pattern, in parallel. Output of each host is prefixed with its alias
+func (p *Project) Exec(ctx context.Context, opts ExecOptions) ([]HostResult, error) {
+	ec, err := p.newConnectExecution(ctx, opts.Stack)
+	if err != nil {
+		return nil, err
+	}
+	results, err := ec.ExecuteRemoteCommand(opts.Pattern, opts.Command, opts.Parallelism)
+	hostResults := make([]HostResult, 0, len(results))
+	for _, result := range results {
+		hostResults = append(hostResults, HostResult(result))
+	}
+	return hostResults, err
+}
+
+// creates execution for connecting to hosts of configuration or one of its stacks
+func (p *Project) newConnectExecution(ctx context.Context, stack string) (*exec.ExecutionConfig, error) {
+	if !p.config.HasStacks() {
+		if stack != "" {
+			return nil, fmt.Errorf("configuration does not have stacks")
+		}
+		return p.newExecution(ctx), nil
+	}
+	if stack == "" {
+		return nil, fmt.Errorf("configuration has multiple stacks, stack must be selected")
+	}
+	runID := p.runID()
+	outputs, err := p.dependencyOutputs(ctx, stack, runID, newStackOutputs())
+	if err != nil {
+		return nil, err
+	}
+	return p.newStackExecution(ctx, stack, runID, outputs)
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecUsesHostsStoredBySetup(t *testing.T) {
+	runner := &fakeRunner{outputs: `{"ssh_hosts": {"value": [
+		{"alias": "web", "address": "10.0.0.5"},
+		{"alias": "db", "address": "10.0.0.6"}
+	]}}`}
+	project, err := Load(context.Background(), copyConfig(t), Options{Runner: runner})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+	hosts, err := project.SSHHosts(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, hosts, 2)
+
+	runner.commands = nil
+	results, err := project.Exec(context.Background(), ExecOptions{Pattern: "web", Command: []string{"uptime"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []HostResult{{Host: "web"}}, results)
+	// Terraform outputs are not collected again
+	assert.Len(t, runner.commands, 1)
+	assert.Regexp(t, `^ssh -F .*/ssh/config -o BatchMode=yes web uptime$`, runner.commands[0])
+}
+
+func TestConnectRequiresStackForStacksConfiguration(t *testing.T) {
+	project, err := Load(context.Background(), copyConfigFile(t, "stacks.yaml"), Options{Runner: &fakeRunner{}})
+	assert.NoError(t, err)
+	err = project.SSH(context.Background(), SSHOptions{Host: "web"})
+	assert.ErrorContains(t, err, "stack must be selected")
+
+	project, err = Load(context.Background(), copyConfig(t), Options{Runner: &fakeRunner{}})
+	assert.NoError(t, err)
+	err = project.SSH(context.Background(), SSHOptions{Stack: "app", Host: "web"})
+	assert.ErrorContains(t, err, "configuration does not have stacks")
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/bitshifted/liftoff/history"
+)
+
+// command names recorded in run history
+const (
+	commandSetup    = "setup"
+	commandTeardown = "teardown"
+)
+
+// ExpiredStacks returns stacks from history which are still provisioned, but their TTL has passed
+func ExpiredStacks(store *history.Store, now time.Time) ([]*history.Stack, error) {
+	stacks, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var expired []*history.Stack
+	for _, stack := range stacks {
+		if stack.Expired(now) {
+			expired = append(expired, stack)
+		}
+	}
+	return expired, nil
+}
+
+// records finished run in history, if history store is configured. Failure to record history is
+// logged, but does not fail the operation
+func (p *Project) recordRun(runID, command string, started time.Time, runErr error, update func(stack *history.Stack)) {
+	if p.options.History == nil {
+		return
+	}
+	run := history.Run{
+		ID:       runID,
+		Command:  command,
+		Started:  started,
+		Finished: time.Now(),
+		Status:   history.StatusSucceeded,
+	}
+	if runErr != nil {
+		run.Status = history.StatusFailed
+		run.Error = runErr.Error()
+	}
+	err := p.options.History.Update(p.configPath, func(stack *history.Stack) {
+		stack.AddRun(run)
+		update(stack)
+	})
+	if err != nil {
+		p.options.Logger.Warn().Err(err).Msg("Failed to record run history")
+	}
+}
+
+// marks stack as provisioned and calculates its expiry time from configured TTL, if Terraform apply was run.
+// Expiry time of already provisioned stack is kept, unless TTL was changed. Outputs are recorded after
+// successful setup, so they are available when Terraform is not
+func (p *Project) recordSetup(runID string, started time.Time, result *Result, runErr error) {
+	p.recordRun(runID, commandSetup, started, runErr, func(stack *history.Stack) {
+		if result == nil || !result.TerraformApplied {
+			return
+		}
+		if runErr == nil {
+			recordOutputs(stack, result, time.Now())
+		}
+		stack.VarFiles = absPaths(p.options.Overrides.VarFiles)
+		stack.Vars = p.options.Overrides.Vars
+		stack.Stacks = p.Stacks()
+		// infrastructure may be partially created even if setup failed
+		if stack.Active && stack.TTL == p.config.TTL {
+			return
+		}
+		stack.Active = true
+		stack.TTL = p.config.TTL
+		stack.ExpiresAt = nil
+		if p.config.TTLDuration > 0 {
+			expiresAt := started.Add(p.config.TTLDuration)
+			stack.ExpiresAt = &expiresAt
+		}
+	})
+}
+
+// marks stack as destroyed after successful complete teardown
+func (p *Project) recordTeardown(runID string, opts TeardownOptions, started time.Time, runErr error) {
+	p.recordRun(runID, commandTeardown, started, runErr, func(stack *history.Stack) {
+		if runErr != nil || len(opts.Targets) > 0 {
+			return
+		}
+		stack.Active = false
+		stack.ExpiresAt = nil
+		stack.ClearOutputs()
+	})
+}
+
+func recordOutputs(stack *history.Stack, result *Result, recorded time.Time) {
+	if len(result.Stacks) == 0 {
+		stack.SetOutputs(history.NewOutputs(result.Outputs, result.SensitiveOutputs), nil, recorded)
+		return
+	}
+	stackOutputs := make(map[string]map[string]history.Output, len(result.Stacks))
+	for _, stackResult := range result.Stacks {
+		if stackResult.Result != nil {
+			stackOutputs[stackResult.Name] = history.NewOutputs(stackResult.Result.Outputs, stackResult.Result.SensitiveOutputs)
+		}
+	}
+	stack.SetOutputs(nil, stackOutputs, recorded)
+}
+
+// returns absolute paths, so that they can be used from any working directory
+func absPaths(paths []string) []string {
+	var result []string
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			absPath = path
+		}
+		result = append(result, absPath)
+	}
+	return result
+}
@@ -0,0 +1,304 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+// Package liftoff provides API for driving liftoff programmatically from Go code.
+package liftoff
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/event"
+	"github.com/bitshifted/liftoff/exec"
+	"github.com/bitshifted/liftoff/history"
+	"github.com/bitshifted/liftoff/log"
+	"github.com/rs/zerolog"
+)
+
+// Options control how liftoff interacts with its environment
+type Options struct {
+	// Logger for log messages. Logging is disabled if not set
+	Logger *zerolog.Logger
+	// Callback receiving progress events
+	OnEvent event.Handler
+	// Runner for external commands. Defaults to running real binaries
+	Runner exec.Runner
+	// Input of interactive commands, like SSH sessions. Input is empty if not set
+	Stdin io.Reader
+	// Destinations for output of Terraform, Ansible and Git. Output is discarded if not set
+	Stdout io.Writer
+	Stderr io.Writer
+	// Paths to binaries. Looked up in PATH if not set
+	TerraformPath       string
+	AnsiblePlaybookPath string
+	// Capture output of external commands and attach it to events instead of writing it to Stdout and Stderr.
+	// Terraform and Ansible progress is reported as resource change and task result events
+	MachineReadable bool
+	// Identifier of the run, used for naming log directories. Generated for each operation if not set
+	RunID string
+	// Per-run log to which output of external commands is copied
+	RunLog io.Writer
+	// Store in which setup and teardown runs are recorded. History is not recorded if not set
+	History *history.Store
+	// Variables set on command line, overriding variables from configuration
+	Overrides config.Overrides
+}
+
+// SetupOptions control which steps are performed during setup
+type SetupOptions struct {
+	SkipTerraform bool
+	SkipAnsible   bool
+	// Terraform resource addresses to which setup is limited. Ansible is limited to hosts of these resources
+	Targets []string
+	// Terraform resource addresses which are forced to be recreated
+	Replace []string
+	// Link snippet with SSH host entries into ~/.ssh/config.d
+	LinkSSHConfig bool
+	// Do not run health checks after setup
+	SkipChecks bool
+	// Skip phases completed by previous setup, if configuration and template did not change
+	Resume bool
+	// Skip phases before given one. Phases are listed in exec.SetupPhases
+	FromPhase string
+	// Run only given phase
+	OnlyPhase string
+}
+
+// PlanOptions control which resources are planned
+type PlanOptions struct {
+	Targets []string
+	Replace []string
+}
+
+// TeardownOptions control which steps are performed during teardown
+type TeardownOptions struct {
+	// Render templates before destroying infrastructure
+	Render bool
+	// Do not run template pre-destroy playbook
+	SkipPreDestroy bool
+	// Keep generated files and other local artifacts
+	KeepArtifacts bool
+	// Terraform resource addresses to destroy. Everything is destroyed if not set
+	Targets []string
+	// Destroy targeted resources without confirmation
+	AutoApprove bool
+	// Asks user to confirm destruction of targeted resources, after destroy plan is shown
+	Confirm func(message string) (bool, error)
+}
+
+// PhaseTiming records execution time of single phase
+type PhaseTiming struct {
+	Phase    string
+	Started  time.Time
+	Duration time.Duration
+	Failed   bool
+}
+
+// Result contains structured results of an operation
+type Result struct {
+	// Values of Terraform outputs, if they were collected
+	Outputs map[string]interface{}
+	// Names of Terraform outputs marked as sensitive
+	SensitiveOutputs []string
+	// Files created or modified by template processing
+	ChangedFiles []string
+	Phases       []PhaseTiming
+	// Results of health checks run after setup
+	Checks []exec.CheckResult
+	// Results of individual stacks, for configurations with multiple stacks
+	Stacks []StackResult
+	// True if Terraform apply was run, so infrastructure may have been changed
+	TerraformApplied bool
+}
+
+// PlanResult contains result of a plan operation
+type PlanResult struct {
+	Result
+	// True if applying configuration would change infrastructure
+	HasChanges bool
+}
+
+// Project is a loaded liftoff configuration
+type Project struct {
+	config     *config.Configuration
+	configPath string
+	options    Options
+}
+
+// Load reads and validates configuration file at given path
+func Load(ctx context.Context, path string, opts Options) (*Project, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	opts.Logger = log.OrNop(opts.Logger)
+	conf, err := config.LoadConfigWithOverrides(absPath, opts.Overrides)
+	if err != nil {
+		opts.Logger.Error().Err(err).Msgf("Failed to load configuration file %s", absPath)
+		return nil, err
+	}
+	if opts.Stdin == nil {
+		opts.Stdin = strings.NewReader("")
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = io.Discard
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = io.Discard
+	}
+	return &Project{
+		config:     conf,
+		configPath: absPath,
+		options:    opts,
+	}, nil
+}
+
+// ConfigPath returns absolute path of the configuration file
+func (p *Project) ConfigPath() string {
+	return p.configPath
+}
+
+// Setup provisions infrastructure with Terraform and configures it with Ansible
+func (p *Project) Setup(ctx context.Context, opts SetupOptions) (*Result, error) {
+	if p.config.HasStacks() {
+		return p.setupStacks(ctx, opts)
+	}
+	ec := p.newExecution(ctx)
+	opts.apply(ec)
+	started := time.Now()
+	err := ec.ExecuteSetup()
+	result := newResult(ec.Report)
+	p.recordSetup(ec.RunID, started, result, err)
+	return result, err
+}
+
+// Teardown destroys provisioned infrastructure
+func (p *Project) Teardown(ctx context.Context, opts TeardownOptions) (*Result, error) {
+	if p.config.HasStacks() {
+		return p.teardownStacks(ctx, opts)
+	}
+	ec := p.newExecution(ctx)
+	opts.apply(ec)
+	started := time.Now()
+	err := ec.ExecuteTeardown()
+	p.recordTeardown(ec.RunID, opts, started, err)
+	return newResult(ec.Report), err
+}
+
+// Plan renders Terraform templates and checks if infrastructure needs to be changed
+func (p *Project) Plan(ctx context.Context, opts PlanOptions) (*PlanResult, error) {
+	if p.config.HasStacks() {
+		return p.planStacks(ctx, opts)
+	}
+	ec := p.newExecution(ctx)
+	opts.apply(ec)
+	err := ec.ExecutePlan()
+	return newPlanResult(ec.Report), err
+}
+
+// Render generates Terraform and Ansible files from templates without running them
+func (p *Project) Render(ctx context.Context) (*Result, error) {
+	if p.config.HasStacks() {
+		return p.renderStacks(ctx)
+	}
+	ec := p.newExecution(ctx)
+	err := ec.ExecuteRender()
+	return newResult(ec.Report), err
+}
+
+func (opts SetupOptions) apply(ec *exec.ExecutionConfig) {
+	ec.SkipTerraform = opts.SkipTerraform
+	ec.SkipAnsible = opts.SkipAnsible
+	ec.Targets = opts.Targets
+	ec.Replace = opts.Replace
+	ec.LinkSSHConfig = opts.LinkSSHConfig
+	ec.SkipChecks = opts.SkipChecks
+	ec.Resume = opts.Resume
+	ec.FromPhase = opts.FromPhase
+	ec.OnlyPhase = opts.OnlyPhase
+}
+
+func (opts TeardownOptions) apply(ec *exec.ExecutionConfig) {
+	ec.RenderBeforeDestroy = opts.Render
+	ec.SkipPreDestroy = opts.SkipPreDestroy
+	ec.KeepArtifacts = opts.KeepArtifacts
+	ec.Targets = opts.Targets
+	ec.AutoApprove = opts.AutoApprove
+	ec.Confirm = opts.Confirm
+}
+
+func (opts PlanOptions) apply(ec *exec.ExecutionConfig) {
+	ec.Targets = opts.Targets
+	ec.Replace = opts.Replace
+}
+
+// creates execution for single operation
+func (p *Project) newExecution(ctx context.Context) *exec.ExecutionConfig {
+	return p.newExecutionFor(ctx, p.config, "", p.runID())
+}
+
+// creates execution for configuration or one of its stacks. Configuration is copied, since execution adds
+// Terraform outputs and template configuration to it
+func (p *Project) newExecutionFor(ctx context.Context, source *config.Configuration, stackName, runID string) *exec.ExecutionConfig {
+	conf := *source
+	conf.ProcessingVars = make(map[string]interface{}, len(source.ProcessingVars))
+	for k, v := range source.ProcessingVars {
+		conf.ProcessingVars[k] = v
+	}
+	return &exec.ExecutionConfig{
+		Config:              &conf,
+		ConfigFilePath:      p.configPath,
+		StackName:           stackName,
+		TerraformPath:       p.options.TerraformPath,
+		AnsiblePlaybookPath: p.options.AnsiblePlaybookPath,
+		Runner:              p.options.Runner,
+		Context:             ctx,
+		Logger:              p.options.Logger,
+		Stdin:               p.options.Stdin,
+		Stdout:              p.options.Stdout,
+		Stderr:              p.options.Stderr,
+		OnEvent:             p.options.OnEvent,
+		MachineReadable:     p.options.MachineReadable,
+		RunID:               runID,
+		RunLog:              p.options.RunLog,
+	}
+}
+
+// returns configured run ID, or generates new one for each operation
+func (p *Project) runID() string {
+	if p.options.RunID != "" {
+		return p.options.RunID
+	}
+	return log.NewRunID()
+}
+
+func newResult(report *exec.Report) *Result {
+	result := &Result{}
+	if report == nil {
+		return result
+	}
+	result.Outputs = report.Outputs
+	result.SensitiveOutputs = report.SensitiveOutputs
+	result.ChangedFiles = report.ChangedFiles
+	result.Checks = report.Checks
+	result.TerraformApplied = report.TerraformApplied
+	for _, phase := range report.Phases {
+		result.Phases = append(result.Phases, PhaseTiming(phase))
+	}
+	return result
+}
+
+func newPlanResult(report *exec.Report) *PlanResult {
+	result := &PlanResult{Result: *newResult(report)}
+	if report != nil {
+		result.HasChanges = report.HasChanges
+	}
+	return result
+}
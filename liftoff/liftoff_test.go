@@ -0,0 +1,285 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/event"
+	"github.com/bitshifted/liftoff/exec"
+	"github.com/bitshifted/liftoff/history"
+	"github.com/bitshifted/liftoff/log"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunner records commands and returns canned output for "terraform output". It is safe for concurrent use
+type fakeRunner struct {
+	mu       sync.Mutex
+	commands []string
+	dirs     []string
+	outputs  string
+	planErr  error
+}
+
+func (r *fakeRunner) LookPath(file string) (string, error) {
+	return file, nil
+}
+
+func (r *fakeRunner) Run(_ context.Context, cmd *exec.Command) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, strings.TrimSpace(cmd.Path+" "+strings.Join(cmd.Args, " ")))
+	r.dirs = append(r.dirs, cmd.Dir)
+	if len(cmd.Args) > 0 && cmd.Args[0] == "output" {
+		_, err := io.WriteString(cmd.Stdout, r.outputs)
+		return err
+	}
+	if len(cmd.Args) > 0 && cmd.Args[0] == "plan" {
+		return r.planErr
+	}
+	return nil
+}
+
+// copies test configuration to temporary directory, so that generated files do not end up in source tree
+func copyConfig(t *testing.T) string {
+	return copyConfigFile(t, "liftoff.yaml")
+}
+
+func copyConfigFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(filepath.Join("test_files", name))
+	assert.NoError(t, err)
+	configPath := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(configPath, data, 0o600))
+	return configPath
+}
+
+func TestSetupReturnsStructuredResult(t *testing.T) {
+	runner := &fakeRunner{outputs: `{"server_ip": {"sensitive": false, "type": "string", "value": "10.0.0.5"}}`}
+	var events []event.Event
+	project, err := Load(context.Background(), copyConfig(t), Options{
+		Runner:  runner,
+		OnEvent: func(e event.Event) { events = append(events, e) },
+	})
+	assert.NoError(t, err)
+	result, err := project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", result.Outputs["server_ip"])
+	// rendered templates and generated required providers file
+	assert.Len(t, result.ChangedFiles, 3)
+	phases := []string{}
+	for _, p := range result.Phases {
+		phases = append(phases, p.Phase)
+		assert.False(t, p.Failed)
+	}
+	assert.Equal(t, []string{"fetch", "preflight", "render", "terraform", "ssh-config", "ansible-render", "ansible"}, phases)
+	phaseEvents := 0
+	for _, e := range events {
+		if e.Type == event.PhaseStarted || e.Type == event.PhaseFinished {
+			phaseEvents++
+		}
+	}
+	assert.Equal(t, 2*len(phases), phaseEvents)
+	assert.Equal(t, event.PhaseStarted, events[0].Type)
+	assert.Equal(t, []string{
+		"terraform init",
+		"terraform apply -auto-approve -json",
+		"terraform output -json",
+		"ansible-galaxy collection list ansible.posix --format json",
+		"ansible-playbook -i inventory playbook.yaml",
+	}, runner.commands)
+
+	// second run on the same project must not see outputs from the first one,
+	// so only inventory is changed
+	result, err = project.Render(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, result.ChangedFiles, 1)
+	assert.True(t, strings.HasSuffix(result.ChangedFiles[0], "inventory"))
+}
+
+func TestPlanReportsChanges(t *testing.T) {
+	runner := &fakeRunner{planErr: planExitError{}}
+	project, err := Load(context.Background(), copyConfig(t), Options{Runner: runner})
+	assert.NoError(t, err)
+	result, err := project.Plan(context.Background(), PlanOptions{})
+	assert.NoError(t, err)
+	assert.True(t, result.HasChanges)
+	assert.Equal(t, []string{"terraform init", "terraform plan -input=false -detailed-exitcode"}, runner.commands)
+
+	runner = &fakeRunner{}
+	project, err = Load(context.Background(), copyConfig(t), Options{Runner: runner})
+	assert.NoError(t, err)
+	result, err = project.Plan(context.Background(), PlanOptions{})
+	assert.NoError(t, err)
+	assert.False(t, result.HasChanges)
+}
+
+func TestTeardownStopsOnCancelledContext(t *testing.T) {
+	runner := &fakeRunner{}
+	project, err := Load(context.Background(), copyConfig(t), Options{Runner: runner})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = project.Teardown(ctx, TeardownOptions{})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Empty(t, runner.commands)
+}
+
+func TestLoadFailsForMissingConfig(t *testing.T) {
+	_, err := Load(context.Background(), "test_files/missing.yaml", Options{})
+	assert.Error(t, err)
+}
+
+func TestSetupLogsOnlyToConfiguredLogger(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var global bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&global)
+	defer func() { log.Logger = previous }()
+
+	project, err := Load(context.Background(), copyConfig(t), Options{Runner: &fakeRunner{outputs: "{}"}})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+	_, err = Load(context.Background(), "test_files/missing.yaml", Options{})
+	assert.Error(t, err)
+	assert.Empty(t, global.String())
+
+	var own bytes.Buffer
+	logger := zerolog.New(&own)
+	project, err = Load(context.Background(), copyConfig(t), Options{Runner: &fakeRunner{outputs: "{}"}, Logger: &logger})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, own.String(), "Template directory")
+	assert.Empty(t, global.String())
+}
+
+type planExitError struct{}
+
+func (planExitError) Error() string { return "exit status 2" }
+func (planExitError) ExitCode() int { return 2 }
+
+func TestSetupAndTeardownRecordHistory(t *testing.T) {
+	configPath := copyConfig(t)
+	f, err := os.OpenFile(configPath, os.O_APPEND|os.O_WRONLY, 0o600)
+	assert.NoError(t, err)
+	_, err = f.WriteString("ttl: 3h\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	store := &history.Store{Dir: t.TempDir()}
+	project, err := Load(context.Background(), configPath, Options{Runner: &fakeRunner{}, History: store})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+
+	stack, err := store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	assert.True(t, stack.Active)
+	assert.Equal(t, "3h", stack.TTL)
+	assert.Equal(t, commandSetup, stack.LastRun().Command)
+	assert.Equal(t, history.StatusSucceeded, stack.LastRun().Status)
+	assert.NotEmpty(t, stack.LastRun().ID)
+	assert.WithinDuration(t, stack.LastRun().Started.Add(3*time.Hour), *stack.ExpiresAt, time.Second)
+
+	expired, err := ExpiredStacks(store, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+	expired, err = ExpiredStacks(store, time.Now().Add(4*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+
+	_, err = project.Teardown(context.Background(), TeardownOptions{})
+	assert.NoError(t, err)
+	stack, err = store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	assert.False(t, stack.Active)
+	assert.Nil(t, stack.ExpiresAt)
+	assert.Len(t, stack.Runs, 2)
+}
+
+func TestSetupKeepsExpiryOfActiveStack(t *testing.T) {
+	configPath := copyConfig(t)
+	f, err := os.OpenFile(configPath, os.O_APPEND|os.O_WRONLY, 0o600)
+	assert.NoError(t, err)
+	_, err = f.WriteString("ttl: 3h\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	store := &history.Store{Dir: t.TempDir()}
+	project, err := Load(context.Background(), configPath, Options{Runner: &fakeRunner{}, History: store})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+	stack, err := store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	expiresAt := *stack.ExpiresAt
+
+	// re-running only Ansible does not touch infrastructure, and repeated setup does not extend TTL
+	_, err = project.Setup(context.Background(), SetupOptions{OnlyPhase: "ansible"})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+	stack, err = store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	assert.True(t, stack.Active)
+	assert.Len(t, stack.Runs, 3)
+	assert.Equal(t, expiresAt, *stack.ExpiresAt)
+}
+
+func TestSetupRecordsOverrides(t *testing.T) {
+	configPath := copyConfig(t)
+	varFile := filepath.Join(filepath.Dir(configPath), "vars.yaml")
+	assert.NoError(t, os.WriteFile(varFile, []byte("server_name: db\n"), 0o600))
+
+	store := &history.Store{Dir: t.TempDir()}
+	project, err := Load(context.Background(), configPath, Options{
+		Runner:    &fakeRunner{},
+		History:   store,
+		Overrides: config.Overrides{VarFiles: []string{varFile}, Vars: []string{"server_type=cx22"}},
+	})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+
+	stack, err := store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{varFile}, stack.VarFiles)
+	assert.Equal(t, []string{"server_type=cx22"}, stack.Vars)
+	assert.Empty(t, stack.Stacks)
+}
+
+func TestSetupFailedBeforeTerraformDoesNotActivateStack(t *testing.T) {
+	t.Setenv("HCLOUD_TOKEN", "")
+	data, err := os.ReadFile(filepath.Join("test_files", "liftoff.yaml"))
+	assert.NoError(t, err)
+	configPath := filepath.Join(t.TempDir(), "liftoff.yaml")
+	content := strings.Replace(string(data), "  credentials:\n    HCLOUD_TOKEN: test-token\n", "", 1)
+	assert.NoError(t, os.WriteFile(configPath, []byte(content+"ttl: 3h\n"), 0o600))
+
+	store := &history.Store{Dir: t.TempDir()}
+	runner := &fakeRunner{}
+	project, err := Load(context.Background(), configPath, Options{Runner: runner, History: store})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.ErrorIs(t, err, exec.ErrMissingCredentials)
+	assert.Empty(t, runner.commands)
+
+	stack, err := store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	assert.False(t, stack.Active)
+	assert.Nil(t, stack.ExpiresAt)
+	assert.Equal(t, history.StatusFailed, stack.LastRun().Status)
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitshifted/liftoff/exec"
+	"github.com/bitshifted/liftoff/history"
+)
+
+// ErrOutputNotFound is returned when selected output or value inside it does not exist
+var ErrOutputNotFound = errors.New("output not found")
+
+// SensitiveValue replaces values of sensitive outputs when they are masked
+const SensitiveValue = "<sensitive>"
+
+// OutputValues are outputs of provisioned infrastructure
+type OutputValues struct {
+	// Output values. For configuration with multiple stacks and no stack selected, values are keyed by stack name
+	Values map[string]interface{}
+	// Paths of sensitive outputs, like "db_password", or "app.db_password" for outputs of stacks
+	Sensitive []string
+	// Time when outputs were recorded in run history, if they were read from history because Terraform was
+	// not available. Zero otherwise
+	CachedAt time.Time
+}
+
+// Cached returns true if outputs were read from run history
+func (o *OutputValues) Cached() bool {
+	return !o.CachedAt.IsZero()
+}
+
+// IsSensitive returns true if path points to sensitive output or value inside it
+func (o *OutputValues) IsSensitive(path string) bool {
+	for _, name := range o.Sensitive {
+		if path == name || strings.HasPrefix(path, name+".") || strings.HasPrefix(path, name+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Masked returns values with sensitive outputs replaced by SensitiveValue
+func (o *OutputValues) Masked() map[string]interface{} {
+	masked := copyOutputs(o.Values)
+	for _, name := range o.Sensitive {
+		target := masked
+		key := name
+		if stack, output, found := strings.Cut(name, "."); found {
+			stackValues, ok := masked[stack].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			target = copyOutputs(stackValues)
+			masked[stack] = target
+			key = output
+		}
+		if _, ok := target[key]; ok {
+			target[key] = SensitiveValue
+		}
+	}
+	return masked
+}
+
+// Outputs returns Terraform outputs of provisioned infrastructure, together with path of generated SSH config
+// in "ssh_config_file" output. For configuration with multiple stacks, outputs of selected stack are returned,
+// or outputs of all stacks keyed by stack name if stack is not selected. If Terraform outputs are not
+// available, outputs recorded in run history at last successful setup are returned
+func (p *Project) Outputs(ctx context.Context, stack string) (*OutputValues, error) {
+	var stacks []string
+	if p.config.HasStacks() {
+		stacks = p.Stacks()
+		if stack != "" {
+			if !slices.Contains(stacks, stack) {
+				return nil, fmt.Errorf("stack '%s' does not exist", stack)
+			}
+			stacks = []string{stack}
+		}
+	} else if stack != "" {
+		return nil, fmt.Errorf("configuration does not have stacks")
+	}
+	outputs, err := p.collectOutputs(ctx, stacks, stack == "")
+	if err == nil {
+		return outputs, nil
+	}
+	p.options.Logger.Debug().Err(err).Msg("Terraform outputs are not available")
+	return p.cachedOutputs(stacks, stack == "", err)
+}
+
+// collects outputs with Terraform. Outputs of stacks are keyed by stack name if nested is true
+func (p *Project) collectOutputs(ctx context.Context, stacks []string, nested bool) (*OutputValues, error) {
+	runID := p.runID()
+	if len(stacks) == 0 {
+		ec := p.newExecution(ctx)
+		if err := ec.ExecuteOutputs(); err != nil {
+			return nil, err
+		}
+		values := addBuiltinOutputs(ec, ec.Report.Outputs)
+		return &OutputValues{Values: values, Sensitive: ec.Report.SensitiveOutputs}, nil
+	}
+	result := &OutputValues{Values: map[string]interface{}{}}
+	for _, name := range stacks {
+		ec, err := p.newStackExecution(ctx, name, runID, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = ec.ExecuteOutputs(); err != nil {
+			return nil, fmt.Errorf("stack %s: %w", name, err)
+		}
+		values := addBuiltinOutputs(ec, ec.Report.Outputs)
+		if !nested {
+			return &OutputValues{Values: values, Sensitive: ec.Report.SensitiveOutputs}, nil
+		}
+		result.Values[name] = values
+		for _, sensitive := range ec.Report.SensitiveOutputs {
+			result.Sensitive = append(result.Sensitive, name+"."+sensitive)
+		}
+	}
+	return result, nil
+}
+
+// returns outputs recorded in run history. Error of collecting outputs is returned if there are none
+func (p *Project) cachedOutputs(stacks []string, nested bool, collectErr error) (*OutputValues, error) {
+	if p.options.History == nil {
+		return nil, collectErr
+	}
+	stack, err := p.options.History.Load(p.configPath)
+	if err != nil {
+		return nil, errors.Join(collectErr, err)
+	}
+	if stack.OutputsRecorded == nil {
+		return nil, fmt.Errorf("%w, and no outputs are recorded in run history", collectErr)
+	}
+	p.options.Logger.Warn().Msgf("Terraform outputs are not available, using outputs recorded at %s",
+		stack.OutputsRecorded.Format(time.RFC3339))
+	result := &OutputValues{Values: map[string]interface{}{}, CachedAt: *stack.OutputsRecorded}
+	if len(stacks) == 0 {
+		result.Values, result.Sensitive = historyOutputs(stack.Outputs, "")
+		return result, nil
+	}
+	for _, name := range stacks {
+		values, sensitive := historyOutputs(stack.StackOutputs[name], "")
+		if !nested {
+			result.Values, result.Sensitive = values, sensitive
+			return result, nil
+		}
+		result.Values[name] = values
+		_, prefixed := historyOutputs(stack.StackOutputs[name], name+".")
+		result.Sensitive = append(result.Sensitive, prefixed...)
+	}
+	return result, nil
+}
+
+func historyOutputs(outputs map[string]history.Output, prefix string) (map[string]interface{}, []string) {
+	values := make(map[string]interface{}, len(outputs))
+	var sensitive []string
+	for name, output := range outputs {
+		values[name] = output.Value
+		if output.Sensitive {
+			sensitive = append(sensitive, prefix+name)
+		}
+	}
+	return values, sensitive
+}
+
+// adds path of generated SSH config to outputs, unless Terraform defines output with the same name
+func addBuiltinOutputs(ec *exec.ExecutionConfig, outputs map[string]interface{}) map[string]interface{} {
+	values := copyOutputs(outputs)
+	if _, ok := values[exec.SSHConfigFileVar]; ok {
+		return values
+	}
+	if _, err := os.Stat(ec.SSHConfigFilePath()); err == nil {
+		values[exec.SSHConfigFileVar] = ec.SSHConfigFilePath()
+	}
+	return values
+}
+
+func copyOutputs(outputs map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(outputs))
+	for k, v := range outputs {
+		result[k] = v
+	}
+	return result
+}
+
+// SelectOutput returns value at path inside outputs. Path consists of names separated by dots and list
+// indexes in square brackets, like "servers[0].ipv4"
+func SelectOutput(values map[string]interface{}, path string) (interface{}, error) {
+	segments, err := parseOutputPath(path)
+	if err != nil {
+		return nil, err
+	}
+	var current interface{} = values
+	for i, segment := range segments {
+		location := strings.Join(segments[:i+1], "")
+		switch v := current.(type) {
+		case map[string]interface{}:
+			if strings.HasPrefix(segment, "[") {
+				return nil, fmt.Errorf("%s is not a list", strings.Join(segments[:i], ""))
+			}
+			value, ok := v[strings.TrimPrefix(segment, ".")]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrOutputNotFound, strings.TrimPrefix(location, "."))
+			}
+			current = value
+		case []interface{}:
+			if !strings.HasPrefix(segment, "[") {
+				return nil, fmt.Errorf("%s is a list, index is expected", strings.Join(segments[:i], ""))
+			}
+			index, _ := strconv.Atoi(strings.Trim(segment, "[]"))
+			if index >= len(v) {
+				return nil, fmt.Errorf("%w: index %d is out of range in %s", ErrOutputNotFound, index, strings.Join(segments[:i], ""))
+			}
+			current = v[index]
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrOutputNotFound, strings.TrimPrefix(location, "."))
+		}
+	}
+	return current, nil
+}
+
+// splits path into segments, each being either ".name" or "[index]". First name has no dot
+func parseOutputPath(path string) ([]string, error) {
+	var segments []string
+	rest := path
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid output path '%s': missing ']'", path)
+			}
+			if _, err := strconv.ParseUint(rest[1:end], 10, 0); err != nil {
+				return nil, fmt.Errorf("invalid output path '%s': invalid index '%s'", path, rest[1:end])
+			}
+			segments = append(segments, rest[:end+1])
+			rest = rest[end+1:]
+		default:
+			start := 0
+			if rest[0] == '.' {
+				if len(segments) == 0 {
+					return nil, fmt.Errorf("invalid output path '%s'", path)
+				}
+				start = 1
+			}
+			end := strings.IndexAny(rest[start:], ".[")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += start
+			}
+			if end == start {
+				return nil, fmt.Errorf("invalid output path '%s': empty name", path)
+			}
+			segments = append(segments, rest[:end])
+			rest = rest[end:]
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid output path '%s'", path)
+	}
+	return segments, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitshifted/liftoff/history"
+	"github.com/stretchr/testify/assert"
+)
+
+const sensitiveOutputs = `{
+	"server_ip": {"value": "10.0.0.5", "type": "string"},
+	"db_password": {"value": "secret", "type": "string", "sensitive": true}
+}`
+
+// runner without Terraform installed
+type missingTerraformRunner struct {
+	fakeRunner
+}
+
+func (r *missingTerraformRunner) LookPath(file string) (string, error) {
+	return "", errors.New("executable file not found")
+}
+
+func TestOutputsMasksSensitiveValues(t *testing.T) {
+	project, err := Load(context.Background(), copyConfig(t), Options{Runner: &fakeRunner{outputs: sensitiveOutputs}})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+
+	outputs, err := project.Outputs(context.Background(), "")
+	assert.NoError(t, err)
+	assert.False(t, outputs.Cached())
+	assert.Equal(t, "secret", outputs.Values["db_password"])
+	assert.Equal(t, []string{"db_password"}, outputs.Sensitive)
+	assert.True(t, outputs.IsSensitive("db_password"))
+	assert.False(t, outputs.IsSensitive("server_ip"))
+	masked := outputs.Masked()
+	assert.Equal(t, SensitiveValue, masked["db_password"])
+	assert.Equal(t, "10.0.0.5", masked["server_ip"])
+	// values are not modified by masking
+	assert.Equal(t, "secret", outputs.Values["db_password"])
+}
+
+func TestOutputsFallBackToHistory(t *testing.T) {
+	configPath := copyConfig(t)
+	store := &history.Store{Dir: t.TempDir()}
+	project, err := Load(context.Background(), configPath, Options{Runner: &fakeRunner{outputs: sensitiveOutputs}, History: store})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{})
+	assert.NoError(t, err)
+	stack, err := store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	// sensitive values are not recorded
+	assert.Equal(t, history.Output{Sensitive: true}, stack.Outputs["db_password"])
+
+	project, err = Load(context.Background(), configPath, Options{Runner: &missingTerraformRunner{}, History: store})
+	assert.NoError(t, err)
+	outputs, err := project.Outputs(context.Background(), "")
+	assert.NoError(t, err)
+	assert.True(t, outputs.Cached())
+	assert.Equal(t, "10.0.0.5", outputs.Values["server_ip"])
+	assert.True(t, outputs.IsSensitive("db_password"))
+
+	// outputs are cleared after teardown
+	project, err = Load(context.Background(), configPath, Options{Runner: &fakeRunner{}, History: store})
+	assert.NoError(t, err)
+	_, err = project.Teardown(context.Background(), TeardownOptions{})
+	assert.NoError(t, err)
+	project, err = Load(context.Background(), configPath, Options{Runner: &missingTerraformRunner{}, History: store})
+	assert.NoError(t, err)
+	_, err = project.Outputs(context.Background(), "")
+	assert.ErrorContains(t, err, "no outputs are recorded in run history")
+}
+
+func TestSelectOutput(t *testing.T) {
+	values := map[string]interface{}{
+		"servers": []interface{}{
+			map[string]interface{}{"name": "web", "ipv4": "10.0.0.5"},
+		},
+		"region": "fsn1",
+	}
+	value, err := SelectOutput(values, "servers[0].ipv4")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", value)
+	value, err = SelectOutput(values, "region")
+	assert.NoError(t, err)
+	assert.Equal(t, "fsn1", value)
+
+	_, err = SelectOutput(values, "servers[1].ipv4")
+	assert.ErrorIs(t, err, ErrOutputNotFound)
+	_, err = SelectOutput(values, "servers[0].ipv6")
+	assert.ErrorIs(t, err, ErrOutputNotFound)
+	_, err = SelectOutput(values, "servers.name")
+	assert.ErrorContains(t, err, "servers is a list")
+	_, err = SelectOutput(values, "servers[x]")
+	assert.ErrorContains(t, err, "invalid index 'x'")
+	_, err = SelectOutput(values, ".region")
+	assert.ErrorContains(t, err, "invalid output path")
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// extensions of configuration files found in directories
+var configFileExtensions = []string{".yaml", ".yml"}
+
+// ExpandConfigPaths converts list of configuration files, directories and glob patterns to list of
+// absolute configuration file paths. Directories are expanded to YAML files they contain. Duplicates are
+// removed, and order of arguments is preserved
+func ExpandConfigPaths(patterns []string) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+	add := func(path string) error {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if !seen[absPath] {
+			seen[absPath] = true
+			result = append(result, absPath)
+		}
+		return nil
+	}
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no configuration files match '%s'", pattern)
+			}
+		}
+		for _, match := range matches {
+			files, err := configFilesIn(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				if err = add(file); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// returns path itself if it is a file, or YAML files in it if it is a directory
+func configFilesIn(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isConfigFile(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration files found in directory %s", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isConfigFile(name string) bool {
+	ext := filepath.Ext(name)
+	for _, configExt := range configFileExtensions {
+		if ext == configExt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandConfigPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.yaml", "a.yml", "notes.txt", "c.yaml"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("---\n"), 0o600))
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+
+	paths, err := ExpandConfigPaths([]string{filepath.Join(dir, "c.yaml"), dir})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "c.yaml"),
+		filepath.Join(dir, "a.yml"),
+		filepath.Join(dir, "b.yaml"),
+	}, paths)
+
+	paths, err = ExpandConfigPaths([]string{filepath.Join(dir, "*.yaml")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "b.yaml"), filepath.Join(dir, "c.yaml")}, paths)
+}
+
+func TestExpandConfigPathsErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := ExpandConfigPaths([]string{filepath.Join(dir, "missing.yaml")})
+	assert.Error(t, err)
+	_, err = ExpandConfigPaths([]string{filepath.Join(dir, "*.yaml")})
+	assert.Error(t, err)
+	_, err = ExpandConfigPaths([]string{dir})
+	assert.Error(t, err)
+}
@@ -0,0 +1,296 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bitshifted/liftoff/common"
+	"github.com/bitshifted/liftoff/config"
+	"github.com/bitshifted/liftoff/exec"
+)
+
+// ErrDependencyFailed is reported for stacks which were skipped because operation on a stack they
+// depend on failed
+var ErrDependencyFailed = errors.New("dependency failed")
+
+var errTargetsWithStacks = errors.New("targets are not supported for configurations with multiple stacks")
+
+// StackResult is result of an operation on single stack
+type StackResult struct {
+	Name   string
+	Result *Result
+	// Error of the operation. Wraps ErrDependencyFailed if stack was skipped
+	Err error
+}
+
+// Stacks returns names of stacks in the order in which they are applied. Returns nil if configuration
+// does not have multiple stacks
+func (p *Project) Stacks() []string {
+	if !p.config.HasStacks() {
+		return nil
+	}
+	// order is validated when configuration is loaded
+	order, _ := p.config.StackOrder()
+	return order
+}
+
+// outputs of stacks, shared between concurrently processed stacks
+type stackOutputs struct {
+	mu     sync.Mutex
+	values map[string]map[string]interface{}
+}
+
+func newStackOutputs() *stackOutputs {
+	return &stackOutputs{values: map[string]map[string]interface{}{}}
+}
+
+func (so *stackOutputs) set(stack string, outputs map[string]interface{}) {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	so.values[stack] = outputs
+}
+
+// returns outputs of stack, loading them on first use
+func (so *stackOutputs) get(stack string, load func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if outputs, ok := so.values[stack]; ok {
+		return outputs, nil
+	}
+	outputs, err := load()
+	if err != nil {
+		return nil, err
+	}
+	so.values[stack] = outputs
+	return outputs, nil
+}
+
+func (so *stackOutputs) snapshot() map[string]map[string]interface{} {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	result := make(map[string]map[string]interface{}, len(so.values))
+	for k, v := range so.values {
+		result[k] = v
+	}
+	return result
+}
+
+// creates execution for a stack, with references to other stacks resolved from outputs. References
+// are left unresolved if outputs are nil
+func (p *Project) newStackExecution(ctx context.Context, name, runID string, outputs map[string]map[string]interface{}) (*exec.ExecutionConfig, error) {
+	conf, err := p.config.StackConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	if outputs != nil {
+		if err = config.ResolveStackReferences(conf.ProcessingVars, outputs); err != nil {
+			return nil, err
+		}
+	}
+	return p.newExecutionFor(ctx, conf, name, runID), nil
+}
+
+// returns outputs of stacks which given stack depends on, reading them from Terraform state
+func (p *Project) dependencyOutputs(ctx context.Context, name, runID string, cache *stackOutputs) (map[string]map[string]interface{}, error) {
+	deps, err := p.config.StackDependencies()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]map[string]interface{}{}
+	for _, dep := range deps[name] {
+		outputs, err := cache.get(dep, func() (map[string]interface{}, error) {
+			ec, err := p.newStackExecution(ctx, dep, runID, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err = ec.ExecuteOutputs(); err != nil {
+				return nil, fmt.Errorf("outputs of stack '%s' are not available: %w", dep, err)
+			}
+			return ec.Report.Outputs, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		result[dep] = outputs
+	}
+	return result, nil
+}
+
+func (p *Project) setupStacks(ctx context.Context, opts SetupOptions) (*Result, error) {
+	if len(opts.Targets) > 0 || len(opts.Replace) > 0 {
+		return nil, errTargetsWithStacks
+	}
+	runID := p.runID()
+	started := time.Now()
+	outputs := newStackOutputs()
+	result, err := p.runStacks(ctx, false, func(ctx context.Context, name string) (*Result, error) {
+		// stacks are started after all their dependencies are finished, so their outputs are available
+		ec, err := p.newStackExecution(ctx, name, runID, outputs.snapshot())
+		if err != nil {
+			return nil, err
+		}
+		opts.apply(ec)
+		err = ec.ExecuteSetup()
+		if ec.Report != nil {
+			outputs.set(name, ec.Report.Outputs)
+		}
+		return newResult(ec.Report), err
+	})
+	p.recordSetup(runID, started, result, err)
+	return result, err
+}
+
+func (p *Project) teardownStacks(ctx context.Context, opts TeardownOptions) (*Result, error) {
+	if len(opts.Targets) > 0 {
+		return nil, errTargetsWithStacks
+	}
+	runID := p.runID()
+	started := time.Now()
+	cache := newStackOutputs()
+	result, err := p.runStacks(ctx, true, func(ctx context.Context, name string) (*Result, error) {
+		// outputs of dependencies are needed only if templates are rendered
+		var outputs map[string]map[string]interface{}
+		if opts.Render || !dirExists(filepath.Join(exec.StackOutputDirPath(p.configPath, name), common.DefaultTerraformDir)) {
+			var err error
+			outputs, err = p.dependencyOutputs(ctx, name, runID, cache)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ec, err := p.newStackExecution(ctx, name, runID, outputs)
+		if err != nil {
+			return nil, err
+		}
+		opts.apply(ec)
+		err = ec.ExecuteTeardown()
+		return newResult(ec.Report), err
+	})
+	p.recordTeardown(runID, opts, started, err)
+	return result, err
+}
+
+func (p *Project) planStacks(ctx context.Context, opts PlanOptions) (*PlanResult, error) {
+	if len(opts.Targets) > 0 || len(opts.Replace) > 0 {
+		return nil, errTargetsWithStacks
+	}
+	runID := p.runID()
+	cache := newStackOutputs()
+	var mu sync.Mutex
+	hasChanges := false
+	result, err := p.runStacks(ctx, false, func(ctx context.Context, name string) (*Result, error) {
+		outputs, err := p.dependencyOutputs(ctx, name, runID, cache)
+		if err != nil {
+			return nil, err
+		}
+		ec, err := p.newStackExecution(ctx, name, runID, outputs)
+		if err != nil {
+			return nil, err
+		}
+		err = ec.ExecutePlan()
+		planResult := newPlanResult(ec.Report)
+		mu.Lock()
+		hasChanges = hasChanges || planResult.HasChanges
+		mu.Unlock()
+		return &planResult.Result, err
+	})
+	return &PlanResult{Result: *result, HasChanges: hasChanges}, err
+}
+
+func (p *Project) renderStacks(ctx context.Context) (*Result, error) {
+	runID := p.runID()
+	cache := newStackOutputs()
+	return p.runStacks(ctx, false, func(ctx context.Context, name string) (*Result, error) {
+		outputs, err := p.dependencyOutputs(ctx, name, runID, cache)
+		if err != nil {
+			return nil, err
+		}
+		ec, err := p.newStackExecution(ctx, name, runID, outputs)
+		if err != nil {
+			return nil, err
+		}
+		err = ec.ExecuteRender()
+		return newResult(ec.Report), err
+	})
+}
+
+// runs operation on all stacks. Each stack is started as soon as stacks it depends on are finished, so
+// independent stacks run in parallel. In reverse mode, stack is started after all stacks depending on it are
+// finished. Stacks whose dependencies failed are skipped
+func (p *Project) runStacks(ctx context.Context, reverse bool, run func(ctx context.Context, name string) (*Result, error)) (*Result, error) {
+	order, err := p.config.StackOrder()
+	if err != nil {
+		return nil, err
+	}
+	deps, err := p.config.StackDependencies()
+	if err != nil {
+		return nil, err
+	}
+	if reverse {
+		deps = reverseDependencies(deps)
+	}
+	index := make(map[string]int, len(order))
+	done := make([]chan struct{}, len(order))
+	for i, name := range order {
+		index[name] = i
+		done[i] = make(chan struct{})
+	}
+	results := make([]StackResult, len(order))
+	var wg sync.WaitGroup
+	for i, name := range order {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			results[i].Name = name
+			for _, dep := range deps[name] {
+				<-done[index[dep]]
+				// result of dependency is written before its channel is closed
+				if results[index[dep]].Err != nil {
+					results[i].Err = fmt.Errorf("%w: stack '%s'", ErrDependencyFailed, dep)
+					return
+				}
+			}
+			p.options.Logger.Info().Msgf("Processing stack %s", name)
+			results[i].Result, results[i].Err = run(ctx, name)
+		}()
+	}
+	wg.Wait()
+
+	result := &Result{Stacks: results}
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil && !errors.Is(res.Err, ErrDependencyFailed) {
+			errs = append(errs, fmt.Errorf("stack %s: %w", res.Name, res.Err))
+		}
+		if res.Result != nil {
+			result.ChangedFiles = append(result.ChangedFiles, res.Result.ChangedFiles...)
+			result.Phases = append(result.Phases, res.Result.Phases...)
+			result.TerraformApplied = result.TerraformApplied || res.Result.TerraformApplied
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// returns map of stacks to stacks which depend on them
+func reverseDependencies(deps map[string][]string) map[string][]string {
+	reversed := make(map[string][]string, len(deps))
+	for name, stackDeps := range deps {
+		for _, dep := range stackDeps {
+			reversed[dep] = append(reversed[dep], name)
+		}
+	}
+	return reversed
+}
+
+func dirExists(dirPath string) bool {
+	info, err := os.Stat(dirPath)
+	return err == nil && info.IsDir()
+}
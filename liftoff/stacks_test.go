@@ -0,0 +1,125 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package liftoff
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitshifted/liftoff/history"
+	"github.com/stretchr/testify/assert"
+)
+
+// returns stack names in the order in which their Terraform commands with given prefix were run
+func stackOrder(runner *fakeRunner, configPath, command string) []string {
+	var order []string
+	baseDir := filepath.Dir(configPath)
+	for i, cmd := range runner.commands {
+		if !strings.HasPrefix(cmd, command) {
+			continue
+		}
+		rel, _ := filepath.Rel(baseDir, runner.dirs[i])
+		// directory is <config name>/<stack>/terraform
+		order = append(order, strings.Split(rel, string(filepath.Separator))[1])
+	}
+	return order
+}
+
+func indexOf(items []string, item string) int {
+	for i, v := range items {
+		if v == item {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestStacksSetupInDependencyOrder(t *testing.T) {
+	configPath := copyConfigFile(t, "stacks.yaml")
+	runner := &fakeRunner{outputs: `{"network_name": {"sensitive": false, "type": "string", "value": "private-net"}}`}
+	store := &history.Store{Dir: t.TempDir()}
+	project, err := Load(context.Background(), configPath, Options{Runner: runner, History: store})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"network", "app", "dns"}, project.Stacks())
+
+	result, err := project.Setup(context.Background(), SetupOptions{SkipAnsible: true})
+	assert.NoError(t, err)
+	assert.Len(t, result.Stacks, 3)
+	for _, stack := range result.Stacks {
+		assert.NoError(t, stack.Err)
+		assert.Equal(t, "private-net", stack.Result.Outputs["network_name"])
+	}
+	order := stackOrder(runner, configPath, "terraform apply")
+	assert.Len(t, order, 3)
+	assert.Less(t, indexOf(order, "network"), indexOf(order, "app"))
+	assert.Less(t, indexOf(order, "network"), indexOf(order, "dns"))
+
+	// output of network stack is used in app stack
+	mainTf, err := os.ReadFile(filepath.Join(filepath.Dir(configPath), "stacks", "app", "terraform", "main.tf"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(mainTf), `"private-net"`)
+	stack, err := store.Load(project.ConfigPath())
+	assert.NoError(t, err)
+	assert.True(t, stack.Active)
+	assert.NotNil(t, stack.ExpiresAt)
+	assert.Equal(t, []string{"network", "app", "dns"}, stack.Stacks)
+
+	runner.commands = nil
+	runner.dirs = nil
+	_, err = project.Teardown(context.Background(), TeardownOptions{KeepArtifacts: true})
+	assert.NoError(t, err)
+	order = stackOrder(runner, configPath, "terraform apply -destroy")
+	assert.Len(t, order, 3)
+	assert.Greater(t, indexOf(order, "network"), indexOf(order, "app"))
+	assert.Greater(t, indexOf(order, "network"), indexOf(order, "dns"))
+}
+
+func TestStacksSkipDependentsOfFailedStack(t *testing.T) {
+	configPath := copyConfigFile(t, "stacks.yaml")
+	// network stack has no outputs, so reference in app stack can not be resolved
+	runner := &fakeRunner{outputs: `{}`}
+	project, err := Load(context.Background(), configPath, Options{Runner: runner})
+	assert.NoError(t, err)
+	result, err := project.Setup(context.Background(), SetupOptions{SkipAnsible: true})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "stack app")
+	for _, stack := range result.Stacks {
+		switch stack.Name {
+		case "app":
+			assert.Error(t, stack.Err)
+			assert.False(t, errors.Is(stack.Err, ErrDependencyFailed))
+		default:
+			assert.NoError(t, stack.Err)
+		}
+	}
+}
+
+func TestStacksRejectTargets(t *testing.T) {
+	project, err := Load(context.Background(), copyConfigFile(t, "stacks.yaml"), Options{Runner: &fakeRunner{}})
+	assert.NoError(t, err)
+	_, err = project.Setup(context.Background(), SetupOptions{Targets: []string{"null_resource.web"}})
+	assert.ErrorIs(t, err, errTargetsWithStacks)
+}
+
+func TestRunStacksSkipsFailedDependencies(t *testing.T) {
+	project, err := Load(context.Background(), copyConfigFile(t, "stacks.yaml"), Options{Runner: &fakeRunner{}})
+	assert.NoError(t, err)
+	errNetwork := errors.New("network failed")
+	result, err := project.runStacks(context.Background(), false, func(_ context.Context, name string) (*Result, error) {
+		if name == "network" {
+			return nil, errNetwork
+		}
+		return &Result{}, nil
+	})
+	assert.ErrorIs(t, err, errNetwork)
+	for _, stack := range result.Stacks {
+		if stack.Name != "network" {
+			assert.ErrorIs(t, stack.Err, ErrDependencyFailed)
+		}
+	}
+}
@@ -4,25 +4,91 @@
 package log
 
 import (
+	"io"
 	"os"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+	runIDField    = "run_id"
+)
+
 var Logger zerolog.Logger
 
+// Config controls logger output
+type Config struct {
+	// Minimum level of log messages, like "debug" or "info". Defaults to "info"
+	Level string
+	// Either "console" or "json". Defaults to "console"
+	Format string
+	// ID of current run, attached to every log entry if set
+	RunID string
+	// Destination for log messages. Defaults to standard error
+	Out io.Writer
+	// Optional additional destination, like per-run log file
+	File io.Writer
+}
+
 func Init(enableDebug bool) {
+	level := zerolog.LevelInfoValue
 	if enableDebug {
-		Logger = zerolog.New(zerolog.ConsoleWriter{
-			Out:        os.Stderr,
-			TimeFormat: time.RFC3339,
-		}).Level(zerolog.DebugLevel).With().Timestamp().Caller().Logger()
-		Logger.Debug().Msg("Debug logging enabled")
-	} else {
-		Logger = zerolog.New(zerolog.ConsoleWriter{
-			Out:        os.Stderr,
-			TimeFormat: time.RFC3339,
-		}).Level(zerolog.InfoLevel).With().Timestamp().Logger()
+		level = zerolog.LevelDebugValue
+	}
+	// level is always valid here
+	_ = Configure(Config{Level: level})
+	Logger.Debug().Msg("Debug logging enabled")
+}
+
+// Configure sets up global logger according to configuration
+func Configure(cfg Config) error {
+	level := zerolog.InfoLevel
+	if cfg.Level != "" {
+		parsed, err := zerolog.ParseLevel(cfg.Level)
+		if err != nil {
+			return err
+		}
+		level = parsed
+	}
+	out := cfg.Out
+	if out == nil {
+		out = os.Stderr
+	}
+	writer := formatWriter(out, cfg.Format, false)
+	if cfg.File != nil {
+		writer = zerolog.MultiLevelWriter(writer, formatWriter(cfg.File, cfg.Format, true))
+	}
+	logCtx := zerolog.New(writer).Level(level).With().Timestamp()
+	if level <= zerolog.DebugLevel {
+		logCtx = logCtx.Caller()
+	}
+	if cfg.RunID != "" {
+		logCtx = logCtx.Str(runIDField, cfg.RunID)
+	}
+	Logger = logCtx.Logger()
+	return nil
+}
+
+// OrNop returns given logger, or logger which discards all messages if it is nil. Library packages use it
+// instead of global logger, which is configured only by command line interface
+func OrNop(logger *zerolog.Logger) *zerolog.Logger {
+	if logger == nil {
+		nop := zerolog.Nop()
+		return &nop
+	}
+	return logger
+}
+
+func formatWriter(out io.Writer, format string, noColor bool) io.Writer {
+	if format == FormatJSON {
+		return out
+	}
+	return zerolog.ConsoleWriter{
+		Out:        out,
+		TimeFormat: time.RFC3339,
+		NoColor:    noColor,
 	}
 }
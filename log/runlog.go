@@ -0,0 +1,111 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package log
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	runIDTimeFormat = "20060102-150405"
+	runIDRandBytes  = 2
+	RunLogFileName  = "liftoff.log"
+	runLogFileMode  = 0o600
+)
+
+// Retention limits number and age of kept run logs
+type Retention struct {
+	// Maximum number of run log directories to keep, including current one. Zero means no limit
+	MaxRuns int
+	// Run log directories older than this are deleted. Zero means no limit
+	MaxAge time.Duration
+}
+
+// NewRunID generates unique identifier for a run. Identifiers sort in the order in which runs were started
+func NewRunID() string {
+	suffix := make([]byte, runIDRandBytes)
+	// rand.Read never returns an error
+	_, _ = rand.Read(suffix)
+	return time.Now().Format(runIDTimeFormat) + "-" + hex.EncodeToString(suffix)
+}
+
+// RunLog is a per-run log file. It is safe for concurrent use, so liftoff logs and output of external
+// commands can be written to it at the same time
+type RunLog struct {
+	mu   sync.Mutex
+	file *os.File
+	// Path to the log file
+	Path string
+}
+
+// OpenRunLog creates log file for the run in <dir>/<runID> directory, and deletes logs of old runs
+// according to retention limits
+func OpenRunLog(dir, runID string, retention Retention) (*RunLog, error) {
+	runDir := filepath.Join(dir, runID)
+	err := os.MkdirAll(runDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	logPath := filepath.Join(runDir, RunLogFileName)
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, runLogFileMode)
+	if err != nil {
+		return nil, err
+	}
+	err = pruneRunLogs(dir, runID, retention)
+	if err != nil {
+		Logger.Warn().Err(err).Msgf("Failed to delete old logs in %s", dir)
+	}
+	return &RunLog{file: file, Path: logPath}, nil
+}
+
+func (rl *RunLog) Write(p []byte) (int, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.file.Write(p)
+}
+
+func (rl *RunLog) Close() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.file.Close()
+}
+
+// deletes run log directories exceeding retention limits. Current run is always kept
+func pruneRunLogs(dir, current string, retention Retention) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	runs := []os.DirEntry{}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != current {
+			runs = append(runs, entry)
+		}
+	}
+	// newest first
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Name() > runs[j].Name()
+	})
+	cutoff := time.Now().Add(-retention.MaxAge)
+	for i, run := range runs {
+		remove := retention.MaxRuns > 0 && i+1 >= retention.MaxRuns
+		if !remove && retention.MaxAge > 0 {
+			info, err := run.Info()
+			remove = err == nil && info.ModTime().Before(cutoff)
+		}
+		if remove {
+			Logger.Debug().Msgf("Deleting old run logs %s", run.Name())
+			if err := os.RemoveAll(filepath.Join(dir, run.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenRunLogPrunesOldRuns(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"20250101-100000-aaaa", "20250102-100000-bbbb", "20250103-100000-cccc"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, name), os.ModePerm))
+	}
+	runLog, err := OpenRunLog(dir, "20250104-100000-dddd", Retention{MaxRuns: 2})
+	assert.NoError(t, err)
+	defer runLog.Close()
+	_, err = runLog.Write([]byte("test entry\n"))
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"20250103-100000-cccc", "20250104-100000-dddd"}, names)
+	data, err := os.ReadFile(filepath.Join(dir, "20250104-100000-dddd", RunLogFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, "test entry\n", string(data))
+}
+
+func TestOpenRunLogPrunesByAge(t *testing.T) {
+	dir := t.TempDir()
+	oldRun := filepath.Join(dir, "20200101-100000-aaaa")
+	assert.NoError(t, os.MkdirAll(oldRun, os.ModePerm))
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.Chtimes(oldRun, old, old))
+	runLog, err := OpenRunLog(dir, NewRunID(), Retention{MaxAge: 24 * time.Hour})
+	assert.NoError(t, err)
+	defer runLog.Close()
+	_, err = os.Stat(oldRun)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConfigureAddsRunIDAndTeesToFile(t *testing.T) {
+	var out, file bytes.Buffer
+	err := Configure(Config{Level: "warn", Format: FormatJSON, RunID: "run-1", Out: &out, File: &file})
+	assert.NoError(t, err)
+	Logger.Info().Msg("hidden")
+	Logger.Warn().Msg("visible")
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "visible", entry["message"])
+	assert.Equal(t, "run-1", entry["run_id"])
+	assert.Equal(t, out.String(), file.String())
+
+	assert.Error(t, Configure(Config{Level: "loud"}))
+	Init(false)
+}
@@ -14,20 +14,14 @@ import (
 var input cli.CLI
 
 func main() {
-	ctx := kong.Parse(&input)
-	log.Init(debugLoggingEnabled(ctx.Args))
-	err := ctx.Run()
+	ctx := kong.Parse(&input, kong.Vars(cli.Vars))
+	err := input.ConfigureLogging()
+	ctx.FatalIfErrorf(err)
+	err = ctx.Run(&input)
+	input.Close()
 	if err != nil {
 		log.Logger.Error().Err(err).Msgf("Execution failed")
+		input.ReportError(err)
 		os.Exit(1)
 	}
 }
-
-func debugLoggingEnabled(args []string) bool {
-	for _, s := range args {
-		if s == "--enable-debug" {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,85 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ANSI color codes used for prefixes, cycled by index
+var prefixColors = []int{36, 33, 35, 32, 34, 31}
+
+// PrefixWriter prefixes each line written to it with a label. Incomplete lines are buffered until
+// newline is written or writer is flushed. Writers sharing the same destination should share the lock,
+// so that lines from different writers are not mixed
+type PrefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+// NewPrefixWriter creates writer which prefixes lines with label. If color is true, label is colored
+// with one of the colors selected by index
+func NewPrefixWriter(out io.Writer, mu *sync.Mutex, label string, index int, color bool) *PrefixWriter {
+	prefix := fmt.Sprintf("[%s] ", label)
+	if color {
+		prefix = fmt.Sprintf("\x1b[%dm[%s]\x1b[0m ", prefixColors[index%len(prefixColors)], label)
+	}
+	return &PrefixWriter{mu: mu, out: out, prefix: []byte(prefix)}
+}
+
+func (pw *PrefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	var lines []byte
+	for {
+		idx := bytes.IndexByte(pw.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		lines = append(lines, pw.prefix...)
+		lines = append(lines, pw.buf[:idx+1]...)
+		pw.buf = pw.buf[idx+1:]
+	}
+	if len(lines) > 0 {
+		if err := pw.write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes buffered incomplete line
+func (pw *PrefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	line := append(append(append([]byte{}, pw.prefix...), pw.buf...), '\n')
+	pw.buf = nil
+	return pw.write(line)
+}
+
+func (pw *PrefixWriter) write(data []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	_, err := pw.out.Write(data)
+	return err
+}
+
+// ColorEnabled returns true if colored output should be written to the file. Colors are used only for
+// terminals, and can be disabled with NO_COLOR environment variable
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package progress
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWriterPrefixesLines(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	w := NewPrefixWriter(&out, &mu, "app", 0, false)
+	_, err := w.Write([]byte("first line\nsecond "))
+	assert.NoError(t, err)
+	assert.Equal(t, "[app] first line\n", out.String())
+	_, err = w.Write([]byte("line\nincomplete"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "[app] first line\n[app] second line\n[app] incomplete\n", out.String())
+	assert.NoError(t, w.Flush())
+}
+
+func TestPrefixWriterColor(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	w := NewPrefixWriter(&out, &mu, "db", 1, true)
+	_, err := w.Write([]byte("text\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "\x1b[33m[db]\x1b[0m text\n", out.String())
+}
+
+func TestPrefixWritersDoNotMixLines(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, label := range []string{"a", "b"} {
+		w := NewPrefixWriter(&out, &mu, label, i, false)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = w.Write([]byte("par"))
+				_, _ = w.Write([]byte("tial\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	for _, line := range bytes.Split(bytes.TrimSuffix(out.Bytes(), []byte("\n")), []byte("\n")) {
+		assert.Contains(t, []string{"[a] partial", "[b] partial"}, string(line))
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitshifted/liftoff/event"
+)
+
+const (
+	tableMinWidth = 0
+	tableTabWidth = 4
+	tablePadding  = 2
+)
+
+// symbols for Terraform actions
+var actionSymbols = map[string]string{
+	"create":  "+",
+	"update":  "~",
+	"delete":  "-",
+	"replace": "-/+",
+	"read":    "<=",
+}
+
+var actionVerbs = map[string]string{
+	"create":  "creating",
+	"update":  "modifying",
+	"delete":  "destroying",
+	"replace": "replacing",
+	"read":    "reading",
+}
+
+type phaseResult struct {
+	name     string
+	duration time.Duration
+	failed   bool
+}
+
+// View renders compact progress of liftoff execution from events, and collects data for
+// end-of-run summary. It is safe for concurrent use
+type View struct {
+	mu        sync.Mutex
+	out       io.Writer
+	phases    []phaseResult
+	resources map[string]int
+	tasks     map[string]int
+	templates int
+	failures  []string
+}
+
+func NewView(out io.Writer) *View {
+	return &View{
+		out:       out,
+		resources: map[string]int{},
+		tasks:     map[string]int{},
+	}
+}
+
+// Handle renders single event. It can be used as event.Handler
+func (v *View) Handle(e event.Event) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// events of different stacks are interleaved, so they are prefixed with stack name
+	prefix := ""
+	phase := e.Phase
+	if e.Stack != "" {
+		prefix = "[" + e.Stack + "] "
+		phase = e.Stack + ": " + e.Phase
+	}
+	switch e.Type {
+	case event.PhaseStarted:
+		v.printf("==> %s\n", phase)
+	case event.PhaseFinished:
+		v.phases = append(v.phases, phaseResult{name: phase, duration: e.Duration, failed: e.Error != ""})
+		if e.Error != "" {
+			v.printf("<== %s failed after %s\n", phase, formatDuration(e.Duration))
+		}
+	case event.TemplateRendered:
+		v.templates++
+	case event.ResourceChanged:
+		v.handleResource(prefix, e.Resource)
+	case event.TaskFinished:
+		v.handleTask(prefix, e.Task)
+	case event.Error:
+		msg := e.Message
+		if msg == "" {
+			msg = e.Error
+		} else if e.Error != "" {
+			msg = fmt.Sprintf("%s: %s", msg, e.Error)
+		}
+		v.printf("  %s! %s\n", prefix, msg)
+	}
+}
+
+func (v *View) handleResource(prefix string, rc *event.ResourceChange) {
+	if rc == nil {
+		return
+	}
+	symbol := actionSymbols[rc.Action]
+	if symbol == "" {
+		symbol = "*"
+	}
+	verb := actionVerbs[rc.Action]
+	if verb == "" {
+		verb = rc.Action
+	}
+	switch rc.Status {
+	case event.StatusStarted:
+		v.printf("  %s%s %s: %s...\n", prefix, symbol, rc.Address, verb)
+	case event.StatusInProgress:
+		v.printf("  %s%s %s: still %s (%s)\n", prefix, symbol, rc.Address, verb, formatDuration(rc.Elapsed))
+	case event.StatusComplete:
+		v.resources[rc.Action]++
+		v.printf("  %s%s %s: %s complete (%s)\n", prefix, symbol, rc.Address, rc.Action, formatDuration(rc.Elapsed))
+	case event.StatusErrored:
+		v.resources[event.StatusFailed]++
+		v.failures = append(v.failures, fmt.Sprintf("%sresource %s: %s failed", prefix, rc.Address, rc.Action))
+		v.printf("  %s%s %s: %s failed (%s)\n", prefix, symbol, rc.Address, rc.Action, formatDuration(rc.Elapsed))
+	}
+}
+
+func (v *View) handleTask(prefix string, tr *event.TaskResult) {
+	if tr == nil {
+		return
+	}
+	v.tasks[tr.Status]++
+	line := fmt.Sprintf("  %s[%s] %s: %s", prefix, tr.Host, tr.Task, tr.Status)
+	if tr.Elapsed > 0 {
+		line = fmt.Sprintf("%s (%s)", line, formatDuration(tr.Elapsed))
+	}
+	if tr.Status == event.StatusFailed || tr.Status == event.StatusUnreachable {
+		failure := fmt.Sprintf("%stask %q on %s: %s", prefix, tr.Task, tr.Host, tr.Status)
+		if tr.Message != "" {
+			failure = fmt.Sprintf("%s - %s", failure, tr.Message)
+			line = fmt.Sprintf("%s - %s", line, tr.Message)
+		}
+		v.failures = append(v.failures, failure)
+	}
+	v.printf("%s\n", line)
+}
+
+// WriteSummary writes end-of-run summary table with phase timings, change counts and failures
+func (v *View) WriteSummary(w io.Writer) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	tw := tabwriter.NewWriter(w, tableMinWidth, tableTabWidth, tablePadding, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tSTATUS\tDURATION")
+	for _, phase := range v.phases {
+		status := "ok"
+		if phase.failed {
+			status = "failed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", phase.name, status, formatDuration(phase.duration))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "Templates rendered:\t%d\n", v.templates)
+	fmt.Fprintf(tw, "Resources:\t%d created, %d updated, %d replaced, %d destroyed, %d failed\n",
+		v.resources["create"], v.resources["update"], v.resources["replace"], v.resources["delete"], v.resources[event.StatusFailed])
+	fmt.Fprintf(tw, "Tasks:\t%d ok, %d changed, %d failed, %d skipped, %d unreachable\n",
+		v.tasks[event.StatusOK], v.tasks[event.StatusChanged], v.tasks[event.StatusFailed],
+		v.tasks[event.StatusSkipped], v.tasks[event.StatusUnreachable])
+	if len(v.failures) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "FAILURES")
+		for _, failure := range v.failures {
+			fmt.Fprintf(tw, "  %s\n", failure)
+		}
+	}
+	return tw.Flush()
+}
+
+func (v *View) printf(format string, args ...interface{}) {
+	// progress output is best effort
+	_, _ = fmt.Fprintf(v.out, format, args...)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
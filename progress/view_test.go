@@ -0,0 +1,50 @@
+// Copyright 2024 Bitshift D.O.O
+// SPDX-License-Identifier: MPL-2.0
+
+package progress
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bitshifted/liftoff/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewRendersProgressAndSummary(t *testing.T) {
+	var out bytes.Buffer
+	view := NewView(&out)
+	view.Handle(event.Event{Type: event.PhaseStarted, Phase: "terraform"})
+	view.Handle(event.Event{Type: event.ResourceChanged, Resource: &event.ResourceChange{
+		Address: "hcloud_server.web", Action: "create", Status: event.StatusStarted,
+	}})
+	view.Handle(event.Event{Type: event.ResourceChanged, Resource: &event.ResourceChange{
+		Address: "hcloud_server.web", Action: "create", Status: event.StatusComplete, Elapsed: 12 * time.Second,
+	}})
+	view.Handle(event.Event{Type: event.PhaseFinished, Phase: "terraform", Duration: 13 * time.Second})
+	view.Handle(event.Event{Type: event.PhaseStarted, Phase: "ansible"})
+	view.Handle(event.Event{Type: event.TaskFinished, Task: &event.TaskResult{
+		Task: "Install nginx", Host: "web1", Status: event.StatusChanged, Elapsed: 3500 * time.Millisecond,
+	}})
+	view.Handle(event.Event{Type: event.TaskFinished, Task: &event.TaskResult{
+		Task: "Start nginx", Host: "web1", Status: event.StatusFailed, Message: "unit not found",
+	}})
+	view.Handle(event.Event{Type: event.PhaseFinished, Phase: "ansible", Duration: 4 * time.Second, Error: "exit status 2"})
+
+	progress := out.String()
+	assert.Contains(t, progress, "==> terraform\n")
+	assert.Contains(t, progress, "  + hcloud_server.web: creating...\n")
+	assert.Contains(t, progress, "  + hcloud_server.web: create complete (12s)\n")
+	assert.Contains(t, progress, "  [web1] Install nginx: changed (3.5s)\n")
+	assert.Contains(t, progress, "  [web1] Start nginx: failed - unit not found\n")
+	assert.Contains(t, progress, "<== ansible failed after 4s\n")
+
+	var summary bytes.Buffer
+	assert.NoError(t, view.WriteSummary(&summary))
+	assert.Contains(t, summary.String(), "terraform  ok      13s")
+	assert.Contains(t, summary.String(), "ansible    failed  4s")
+	assert.Contains(t, summary.String(), "1 created, 0 updated")
+	assert.Contains(t, summary.String(), "0 ok, 1 changed, 1 failed")
+	assert.Contains(t, summary.String(), `task "Start nginx" on web1: failed - unit not found`)
+}
@@ -5,6 +5,7 @@ package template
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"github.com/bitshifted/liftoff/common"
 	"github.com/bitshifted/liftoff/config"
 	"github.com/bitshifted/liftoff/log"
+	"github.com/rs/zerolog"
 )
 
 const (
@@ -26,51 +28,69 @@ const (
 	ansibleTemplate
 )
 
+// mode of files containing values of sensitive Terraform outputs
+const privateFileMode = 0600
+
 type TemplateProcessor struct {
-	BaseDir        string
-	OutputDir      string
-	TerraformDir   string
-	AnsibleDir     string
+	BaseDir      string
+	OutputDir    string
+	TerraformDir string
+	AnsibleDir   string
+	// Logger for log messages. Logging is disabled if not set
+	Logger *zerolog.Logger
+	// Callback invoked after each file is rendered
+	OnFileRendered func(templatePath, outputPath string, changed bool)
 	generatedFiles []string
+	changedFiles   []string
 }
 
 type templateType int
 
+func (tp *TemplateProcessor) logger() *zerolog.Logger {
+	return log.OrNop(tp.Logger)
+}
+
+// ChangedFiles returns paths of files created or modified by the last template processing
+func (tp *TemplateProcessor) ChangedFiles() []string {
+	return tp.changedFiles
+}
+
 func (tp *TemplateProcessor) ProcessTerraformTemplates(conf *config.Configuration) error {
 	if tp.TerraformDir == "" {
 		tp.TerraformDir = common.DefaultTerraformDir
 	}
 	tfTemplateDir := path.Join(tp.BaseDir, tp.TerraformDir)
-	log.Logger.Debug().Msgf("Terraform template directory: %s", tfTemplateDir)
+	tp.logger().Debug().Msgf("Terraform template directory: %s", tfTemplateDir)
 	tfTemplateDirExt := ""
 	if conf.TemplateConfig != nil {
 		tfTemplateDirExt = conf.TemplateConfig.TerraformExtraDir
-		log.Logger.Debug().Msgf("Terraform extra template directory: %s", tfTemplateDirExt)
+		tp.logger().Debug().Msgf("Terraform extra template directory: %s", tfTemplateDirExt)
 	}
 	outputDir := tp.calculateOutputDirectory(terraformTemplate)
-	log.Logger.Info().Msgf("Terraform output directory: %s", outputDir)
+	tp.changedFiles = []string{}
+	tp.logger().Info().Msgf("Terraform output directory: %s", outputDir)
 	err := os.MkdirAll(outputDir, os.ModePerm)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to create output directory")
+		tp.logger().Error().Err(err).Msg("Failed to create output directory")
 		return err
 	}
 	// process extra Terraform templates
 	if tfTemplateDirExt != "" {
 		err = tp.fileWalker(tfTemplateDirExt, conf, terraformTemplate, true)
 		if err != nil {
-			log.Logger.Error().Err(err).Msg("Failed to process Terraform extra templates")
+			tp.logger().Error().Err(err).Msg("Failed to process Terraform extra templates")
 			return err
 		}
 	}
 	// process local Terraform templates
 	err = tp.fileWalker(tfTemplateDir, conf, terraformTemplate, false)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to process Terraform templates")
+		tp.logger().Error().Err(err).Msg("Failed to process Terraform templates")
 		return err
 	}
 	err = tp.writeGeneratedFilePaths(outputDir)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to write generated file paths")
+		tp.logger().Error().Err(err).Msg("Failed to write generated file paths")
 	}
 	return err
 }
@@ -80,36 +100,37 @@ func (tp *TemplateProcessor) ProcessAnsibleTemplates(conf *config.Configuration)
 		tp.AnsibleDir = common.DefaultAnsibleDir
 	}
 	ansibleTemplateDir := path.Join(tp.BaseDir, tp.AnsibleDir)
-	log.Logger.Debug().Msgf("Ansible template directory: %s", ansibleTemplateDir)
+	tp.logger().Debug().Msgf("Ansible template directory: %s", ansibleTemplateDir)
 	outputDir := tp.calculateOutputDirectory(ansibleTemplate)
-	log.Logger.Info().Msgf("Ansible output directory: %s", outputDir)
+	tp.logger().Info().Msgf("Ansible output directory: %s", outputDir)
 	err := os.MkdirAll(outputDir, os.ModePerm)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to create output directory")
+		tp.logger().Error().Err(err).Msg("Failed to create output directory")
 		return err
 	}
 	_, err = os.Stat(ansibleTemplateDir)
 	if err != nil && errors.Is(err, os.ErrNotExist) {
-		log.Logger.Warn().Msgf("Ansible template directory %s does not exist. Skipping", ansibleTemplateDir)
+		tp.logger().Warn().Msgf("Ansible template directory %s does not exist. Skipping", ansibleTemplateDir)
 		return nil
 	}
 	tp.generatedFiles = []string{}
+	tp.changedFiles = []string{}
 	err = tp.fileWalker(ansibleTemplateDir, conf, ansibleTemplate, false)
 	if err != nil {
 		return err
 	}
 	err = tp.writeGeneratedFilePaths(outputDir)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to write generated file paths")
+		tp.logger().Error().Err(err).Msg("Failed to write generated file paths")
 	}
 	return err
 }
 
 func (tp *TemplateProcessor) processTemplate(templatePath string, conf *config.Configuration, tmplType templateType, override bool) error {
-	log.Logger.Debug().Msgf("Processing template file %s type %d", templatePath, tmplType)
+	tp.logger().Debug().Msgf("Processing template file %s type %d", templatePath, tmplType)
 	tmpl, err := template.New(filepath.Base(templatePath)).Delims("[[", "]]").ParseFiles(templatePath)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to parse template")
+		tp.logger().Error().Err(err).Msg("Failed to parse template")
 		return err
 	}
 	outName := extractFileNameFromPath(templatePath)
@@ -118,21 +139,90 @@ func (tp *TemplateProcessor) processTemplate(templatePath string, conf *config.C
 		relPath, err = filepath.Rel(conf.TemplateConfig.TerraformExtraDir, outName)
 	}
 	if err != nil {
-		log.Logger.Error().Err(err).Msgf("Failed to find relative path for %s", outName)
+		tp.logger().Error().Err(err).Msgf("Failed to find relative path for %s", outName)
 		return err
 	}
 	outFilePath := path.Join(tp.OutputDir, relPath)
 	if tmplType == terraformTemplate && conf.TemplateConfig != nil && conf.TemplateConfig.TerraformExtraDir != "" && override {
 		outFilePath = path.Join(path.Join(tp.OutputDir, tp.TerraformDir), relPath)
 	}
-	log.Logger.Debug().Msgf("Output file path: %s", outFilePath)
-	outFile, err := os.Create(outFilePath)
+	tp.logger().Debug().Msgf("Output file path: %s", outFilePath)
+	var content bytes.Buffer
+	err = tmpl.Execute(&content, conf)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to create output template file")
+		tp.logger().Error().Err(err).Msgf("Failed to execute template %s", templatePath)
 		return err
 	}
 	tp.generatedFiles = append(tp.generatedFiles, outFilePath)
-	return tmpl.Execute(outFile, conf)
+	mode := os.FileMode(fileMode)
+	if containsSensitiveOutput(content.Bytes(), conf) {
+		tp.logger().Debug().Msgf("File %s contains sensitive Terraform outputs", outFilePath)
+		mode = privateFileMode
+	}
+	existing, err := os.ReadFile(outFilePath)
+	if err == nil && bytes.Equal(existing, content.Bytes()) {
+		tp.logger().Debug().Msgf("File %s is unchanged", outFilePath)
+		tp.fileRendered(templatePath, outFilePath, false)
+		return tp.restrictFileMode(outFilePath, mode)
+	}
+	err = os.WriteFile(outFilePath, content.Bytes(), mode)
+	if err == nil {
+		err = tp.restrictFileMode(outFilePath, mode)
+	}
+	if err != nil {
+		tp.logger().Error().Err(err).Msg("Failed to create output template file")
+		return err
+	}
+	tp.changedFiles = append(tp.changedFiles, outFilePath)
+	tp.fileRendered(templatePath, outFilePath, true)
+	return nil
+}
+
+func (tp *TemplateProcessor) fileRendered(templatePath, outputPath string, changed bool) {
+	if tp.OnFileRendered != nil {
+		tp.OnFileRendered(templatePath, outputPath, changed)
+	}
+}
+
+// sets private mode on file, since permissions of existing file are not changed by WriteFile
+func (tp *TemplateProcessor) restrictFileMode(filePath string, mode os.FileMode) error {
+	if mode != privateFileMode {
+		return nil
+	}
+	return os.Chmod(filePath, mode)
+}
+
+// returns true if content contains string value of any sensitive Terraform output
+func containsSensitiveOutput(content []byte, conf *config.Configuration) bool {
+	for _, name := range conf.SensitiveOutputs {
+		for _, value := range stringValues(conf.Outputs[name]) {
+			if value != "" && bytes.Contains(content, []byte(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns all strings in value, including ones nested in lists and maps
+func stringValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			result = append(result, stringValues(item)...)
+		}
+		return result
+	case map[string]interface{}:
+		var result []string
+		for _, item := range v {
+			result = append(result, stringValues(item)...)
+		}
+		return result
+	}
+	return nil
 }
 
 func extractFileNameFromPath(filePath string) string {
@@ -144,11 +234,11 @@ func extractFileNameFromPath(filePath string) string {
 
 func (tp *TemplateProcessor) fileWalker(templateDir string, conf *config.Configuration, tmplType templateType, override bool) error {
 	if _, err := os.Stat(templateDir); os.IsNotExist(err) {
-		log.Logger.Warn().Msgf("Template directory %s does not exist. Skipping", templateDir)
+		tp.logger().Warn().Msgf("Template directory %s does not exist. Skipping", templateDir)
 		return nil
 	}
 	return filepath.Walk(templateDir, func(fpath string, info os.FileInfo, err error) error {
-		log.Logger.Debug().Msgf("Walk file %s", fpath)
+		tp.logger().Debug().Msgf("Walk file %s", fpath)
 		if err != nil {
 			return err
 		}
@@ -157,11 +247,11 @@ func (tp *TemplateProcessor) fileWalker(templateDir string, conf *config.Configu
 			relPath, err = filepath.Rel(conf.TemplateConfig.TerraformExtraDir, fpath)
 		}
 		if err != nil {
-			log.Logger.Error().Err(err).Msgf("Failed to find reataive path for %s", fpath)
+			tp.logger().Error().Err(err).Msgf("Failed to find reataive path for %s", fpath)
 			return err
 		}
 		if info.IsDir() {
-			log.Logger.Debug().Msgf("Creating output directory %s", relPath)
+			tp.logger().Debug().Msgf("Creating output directory %s", relPath)
 			return os.MkdirAll(path.Join(tp.OutputDir, relPath), os.ModePerm)
 		} else {
 			return tp.processTemplate(fpath, conf, tmplType, override)
@@ -192,10 +282,10 @@ func (tp *TemplateProcessor) calculateOutputDirectory(tmplType templateType) str
 }
 
 func (tp *TemplateProcessor) cleanupGeneratedFiles(baseDir string) error {
-	log.Logger.Debug().Msgf("Cleaning up files in %s", baseDir)
+	tp.logger().Debug().Msgf("Cleaning up files in %s", baseDir)
 	inFile, err := os.OpenFile(path.Join(baseDir, generatedFilesName), os.O_RDONLY|os.O_CREATE, fileMode)
 	if err != nil {
-		log.Logger.Warn().Err(err).Msg("Failed to open .genfiles for reading")
+		tp.logger().Warn().Err(err).Msg("Failed to open .genfiles for reading")
 		return err
 	}
 	defer inFile.Close()
@@ -210,10 +300,10 @@ func (tp *TemplateProcessor) cleanupGeneratedFiles(baseDir string) error {
 			}
 		}
 		if toDelete {
-			log.Logger.Info().Msgf("Deleting redundant file %s", scanned)
+			tp.logger().Info().Msgf("Deleting redundant file %s", scanned)
 			derr := os.Remove(scanned)
 			if err != nil {
-				log.Logger.Error().Err(derr).Msgf("Failed to delete file %s", scanned)
+				tp.logger().Error().Err(derr).Msgf("Failed to delete file %s", scanned)
 			}
 		}
 	}
@@ -223,11 +313,11 @@ func (tp *TemplateProcessor) cleanupGeneratedFiles(baseDir string) error {
 func (tp *TemplateProcessor) writeGeneratedFilePaths(baseDir string) error {
 	err := tp.cleanupGeneratedFiles(baseDir)
 	if err != nil {
-		log.Logger.Warn().Err(err).Msg("Error cleaning generated files")
+		tp.logger().Warn().Err(err).Msg("Error cleaning generated files")
 	}
 	outFile, err := os.OpenFile(path.Join(baseDir, generatedFilesName), os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileMode)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to open file for writing")
+		tp.logger().Error().Err(err).Msg("Failed to open file for writing")
 		return err
 	}
 	defer outFile.Close()
@@ -236,7 +326,7 @@ func (tp *TemplateProcessor) writeGeneratedFilePaths(baseDir string) error {
 		txt := fmt.Sprintf("%s\n", fpath)
 		_, err = writer.WriteString(txt)
 		if err != nil {
-			log.Logger.Warn().Msgf("Could not write generated file path: %s", fpath)
+			tp.logger().Warn().Msgf("Could not write generated file path: %s", fpath)
 		}
 	}
 	return writer.Flush()
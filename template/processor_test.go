@@ -55,3 +55,40 @@ func TestProcessAnsibleFiles(t *testing.T) {
 	_, err = os.Stat(path.Join(tmpDir, common.DefaultAnsibleDir, "roles/some-role/tasks/main.yaml"))
 	assert.NoError(t, err)
 }
+
+func TestProcessTemplatesWithSensitiveOutputs(t *testing.T) {
+	baseDir := t.TempDir()
+	ansibleDir := path.Join(baseDir, common.DefaultAnsibleDir)
+	assert.NoError(t, os.MkdirAll(ansibleDir, 0o755))
+	assert.NoError(t, os.WriteFile(path.Join(ansibleDir, "inventory.tmpl"), []byte("[[ .Outputs.server_ip ]]\n"), 0o644))
+	assert.NoError(t, os.WriteFile(path.Join(ansibleDir, "vars.yaml.tmpl"),
+		[]byte("db_password: [[ .Outputs.db.password ]]\nserver_ip: [[ .ProcessingVars.server_ip ]]\n"), 0o644))
+	outputDir := t.TempDir()
+	processor := TemplateProcessor{BaseDir: baseDir, OutputDir: outputDir}
+	conf := &config.Configuration{
+		ProcessingVars: map[string]interface{}{"server_ip": "10.0.0.5"},
+		Outputs: map[string]interface{}{
+			"server_ip": "10.0.0.5",
+			"db":        map[string]interface{}{"password": "secret"},
+		},
+		SensitiveOutputs: []string{"db"},
+	}
+	err := processor.ProcessAnsibleTemplates(conf)
+	assert.NoError(t, err)
+
+	inventory := path.Join(outputDir, common.DefaultAnsibleDir, "inventory")
+	content, err := os.ReadFile(inventory)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5\n", string(content))
+	info, err := os.Stat(inventory)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	vars := path.Join(outputDir, common.DefaultAnsibleDir, "vars.yaml")
+	content, err = os.ReadFile(vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "db_password: secret\nserver_ip: 10.0.0.5\n", string(content))
+	info, err = os.Stat(vars)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}